@@ -0,0 +1,363 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/michaelperel/docker-lock/semver"
+)
+
+// Advisory is a vulnerability in the OSV format (https://ossf.github.io/osv-schema/).
+// An affected package's name is an image repository, such as 'nginx' or
+// 'ghcr.io/myorg/app', its versions are tags, and its ranges are of tags
+// that are semantic versions. Digests of affected images may be listed in
+// the affected package's 'database_specific.digests'. For instance:
+//
+//	{
+//		"id": "CVE-2021-23017",
+//		"summary": "Off-by-one in the nginx resolver",
+//		"database_specific": {"severity": "HIGH"},
+//		"affected": [{
+//			"package": {"name": "nginx"},
+//			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0.6.18"}, {"fixed": "1.21.0"}]}]
+//		}]
+//	}
+type Advisory struct {
+	ID               string     `json:"id"`
+	Aliases          []string   `json:"aliases,omitempty"`
+	Summary          string     `json:"summary,omitempty"`
+	Withdrawn        string     `json:"withdrawn,omitempty"`
+	Severity         []Severity `json:"severity,omitempty"`
+	Affected         []Affected `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity,omitempty"`
+	} `json:"database_specific"`
+}
+
+// Severity's Type is 'CVSS_V3', whose Score is a vector such as
+// 'CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H', or a type whose Score is
+// a number, such as '7.5'.
+type Severity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem,omitempty"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Versions         []string `json:"versions,omitempty"`
+	Ranges           []Range  `json:"ranges,omitempty"`
+	DatabaseSpecific struct {
+		Digests []string `json:"digests,omitempty"`
+	} `json:"database_specific"`
+}
+
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+// severities are ordered from least to most severe. Advisories without a
+// severity are 'unknown', which is treated as the most severe.
+var severities = []string{"low", "medium", "high", "critical", "unknown"}
+
+func severityRank(severity string) int {
+	for i, s := range severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// LoadAdvisories reads the advisories in fpath, which is either a JSON file
+// of an advisory or an array of advisories, or a directory of such files,
+// such as an OSV database export. Withdrawn advisories are skipped.
+func LoadAdvisories(fpath string) ([]Advisory, error) {
+	info, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var fpaths []string
+	if info.IsDir() {
+		err := filepath.WalkDir(fpath, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.EqualFold(filepath.Ext(p), ".json") {
+				fpaths = append(fpaths, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fpaths = []string{fpath}
+	}
+	var advisories []Advisory
+	for _, p := range fpaths {
+		fileAdvisories, err := readAdvisories(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s. From advisory file: '%s'.", err, p)
+		}
+		for _, advisory := range fileAdvisories {
+			if advisory.Withdrawn != "" {
+				continue
+			}
+			if advisory.ID == "" {
+				return nil, fmt.Errorf("Advisory has no id. From advisory file: '%s'.", p)
+			}
+			if _, _, err := advisory.severity(); err != nil {
+				return nil, fmt.Errorf("%s From advisory file: '%s'.", err, p)
+			}
+			advisories = append(advisories, advisory)
+		}
+	}
+	return advisories, nil
+}
+
+func readAdvisories(fpath string) ([]Advisory, error) {
+	byt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := strings.TrimSpace(string(byt)); strings.HasPrefix(trimmed, "[") {
+		var advisories []Advisory
+		if err := json.Unmarshal(byt, &advisories); err != nil {
+			return nil, err
+		}
+		return advisories, nil
+	}
+	var advisory Advisory
+	if err := json.Unmarshal(byt, &advisory); err != nil {
+		return nil, err
+	}
+	return []Advisory{advisory}, nil
+}
+
+// severity returns the advisory's severity, one of severities, and its CVSS
+// score, or 0 if it has none. The severity of the database, such as
+// GitHub's 'MODERATE', takes precedence over the score's.
+func (a *Advisory) severity() (string, float64, error) {
+	var score float64
+	for _, severity := range a.Severity {
+		var err error
+		if severity.Type == "CVSS_V3" || strings.HasPrefix(severity.Score, "CVSS:3") {
+			score, err = cvss3BaseScore(severity.Score)
+		} else if score, err = strconv.ParseFloat(severity.Score, 64); err != nil {
+			err = errors.New("Expected a CVSS 3 vector or a number.")
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("Invalid severity score '%s' of advisory '%s'. %s", severity.Score, a.ID, err)
+		}
+		break
+	}
+	switch s := strings.ToLower(a.DatabaseSpecific.Severity); s {
+	case "":
+	case "moderate":
+		return "medium", score, nil
+	case "low", "medium", "high", "critical":
+		return s, score, nil
+	default:
+		return "", 0, fmt.Errorf("Unknown severity '%s' of advisory '%s'. Expected 'low', 'medium', 'high' or 'critical'.", a.DatabaseSpecific.Severity, a.ID)
+	}
+	switch {
+	case len(a.Severity) == 0:
+		return "unknown", 0, nil
+	case score >= 9:
+		return "critical", score, nil
+	case score >= 7:
+		return "high", score, nil
+	case score >= 4:
+		return "medium", score, nil
+	}
+	return "low", score, nil
+}
+
+// affects reports whether the advisory affects the image, whose name is
+// normalized and whose digest has no 'sha256:' prefix.
+func (a *Advisory) affects(name string, tag string, digest string) bool {
+	for _, affected := range a.Affected {
+		if normalizeName(affected.Package.Name) == name && affected.affects(tag, digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects reports whether the image is affected. If no versions, ranges or
+// digests are listed, every tag is affected.
+func (a *Affected) affects(tag string, digest string) bool {
+	if len(a.Versions) == 0 && len(a.Ranges) == 0 && len(a.DatabaseSpecific.Digests) == 0 {
+		return true
+	}
+	for _, d := range a.DatabaseSpecific.Digests {
+		if digest != "" && strings.TrimPrefix(d, "sha256:") == digest {
+			return true
+		}
+	}
+	for _, version := range a.Versions {
+		if tag != "" && version == tag {
+			return true
+		}
+	}
+	for _, r := range a.Ranges {
+		if r.affects(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects evaluates the range's events in version order, as OSV specifies.
+// Tags that are not semantic versions, such as 'latest', are not in ranges.
+func (r *Range) affects(tag string) bool {
+	if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+		return false
+	}
+	version, err := semver.Parse(tag)
+	if err != nil {
+		return false
+	}
+	type event struct {
+		version *semver.Version
+		Event
+	}
+	var events []event
+	for _, e := range r.Events {
+		eventVersion := e.Introduced + e.Fixed + e.LastAffected
+		if e.Introduced == "0" {
+			eventVersion = "0.0.0"
+		}
+		v, err := semver.Parse(eventVersion)
+		if err != nil {
+			continue
+		}
+		events = append(events, event{version: v, Event: e})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].version.Compare(events[j].version) < 0
+	})
+	affected := false
+	for _, e := range events {
+		cmp := version.Compare(e.version)
+		switch {
+		case e.Introduced != "" && cmp >= 0:
+			affected = true
+		case e.Fixed != "" && cmp >= 0:
+			affected = false
+		case e.LastAffected != "" && cmp > 0:
+			affected = false
+		}
+	}
+	return affected
+}
+
+// normalizeName returns the name of an image as Docker Hub images are
+// usually written, such as 'nginx' for 'docker.io/library/nginx'.
+func normalizeName(name string) string {
+	name = strings.ToLower(name)
+	for _, host := range []string{"docker.io/", "index.docker.io/", "registry-1.docker.io/"} {
+		if strings.HasPrefix(name, host) {
+			name = strings.TrimPrefix(name, host)
+			if strings.HasPrefix(name, "library/") && strings.Count(name, "/") == 1 {
+				name = strings.TrimPrefix(name, "library/")
+			}
+			break
+		}
+	}
+	return name
+}
+
+// cvss3BaseScore computes the base score of a CVSS 3.0 or 3.1 vector, as in
+// https://www.first.org/cvss/v3.1/specification-document#7-1-Base-Metrics-Equations.
+func cvss3BaseScore(vector string) (float64, error) {
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+		"UI": {"N": 0.85, "R": 0.62},
+		"S":  {"U": 0, "C": 0},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	parts := strings.Split(vector, "/")
+	if !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, fmt.Errorf("Expected a CVSS 3 vector.")
+	}
+	metrics := make(map[string]string)
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return 0, fmt.Errorf("Invalid metric '%s'.", part)
+		}
+		metrics[kv[0]] = kv[1]
+	}
+	values := make(map[string]float64)
+	for metric, weight := range weights {
+		value, ok := weight[metrics[metric]]
+		if !ok {
+			return 0, fmt.Errorf("Invalid or missing base metric '%s'.", metric)
+		}
+		values[metric] = value
+	}
+	changed := metrics["S"] == "C"
+	if changed && metrics["PR"] == "L" {
+		values["PR"] = 0.68
+	} else if changed && metrics["PR"] == "H" {
+		values["PR"] = 0.5
+	}
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*pow15(iss-0.02)
+	}
+	if impact <= 0 {
+		return 0, nil
+	}
+	exploitability := 8.22 * values["AV"] * values["AC"] * values["PR"] * values["UI"]
+	score := impact + exploitability
+	if changed {
+		score *= 1.08
+	}
+	if score > 10 {
+		score = 10
+	}
+	return roundUp(score), nil
+}
+
+func pow15(x float64) float64 {
+	result := 1.0
+	for i := 0; i < 15; i++ {
+		result *= x
+	}
+	return result
+}
+
+// roundUp rounds up to one decimal, avoiding floating point errors as the
+// CVSS specification does.
+func roundUp(x float64) float64 {
+	i := int64(x*100000 + 0.5)
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
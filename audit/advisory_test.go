@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCVSS3BaseScore(t *testing.T) {
+	tests := map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H": 10,
+		"CVSS:3.0/AV:N/AC:H/PR:N/UI:N/S:U/C:N/I:N/A:H": 5.9,
+		"CVSS:3.1/AV:L/AC:L/PR:L/UI:N/S:U/C:L/I:N/A:N": 3.3,
+		"CVSS:3.1/AV:N/AC:L/PR:L/UI:R/S:C/C:L/I:L/A:N": 5.4,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N": 0,
+	}
+	for vector, expected := range tests {
+		score, err := cvss3BaseScore(vector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if score != expected {
+			t.Fatalf("Got %v for '%s'. Expected %v.", score, vector, expected)
+		}
+	}
+	for _, vector := range []string{"CVSS:2.0/AV:N", "CVSS:3.1/AV:N/AC:L", "CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"} {
+		if _, err := cvss3BaseScore(vector); err == nil {
+			t.Fatalf("Invalid vector '%s' should fail.", vector)
+		}
+	}
+}
+
+func TestLoadAdvisories(t *testing.T) {
+	advisories, err := LoadAdvisories(filepath.Join("testdata", "osv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"BUSYBOX-2021-0001": "critical",
+		"CVE-2021-23017":    "high",
+		"UBUNTU-2021-0001":  "low",
+	}
+	if len(advisories) != len(expected) {
+		t.Fatalf("Got %d advisories. Expected %d, without the withdrawn advisory.", len(advisories), len(expected))
+	}
+	for _, advisory := range advisories {
+		severity, _, err := advisory.severity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if severity != expected[advisory.ID] {
+			t.Fatalf("Got '%s' severity for '%s'. Expected '%s'.", severity, advisory.ID, expected[advisory.ID])
+		}
+	}
+	advisories, err = LoadAdvisories(filepath.Join("testdata", "advisories.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(advisories) != 1 || advisories[0].ID != "GOLANG-2021-0001" {
+		t.Fatalf("Got %+v. Expected 'GOLANG-2021-0001'.", advisories)
+	}
+	if severity, _, _ := advisories[0].severity(); severity != "unknown" {
+		t.Fatalf("Got '%s' severity. Expected 'unknown'.", severity)
+	}
+	if _, err := LoadAdvisories(filepath.Join("testdata", "faulty-advisories.json")); err == nil {
+		t.Fatal("Unknown severity should fail.")
+	}
+}
+
+func TestAffects(t *testing.T) {
+	advisory := Advisory{ID: "TEST-0001",
+		Affected: []Affected{
+			{Versions: []string{"alpine"},
+				Ranges: []Range{
+					{Type: "SEMVER", Events: []Event{{Introduced: "0"}, {Fixed: "1.0.0"}, {Introduced: "1.5.0"}, {LastAffected: "1.6.2"}}},
+				},
+			},
+		},
+	}
+	advisory.Affected[0].Package.Name = "index.docker.io/library/nginx"
+	advisory.Affected[0].DatabaseSpecific.Digests = []string{"sha256:abc"}
+	tests := []struct {
+		name     string
+		tag      string
+		digest   string
+		expected bool
+	}{
+		{"nginx", "0.9.1", "", true},
+		{"nginx", "1.0.0", "", false},
+		{"nginx", "1.4", "", false},
+		{"nginx", "1.5.0", "", true},
+		{"nginx", "v1.6.2", "", true},
+		{"nginx", "1.6.3", "", false},
+		{"nginx", "alpine", "", true},
+		{"nginx", "latest", "", false},
+		{"nginx", "latest", "abc", true},
+		{"myorg/nginx", "0.9.1", "", false},
+	}
+	for _, test := range tests {
+		if affects := advisory.affects(test.name, test.tag, test.digest); affects != test.expected {
+			t.Fatalf("Got %t for '%s:%s@%s'. Expected %t.", affects, test.name, test.tag, test.digest, test.expected)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/sarif"
+)
+
+// Auditor matches the images in a Lockfile against advisories, without
+// contacting registries or advisory databases.
+type Auditor struct {
+	Advisories []Advisory
+	Exceptions []Exception
+	// FailOn is the least severity of findings that fail the audit, such as
+	// 'high'. Findings of advisories without a severity always fail.
+	FailOn string
+	// Now is when exceptions expire. If zero, the current time is used.
+	Now time.Time
+}
+
+// Finding is an image in the Lockfile that an advisory affects. Exception
+// is set if the finding is an accepted risk.
+type Finding struct {
+	Advisory  string     `json:"advisory"`
+	Aliases   []string   `json:"aliases,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Severity  string     `json:"severity"`
+	Score     float64    `json:"score,omitempty"`
+	Image     string     `json:"image"`
+	Section   string     `json:"section"`
+	File      string     `json:"file"`
+	Exception *Exception `json:"exception,omitempty"`
+}
+
+type Report struct {
+	Findings []Finding `json:"findings"`
+	// ExpiredExceptions no longer cover findings, and should be renewed or
+	// removed.
+	ExpiredExceptions []Exception `json:"expiredExceptions,omitempty"`
+	failOn            string
+	lockfile          string
+}
+
+// Options name the advisories and exceptions to audit with.
+// ExceptionsFile is optional.
+type Options struct {
+	AdvisoriesPath string
+	ExceptionsFile string
+	FailOn         string
+}
+
+func NewAuditor(opts Options) (*Auditor, error) {
+	if severityRank(opts.FailOn) == -1 || opts.FailOn == "unknown" {
+		return nil, fmt.Errorf("Unknown severity '%s'. Expected 'low', 'medium', 'high' or 'critical'.", opts.FailOn)
+	}
+	advisories, err := LoadAdvisories(opts.AdvisoriesPath)
+	if err != nil {
+		return nil, err
+	}
+	var exceptions []Exception
+	if opts.ExceptionsFile != "" {
+		if exceptions, err = LoadExceptions(opts.ExceptionsFile); err != nil {
+			return nil, err
+		}
+	}
+	return &Auditor{Advisories: advisories, Exceptions: exceptions, FailOn: opts.FailOn}, nil
+}
+
+// AuditLockfile audits the Lockfile at flags.Outfile.
+func AuditLockfile(flags *Flags) (*Report, error) {
+	auditor, err := NewAuditor(flags.Options)
+	if err != nil {
+		return nil, err
+	}
+	lFile, err := generate.ReadLockfile(flags.Outfile, flags.LockfileFormat)
+	if err != nil {
+		return nil, err
+	}
+	report := auditor.Audit(lFile)
+	report.lockfile = filepath.ToSlash(flags.Outfile)
+	return report, nil
+}
+
+// Audit reports every image in the Lockfile that an advisory affects.
+// Findings are sorted by section, file, image and advisory.
+func (a *Auditor) Audit(lFile *generate.Lockfile) *Report {
+	now := a.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	report := &Report{Findings: []Finding{}, failOn: a.FailOn}
+	for _, exception := range a.Exceptions {
+		if exception.expired(now) {
+			report.ExpiredExceptions = append(report.ExpiredExceptions, exception)
+		}
+	}
+	seen := make(map[string]bool)
+	check := func(section string, file string, image generate.Image) {
+		name := normalizeName(image.Name)
+		for i := range a.Advisories {
+			advisory := &a.Advisories[i]
+			if !advisory.affects(name, image.LockedTag(), image.Digest) {
+				continue
+			}
+			finding := Finding{Advisory: advisory.ID,
+				Aliases: advisory.Aliases,
+				Summary: advisory.Summary,
+				Image:   imageReference(image),
+				Section: section,
+				File:    file,
+			}
+			key := strings.Join([]string{finding.Advisory, section, file, finding.Image}, "\x00")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			finding.Severity, finding.Score, _ = advisory.severity()
+			for j := range a.Exceptions {
+				exception := a.Exceptions[j]
+				if !exception.expired(now) && exception.covers(advisory, name) {
+					finding.Exception = &exception
+					break
+				}
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+	for file, images := range lFile.DockerfileImages {
+		for _, image := range images {
+			check("dockerfiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.ComposefileImages {
+		for _, image := range images {
+			check("composefiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.KubernetesfileImages {
+		for _, image := range images {
+			check("kubernetesfiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.CIfileImages {
+		for _, image := range images {
+			check("cifiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.BakefileImages {
+		for _, image := range images {
+			check("bakefiles", file, image.Image)
+		}
+	}
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Section != b.Section {
+			return a.Section < b.Section
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Image != b.Image {
+			return a.Image < b.Image
+		}
+		return a.Advisory < b.Advisory
+	})
+	return report
+}
+
+func imageReference(image generate.Image) string {
+	ref := image.Name
+	if tag := image.LockedTag(); tag != "" {
+		ref += ":" + tag
+	}
+	if image.Digest != "" {
+		ref += "@sha256:" + image.Digest
+	}
+	return ref
+}
+
+// Failed returns the findings that fail the audit: those that are not
+// accepted risks and are at least as severe as FailOn.
+func (r *Report) Failed() []Finding {
+	var failed []Finding
+	for _, finding := range r.Findings {
+		if finding.Exception == nil && severityRank(finding.Severity) >= severityRank(r.failOn) {
+			failed = append(failed, finding)
+		}
+	}
+	return failed
+}
+
+// Err returns an error if any finding fails the audit.
+func (r *Report) Err() error {
+	if failed := r.Failed(); len(failed) != 0 {
+		return fmt.Errorf("Found %d vulnerable images.", len(failed))
+	}
+	return nil
+}
+
+// Message describes the finding.
+func (f *Finding) Message() string {
+	message := fmt.Sprintf("Image '%s' is affected by %s advisory '%s'", f.Image, f.Severity, f.Advisory)
+	if f.Summary != "" {
+		message += ": " + strings.TrimSuffix(f.Summary, ".")
+	}
+	message += fmt.Sprintf(". Locked for '%s'.", f.File)
+	if f.Exception != nil {
+		message += fmt.Sprintf(" Accepted until %s", f.Exception.Expires)
+		if f.Exception.Reason != "" {
+			message += ": " + strings.TrimSuffix(f.Exception.Reason, ".")
+		}
+		message += "."
+	}
+	return message
+}
+
+// Write writes the report as text, JSON or SARIF, depending on format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(r)
+	case "sarif":
+		var rules []sarif.Rule
+		seen := make(map[string]bool)
+		results := []sarif.Result{}
+		for _, finding := range r.Findings {
+			if !seen[finding.Advisory] {
+				seen[finding.Advisory] = true
+				rule := sarif.Rule{ID: finding.Advisory}
+				if finding.Summary != "" {
+					rule.ShortDescription = &sarif.Message{Text: finding.Summary}
+				}
+				rules = append(rules, rule)
+			}
+			result := sarif.Result{RuleID: finding.Advisory,
+				Level:   sarifLevel(finding.Severity),
+				Message: sarif.Message{Text: finding.Message()},
+			}
+			if finding.Exception != nil {
+				result.Level = "note"
+			}
+			if r.lockfile != "" {
+				result.Locations = []sarif.Location{sarif.NewLocation(r.lockfile, 0, 0)}
+			}
+			results = append(results, result)
+		}
+		return sarif.NewLog(rules, results).Write(w)
+	case "text":
+		for _, finding := range r.Findings {
+			status := finding.Severity
+			if finding.Exception != nil {
+				status = "accepted"
+			}
+			if _, err := fmt.Fprintf(w, "%s: %s\n", status, finding.Message()); err != nil {
+				return err
+			}
+		}
+		for _, exception := range r.ExpiredExceptions {
+			if _, err := fmt.Fprintf(w, "expired: Exception for '%s' expired on %s.\n", exception.Advisory, exception.Expires); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported format '%s'. Expected 'text', 'json' or 'sarif'.", format)
+}
+
+func sarifLevel(severity string) string {
+	switch severity {
+	case "low", "medium":
+		return "warning"
+	}
+	return "error"
+}
@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/sarif"
+)
+
+func testAuditor(t *testing.T, failOn string) *Auditor {
+	a, err := NewAuditor(Options{AdvisoriesPath: filepath.Join("testdata", "osv"),
+		ExceptionsFile: filepath.Join("testdata", "exceptions.json"),
+		FailOn:         failOn,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	return a
+}
+
+func testLockfile() *generate.Lockfile {
+	return &generate.Lockfile{
+		DockerfileImages: map[string][]generate.DockerfileImage{
+			"Dockerfile": {
+				{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "123"}},
+				{Image: generate.Image{Name: "busybox", Tag: "latest", Digest: "bad"}},
+				{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "123"}},
+			},
+		},
+		KubernetesfileImages: map[string][]generate.KubernetesfileImage{
+			"k8s/app.yaml": {
+				{Image: generate.Image{Name: "docker.io/library/nginx", Tag: "1.19.0", Digest: "456"}},
+				{Image: generate.Image{Name: "nginx", Tag: "1.21.0", Digest: "789"}},
+			},
+		},
+	}
+}
+
+func TestAudit(t *testing.T) {
+	report := testAuditor(t, "low").Audit(testLockfile())
+	exceptions, err := LoadExceptions(filepath.Join("testdata", "exceptions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Finding{
+		{Advisory: "BUSYBOX-2021-0001", Summary: "Compromised busybox image", Severity: "critical", Score: 9.8,
+			Image: "busybox:latest@sha256:bad", Section: "dockerfiles", File: "Dockerfile"},
+		{Advisory: "UBUNTU-2021-0001", Summary: "Outdated ubuntu release", Severity: "low", Score: 3.3,
+			Image: "ubuntu:18.04@sha256:123", Section: "dockerfiles", File: "Dockerfile"},
+		{Advisory: "CVE-2021-23017", Aliases: []string{"GHSA-x9qc-2h4v-x3gq"}, Summary: "Off-by-one in the nginx resolver.", Severity: "high",
+			Image: "docker.io/library/nginx:1.19.0@sha256:456", Section: "kubernetesfiles", File: "k8s/app.yaml", Exception: &exceptions[0]},
+	}
+	if !reflect.DeepEqual(report.Findings, expected) {
+		t.Fatalf("Got %+v. Expected %+v.", report.Findings, expected)
+	}
+	if !reflect.DeepEqual(report.ExpiredExceptions, exceptions[1:]) {
+		t.Fatalf("Got %+v expired exceptions. Expected %+v.", report.ExpiredExceptions, exceptions[1:])
+	}
+	if failed := report.Failed(); len(failed) != 2 {
+		t.Fatalf("Got %d failed findings. Expected 2, as the nginx finding is accepted.", len(failed))
+	}
+	if err := report.Err(); err == nil {
+		t.Fatal("Unaccepted findings should fail.")
+	}
+}
+
+func TestAuditFailOn(t *testing.T) {
+	lFile := testLockfile()
+	lFile.DockerfileImages["Dockerfile"] = lFile.DockerfileImages["Dockerfile"][:1]
+	report := testAuditor(t, "high").Audit(lFile)
+	if len(report.Findings) != 2 {
+		t.Fatalf("Got %d findings. Expected 2.", len(report.Findings))
+	}
+	if err := report.Err(); err != nil {
+		t.Fatalf("Low and accepted findings should not fail at 'high'. Got '%s'.", err)
+	}
+	a := testAuditor(t, "high")
+	a.Now = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := a.Audit(lFile).Err(); err == nil {
+		t.Fatal("Findings of expired exceptions should fail.")
+	}
+	a.Now = time.Date(2021, 12, 31, 23, 59, 0, 0, time.UTC)
+	if err := a.Audit(lFile).Err(); err != nil {
+		t.Fatalf("Exceptions should be valid through their expiry date. Got '%s'.", err)
+	}
+	if _, err := NewAuditor(Options{AdvisoriesPath: filepath.Join("testdata", "osv"), FailOn: "unknown"}); err == nil {
+		t.Fatal("Unknown fail-on severity should fail.")
+	}
+}
+
+func TestFaultyExceptions(t *testing.T) {
+	if _, err := LoadExceptions(filepath.Join("testdata", "faulty-exceptions.json")); err == nil {
+		t.Fatal("Exceptions without an expiry date should fail.")
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	report := testAuditor(t, "low").Audit(testLockfile())
+	report.lockfile = "docker-lock.json"
+	var text bytes.Buffer
+	if err := report.Write(&text, "text"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "critical: Image 'busybox:latest@sha256:bad' is affected by critical advisory 'BUSYBOX-2021-0001': Compromised busybox image. Locked for 'Dockerfile'.\n" +
+		"low: Image 'ubuntu:18.04@sha256:123' is affected by low advisory 'UBUNTU-2021-0001': Outdated ubuntu release. Locked for 'Dockerfile'.\n" +
+		"accepted: Image 'docker.io/library/nginx:1.19.0@sha256:456' is affected by high advisory 'CVE-2021-23017': Off-by-one in the nginx resolver. Locked for 'k8s/app.yaml'. Accepted until 2021-12-31: The resolver is not used.\n" +
+		"expired: Exception for 'UBUNTU-2021-0001' expired on 2021-01-31.\n"
+	if text.String() != expected {
+		t.Fatalf("Got %q. Expected %q.", text.String(), expected)
+	}
+	var js bytes.Buffer
+	if err := report.Write(&js, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Findings) != 3 || decoded.Findings[2].Exception == nil || decoded.Findings[2].Exception.Expires != "2021-12-31" {
+		t.Fatalf("Got %+v. Expected 3 findings, the last accepted.", decoded.Findings)
+	}
+	var sarifOutput bytes.Buffer
+	if err := report.Write(&sarifOutput, "sarif"); err != nil {
+		t.Fatal(err)
+	}
+	var log sarif.Log
+	if err := json.Unmarshal(sarifOutput.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != 3 || len(log.Runs[0].Results) != 3 {
+		t.Fatalf("Got %+v. Expected 3 rules and results.", log)
+	}
+	levels := []string{log.Runs[0].Results[0].Level, log.Runs[0].Results[1].Level, log.Runs[0].Results[2].Level}
+	if !reflect.DeepEqual(levels, []string{"error", "warning", "note"}) {
+		t.Fatalf("Got %v levels. Expected [error warning note].", levels)
+	}
+	if uri, expected := log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI, sarif.NewLocation("docker-lock.json", 0, 0).PhysicalLocation.ArtifactLocation.URI; uri != expected {
+		t.Fatalf("Got '%s' location. Expected '%s'.", uri, expected)
+	}
+	if err := report.Write(&text, "xml"); err == nil || !strings.Contains(err.Error(), "xml") {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// DefaultExceptionsFile is read from the directory of the Lockfile, so that
+// accepted risks are stored alongside the Lockfile.
+const DefaultExceptionsFile = ".docker-lock-exceptions.json"
+
+const expiresLayout = "2006-01-02"
+
+// Exception accepts the risk of an advisory, by id or alias, until the end
+// of the day Expires, such as '2021-12-31', in UTC. If Images is set, the
+// exception only covers images whose name matches one of Images, which may
+// be patterns such as 'ghcr.io/myorg/*'. Exceptions are read from a JSON
+// file, such as:
+//
+//	{
+//		"exceptions": [
+//			{"advisory": "CVE-2021-23017", "images": ["nginx"], "expires": "2021-12-31", "reason": "The resolver is not used."}
+//		]
+//	}
+type Exception struct {
+	Advisory string   `json:"advisory"`
+	Images   []string `json:"images,omitempty"`
+	Expires  string   `json:"expires"`
+	Reason   string   `json:"reason,omitempty"`
+	expires  time.Time
+}
+
+// ExceptionsFile returns the exceptions file alongside the Lockfile at
+// lockfilePath, or "" if there is none.
+func ExceptionsFile(lockfilePath string) string {
+	fpath := filepath.Join(filepath.Dir(lockfilePath), DefaultExceptionsFile)
+	if _, err := os.Stat(fpath); err != nil {
+		return ""
+	}
+	return fpath
+}
+
+func LoadExceptions(fpath string) ([]Exception, error) {
+	byt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var exceptions struct {
+		Exceptions []Exception `json:"exceptions"`
+	}
+	if err := json.Unmarshal(byt, &exceptions); err != nil {
+		return nil, fmt.Errorf("%s. From exceptions file: '%s'.", err, fpath)
+	}
+	for i := range exceptions.Exceptions {
+		if err := exceptions.Exceptions[i].validate(); err != nil {
+			return nil, fmt.Errorf("%s From exceptions file: '%s'.", err, fpath)
+		}
+	}
+	return exceptions.Exceptions, nil
+}
+
+func (e *Exception) validate() error {
+	if e.Advisory == "" {
+		return errors.New("Exception has no advisory.")
+	}
+	if e.Expires == "" {
+		return fmt.Errorf("Exception for '%s' has no expiry date. Accepted risks must expire.", e.Advisory)
+	}
+	expires, err := time.Parse(expiresLayout, e.Expires)
+	if err != nil {
+		return fmt.Errorf("Invalid expiry date '%s' of exception for '%s'. Expected a date such as '2021-12-31'.", e.Expires, e.Advisory)
+	}
+	e.expires = expires.AddDate(0, 0, 1)
+	for _, image := range e.Images {
+		if _, err := path.Match(image, ""); err != nil {
+			return fmt.Errorf("Invalid image pattern '%s' of exception for '%s'.", image, e.Advisory)
+		}
+	}
+	return nil
+}
+
+// expired reports whether the exception has expired at now.
+func (e *Exception) expired(now time.Time) bool {
+	return !now.Before(e.expires)
+}
+
+// covers reports whether the exception covers the advisory for the image,
+// whose name is normalized.
+func (e *Exception) covers(advisory *Advisory, name string) bool {
+	matchesAdvisory := e.Advisory == advisory.ID
+	for _, alias := range advisory.Aliases {
+		matchesAdvisory = matchesAdvisory || e.Advisory == alias
+	}
+	if !matchesAdvisory {
+		return false
+	}
+	if len(e.Images) == 0 {
+		return true
+	}
+	for _, image := range e.Images {
+		if matched, _ := path.Match(normalizeName(image), name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+// defaultAdvisoriesPaths are audited if no advisories are given.
+var defaultAdvisoriesPaths = []string{".docker-lock-advisories.json", ".docker-lock-advisories"}
+
+type Flags struct {
+	Options
+	Outfile string
+	// LockfileFormat is the name of the Lockfile's format, such as 'yaml'.
+	// If empty, the format is chosen by Outfile's extension.
+	LockfileFormat string
+	Format         string
+}
+
+func NewFlags(cmdLineArgs []string) (*Flags, error) {
+	var outfile string
+	var lockfileFormat string
+	var format string
+	command := flag.NewFlagSet("audit", flag.ExitOnError)
+	command.StringVar(&outfile, "o", "docker-lock.json", "Path to Lockfile to audit.")
+	command.StringVar(&lockfileFormat, "lockfile-format", "", "Format of the Lockfile, 'json', 'yaml' or 'toml'. Defaults to the format of the Lockfile's extension, or 'json'.")
+	command.StringVar(&format, "format", "text", "Output format, 'text', 'json' or 'sarif'.")
+	options := AddFlags(command)
+	command.Parse(cmdLineArgs)
+	if format != "text" && format != "json" && format != "sarif" {
+		return nil, fmt.Errorf("Unsupported format '%s'. Expected 'text', 'json' or 'sarif'.", format)
+	}
+	if _, err := generate.GetLockfileFormat(lockfileFormat, outfile); err != nil {
+		return nil, err
+	}
+	opts, err := options(outfile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.AdvisoriesPath == "" {
+		for _, fpath := range defaultAdvisoriesPaths {
+			if _, err := os.Stat(fpath); err == nil {
+				opts.AdvisoriesPath = fpath
+				break
+			}
+		}
+	}
+	if opts.AdvisoriesPath == "" {
+		return nil, fmt.Errorf("No advisories to audit with. Expected '-advisories', '%s' or '%s'.", defaultAdvisoriesPaths[0], defaultAdvisoriesPaths[1])
+	}
+	return &Flags{Options: *opts,
+		Outfile:        outfile,
+		LockfileFormat: lockfileFormat,
+		Format:         format,
+	}, nil
+}
+
+// AddFlags adds the flags that name advisories and exceptions to command.
+// After parsing, the returned function returns their Options for the
+// Lockfile at outfile, whose exceptions file is used by default.
+func AddFlags(command *flag.FlagSet) func(outfile string) (*Options, error) {
+	var advisoriesPath string
+	var exceptionsFile string
+	var failOn string
+	command.StringVar(&advisoriesPath, "advisories", "", "Path to JSON file, or directory of JSON files, of OSV advisories.")
+	command.StringVar(&exceptionsFile, "exceptions", "", "Path to JSON file of accepted risks. Defaults to "+DefaultExceptionsFile+" alongside the Lockfile, if it exists.")
+	command.StringVar(&failOn, "fail-on", "low", "Least severity of advisories that fails, 'low', 'medium', 'high' or 'critical'.")
+	return func(outfile string) (*Options, error) {
+		if advisoriesPath != "" {
+			if _, err := os.Stat(advisoriesPath); err != nil {
+				return nil, err
+			}
+		}
+		if exceptionsFile != "" {
+			if _, err := os.Stat(exceptionsFile); err != nil {
+				return nil, err
+			}
+		} else {
+			exceptionsFile = ExceptionsFile(outfile)
+		}
+		return &Options{AdvisoriesPath: advisoriesPath, ExceptionsFile: exceptionsFile, FailOn: failOn}, nil
+	}
+}
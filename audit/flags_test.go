@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAdvisoriesFlags(t *testing.T) {
+	f, err := NewFlags([]string{"-advisories", filepath.Join("testdata", "osv"), "-exceptions", filepath.Join("testdata", "exceptions.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Format != "text" {
+		t.Fatalf("Got '%s' format. Expected 'text'.", f.Format)
+	}
+	if f.Outfile != "docker-lock.json" {
+		t.Fatalf("Got '%s' outfile. Expected 'docker-lock.json'.", f.Outfile)
+	}
+	if f.FailOn != "low" {
+		t.Fatalf("Got '%s' fail-on. Expected 'low'.", f.FailOn)
+	}
+	if f.ExceptionsFile != filepath.Join("testdata", "exceptions.json") {
+		t.Fatalf("Got '%s' exceptions file. Expected '%s'.", f.ExceptionsFile, filepath.Join("testdata", "exceptions.json"))
+	}
+}
+
+func TestDefaultExceptionsFile(t *testing.T) {
+	f, err := NewFlags([]string{"-advisories", filepath.Join("testdata", "osv"), "-o", filepath.Join("testdata", "docker-lock.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ExceptionsFile != "" {
+		t.Fatalf("Got '%s' exceptions file. Expected none alongside the Lockfile.", f.ExceptionsFile)
+	}
+}
+
+func TestMissingAdvisories(t *testing.T) {
+	if _, err := NewFlags([]string{}); err == nil {
+		t.Fatal("Missing advisories should fail.")
+	}
+	if _, err := NewFlags([]string{"-advisories", filepath.Join("testdata", "missing.json")}); err == nil {
+		t.Fatal("Missing advisories file should fail.")
+	}
+}
+
+func TestFaultyFormat(t *testing.T) {
+	if _, err := NewFlags([]string{"-advisories", filepath.Join("testdata", "osv"), "-format", "xml"}); err == nil {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
@@ -6,11 +6,18 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/michaelperel/docker-lock/audit"
 	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/lint"
+	"github.com/michaelperel/docker-lock/outdated"
 	"github.com/michaelperel/docker-lock/registry"
+	"github.com/michaelperel/docker-lock/rewrite"
+	"github.com/michaelperel/docker-lock/sign"
 	"github.com/michaelperel/docker-lock/verify"
 )
 
+const version = "v0.1.0"
+
 type metadata struct {
 	SchemaVersion    string
 	Vendor           string
@@ -30,7 +37,7 @@ func main() {
 		os.Exit(0)
 	}
 	if len(os.Args) <= 2 {
-		handleError(errors.New("Expected 'generate' or 'verify' subcommands."))
+		handleError(errors.New("Expected 'generate', 'verify', 'outdated', 'sign', 'lint', 'audit' or 'rewrite' subcommands."))
 	}
 	subCommandIndex := 2
 	switch subCommand := os.Args[subCommandIndex]; subCommand {
@@ -39,31 +46,114 @@ func main() {
 		handleError(err)
 		generator, err := generate.NewGenerator(flags)
 		handleError(err)
-		defaultWrapper := &registry.DockerWrapper{ConfigFile: flags.ConfigFile}
-		wrapperManager := registry.NewWrapperManager(defaultWrapper)
-		wrappers := []registry.Wrapper{&registry.ElasticWrapper{}, &registry.MCRWrapper{}}
-		wrapperManager.Add(wrappers...)
+		wrapperManager, err := getWrapperManager(flags.ConfigFile, flags.RegistryConfigFile)
+		handleError(err)
 		handleError(generator.GenerateLockfile(wrapperManager))
 	case "verify":
 		flags, err := verify.NewFlags(os.Args[subCommandIndex+1:])
 		handleError(err)
 		verifier, err := verify.NewVerifier(flags)
 		handleError(err)
-		defaultWrapper := &registry.DockerWrapper{ConfigFile: flags.ConfigFile}
-		wrapperManager := registry.NewWrapperManager(defaultWrapper)
-		wrappers := []registry.Wrapper{&registry.ElasticWrapper{}, &registry.MCRWrapper{}}
-		wrapperManager.Add(wrappers...)
-		handleError(verifier.VerifyLockfile(wrapperManager))
+		wrapperManager, err := getWrapperManager(flags.ConfigFile, flags.RegistryConfigFile)
+		handleError(err)
+		if flags.Format == "text" {
+			handleError(verifier.VerifyLockfile(wrapperManager))
+			break
+		}
+		report, err := verifier.Verify(wrapperManager)
+		handleError(err)
+		handleError(report.Write(os.Stdout, flags.Format))
+		handleError(report.Err())
+	case "outdated":
+		flags, err := outdated.NewFlags(os.Args[subCommandIndex+1:])
+		handleError(err)
+		checker, err := outdated.NewChecker(flags)
+		handleError(err)
+		wrapperManager, err := getWrapperManager(flags.ConfigFile, flags.RegistryConfigFile)
+		handleError(err)
+		report, err := checker.Check(wrapperManager)
+		handleError(err)
+		handleError(report.Write(os.Stdout, flags.Format))
+	case "sign":
+		flags, err := sign.NewFlags(os.Args[subCommandIndex+1:])
+		handleError(err)
+		if flags.GenerateKey {
+			handleError(sign.GenerateKey(flags.KeyFile, flags.PublicKeyFile))
+			break
+		}
+		signer, err := sign.NewSigner(flags)
+		handleError(err)
+		handleError(signer.Sign())
+	case "lint":
+		flags, err := lint.NewFlags(os.Args[subCommandIndex+1:])
+		handleError(err)
+		linter, err := lint.NewLinter(flags)
+		handleError(err)
+		report, err := linter.Lint()
+		handleError(err)
+		handleError(report.Write(os.Stdout, flags.Format))
+		handleError(report.Err())
+	case "audit":
+		flags, err := audit.NewFlags(os.Args[subCommandIndex+1:])
+		handleError(err)
+		report, err := audit.AuditLockfile(flags)
+		handleError(err)
+		handleError(report.Write(os.Stdout, flags.Format))
+		handleError(report.Err())
+	case "rewrite":
+		flags, err := rewrite.NewFlags(os.Args[subCommandIndex+1:])
+		handleError(err)
+		rewriter, err := rewrite.NewRewriter(flags)
+		handleError(err)
+		handleError(rewriter.RewriteFiles())
 	default:
-		handleError(errors.New("Expected 'generate' or 'verify' subcommands."))
+		handleError(errors.New("Expected 'generate', 'verify', 'outdated', 'sign', 'lint', 'audit' or 'rewrite' subcommands."))
+	}
+}
+
+// getWrapperManager adds wrappers for registries declared in the registry
+// config file ahead of the builtin wrappers, so that they take precedence.
+func getWrapperManager(configFile string, registryConfigFile string) (*registry.WrapperManager, error) {
+	registry.UserAgent = "docker-lock/" + version
+	conf := &registry.Config{}
+	if registryConfigFile != "" {
+		var err error
+		if conf, err = registry.LoadConfig(registryConfigFile); err != nil {
+			return nil, err
+		}
+	}
+	client, err := registry.NewHTTPClient(conf.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	defaultWrapper := &registry.DockerWrapper{ConfigFile: configFile, Client: client}
+	wrapperManager := registry.NewWrapperManager(defaultWrapper)
+	if err := wrapperManager.AddConfig(conf); err != nil {
+		return nil, err
+	}
+	wrappers := []registry.Wrapper{&registry.ElasticWrapper{Client: client}, &registry.MCRWrapper{Client: client}}
+	cloudWrappers, err := registry.NewCloudWrappers(client)
+	if err != nil {
+		return nil, err
+	}
+	ghcrWrapper, err := registry.NewGHCRWrapper(client)
+	if err != nil {
+		return nil, err
+	}
+	gitLabWrapper, err := registry.NewGitLabWrapper(client)
+	if err != nil {
+		return nil, err
 	}
+	wrappers = append(wrappers, ghcrWrapper, gitLabWrapper)
+	wrapperManager.Add(append(wrappers, cloudWrappers...)...)
+	return wrapperManager, nil
 }
 
 func getMetadata() (string, error) {
 	m := metadata{
 		SchemaVersion:    "0.1.0",
 		Vendor:           "https://github.com/michaelperel/docker-lock",
-		Version:          "v0.1.0",
+		Version:          version,
 		ShortDescription: "Generate and validate lock files for Docker",
 	}
 	var jsonData []byte
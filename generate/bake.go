@@ -0,0 +1,283 @@
+package generate
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+var defaultBakefileNames = []string{
+	"docker-bake.json",
+	"docker-bake.hcl",
+}
+
+// bakeTarget is a target of a bake file, with the attributes of the
+// targets it inherits from.
+type bakeTarget struct {
+	Context          string
+	Dockerfile       string
+	DockerfileInline string
+	Args             map[string]string
+	// Contexts maps named contexts, which FROM instructions refer to, to
+	// their source, such as 'docker-image://alpine:3.12'.
+	Contexts map[string]string
+	// contextRanges maps named contexts to where their source is written,
+	// in the block of the target that sets them, which is a target that it
+	// inherits from if it does not.
+	contextRanges map[string]hcl.Range
+}
+
+func collectBakefiles(fsys fs.FS, opts *Options) ([]string, error) {
+	isDefaultBakefile := func(fpath string) bool {
+		return matchesName(fpath, defaultBakefileNames)
+	}
+	ignorer, err := newIgnorer(fsys, opts.Excludes, opts.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+	return collectFiles(fsys, opts.Bakefiles, opts.BakeRecursive, opts.BakeRecursiveDir, isDefaultBakefile, opts.BakeGlobs, ignorer)
+}
+
+// parseBakefile sends the images of the named contexts of the bake file's
+// targets, and of the targets' Dockerfiles, built with the targets' args.
+func (g *Generator) parseBakefile(fileName string, parsedImageLines chan<- parsedImageLine, wg *sync.WaitGroup) {
+	if wg != nil {
+		defer wg.Done()
+	}
+	targets, err := g.bakeTargets(fileName)
+	if err != nil {
+		parsedImageLines <- parsedImageLine{bakefileName: fileName, err: err}
+		return
+	}
+	targetNames := make([]string, 0, len(targets))
+	for targetName := range targets {
+		targetNames = append(targetNames, targetName)
+	}
+	sort.Strings(targetNames)
+	// Contexts are located in the block of the target that sets them.
+	// Contexts whose source is interpolated have no location.
+	src, err := readFile(g.fsys(), fileName)
+	if err != nil {
+		parsedImageLines <- parsedImageLine{bakefileName: fileName, err: err}
+		return
+	}
+	position := 0
+	for _, targetName := range targetNames {
+		target := targets[targetName]
+		contextNames := make([]string, 0, len(target.Contexts))
+		for contextName := range target.Contexts {
+			contextNames = append(contextNames, contextName)
+		}
+		sort.Strings(contextNames)
+		for _, contextName := range contextNames {
+			source := target.Contexts[contextName]
+			if !strings.HasPrefix(source, "docker-image://") {
+				continue
+			}
+			parsedImageLines <- parsedImageLine{line: strings.TrimPrefix(source, "docker-image://"),
+				bakefileName: fileName,
+				target:       targetName,
+				context:      contextName,
+				position:     position,
+				location:     bakeContextLocation(fileName, src, target.contextRanges[contextName], source).trimPrefix("docker-image://")}
+			position++
+		}
+		dockerfile := target.dockerfilePath(fileName)
+		if dockerfile == "" {
+			continue
+		}
+		dockerfileLines := make(chan parsedImageLine)
+		go func() {
+			g.parseDockerfile(dockerfile, target.Args, "", "", dockerfileLines, nil)
+			close(dockerfileLines)
+		}()
+		for imLine := range dockerfileLines {
+			// 'FROM <name>' uses the named context instead of the image.
+			if _, ok := target.Contexts[imLine.line]; ok && imLine.err == nil {
+				continue
+			}
+			imLine.bakefileName = fileName
+			imLine.target = targetName
+			imLine.position = position
+			parsedImageLines <- imLine
+			position++
+		}
+	}
+}
+
+// bakeDockerfiles returns the Dockerfiles of the bake file's targets.
+func (g *Generator) bakeDockerfiles(fileName string) ([]string, error) {
+	targets, err := g.bakeTargets(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var dockerfiles []string
+	for _, target := range targets {
+		if dockerfile := target.dockerfilePath(fileName); dockerfile != "" {
+			dockerfiles = append(dockerfiles, dockerfile)
+		}
+	}
+	return dockerfiles, nil
+}
+
+// dockerfilePath returns the target's Dockerfile, relative to the bake file.
+// It returns an empty string if the Dockerfile is inline or the context is
+// remote, such as a git repository.
+func (t *bakeTarget) dockerfilePath(fileName string) string {
+	if t.DockerfileInline != "" || strings.Contains(t.Context, "://") || strings.HasPrefix(t.Context, "git@") {
+		return ""
+	}
+	dockerfile := t.Dockerfile
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	if filepath.IsAbs(dockerfile) {
+		return dockerfile
+	}
+	return filepath.Join(filepath.Dir(fileName), t.Context, dockerfile)
+}
+
+// bakeTargets resolves the Generator's BakeTargets, which may be targets
+// or groups, to targets. As in bake, BakeTargets defaults to the 'default'
+// group or target. If there is neither, every target is resolved. Targets
+// that other targets use as a named context, such as 'target:base', are
+// resolved too.
+func (g *Generator) bakeTargets(fileName string) (map[string]*bakeTarget, error) {
+	byt, err := readFile(g.fsys(), fileName)
+	if err != nil {
+		return nil, err
+	}
+	bFile, err := decodeBakefile(fileName, byt, g.getenv)
+	if err != nil {
+		return nil, fmt.Errorf("%s. From file: '%s'.", err, fileName)
+	}
+	r := &bakeResolver{bakeFile: bFile, resolved: make(map[string]*bakeTarget)}
+	names := g.BakeTargets
+	if len(names) == 0 {
+		_, isGroup := r.groups["default"]
+		_, isTarget := r.targets["default"]
+		if isGroup || isTarget {
+			names = []string{"default"}
+		}
+	}
+	if len(names) == 0 {
+		for name := range r.targets {
+			names = append(names, name)
+		}
+	}
+	targets := make(map[string]*bakeTarget)
+	for _, name := range names {
+		if err := r.add(name, targets, make(map[string]bool)); err != nil {
+			return nil, fmt.Errorf("%s. From file: '%s'.", err, fileName)
+		}
+	}
+	return targets, nil
+}
+
+type bakeResolver struct {
+	*bakeFile
+	resolved map[string]*bakeTarget
+}
+
+// add adds the target, or the targets of the group, called name to targets.
+func (r *bakeResolver) add(name string, targets map[string]*bakeTarget, visiting map[string]bool) error {
+	if _, ok := targets[name]; ok {
+		return nil
+	}
+	if visiting[name] {
+		return fmt.Errorf("Cycle in group or target '%s'", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+	if targetNames, ok := r.groups[name]; ok {
+		for _, targetName := range targetNames {
+			if err := r.add(targetName, targets, visiting); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	target, err := r.resolve(name, make(map[string]bool))
+	if err != nil {
+		return err
+	}
+	targets[name] = target
+	for _, source := range target.Contexts {
+		if strings.HasPrefix(source, "target:") {
+			if err := r.add(strings.TrimPrefix(source, "target:"), targets, visiting); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve merges the attributes of the targets that the target called name
+// inherits from with its own.
+func (r *bakeResolver) resolve(name string, visiting map[string]bool) (*bakeTarget, error) {
+	if target, ok := r.resolved[name]; ok {
+		return target, nil
+	}
+	block, ok := r.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown target '%s'", name)
+	}
+	if visiting[name] {
+		return nil, fmt.Errorf("Cycle in inherits of target '%s'", name)
+	}
+	visiting[name] = true
+	target := &bakeTarget{Args: make(map[string]string),
+		Contexts:      make(map[string]string),
+		contextRanges: make(map[string]hcl.Range),
+	}
+	for _, parentName := range block.Inherits {
+		parent, err := r.resolve(parentName, visiting)
+		if err != nil {
+			return nil, err
+		}
+		target.Context = parent.Context
+		target.Dockerfile = parent.Dockerfile
+		target.DockerfileInline = parent.DockerfileInline
+		for key, val := range parent.Args {
+			target.Args[key] = val
+		}
+		for key, val := range parent.Contexts {
+			target.Contexts[key] = val
+			target.contextRanges[key] = parent.contextRanges[key]
+		}
+	}
+	if block.Context != nil {
+		target.Context = *block.Context
+	}
+	if block.Dockerfile != nil {
+		target.Dockerfile = *block.Dockerfile
+	}
+	if block.DockerfileInline != nil {
+		target.DockerfileInline = *block.DockerfileInline
+	}
+	for key, val := range block.Args {
+		target.Args[key] = val
+	}
+	for key, val := range block.Contexts {
+		target.Contexts[key] = val
+		target.contextRanges[key] = block.contextRanges[key]
+	}
+	r.resolved[name] = target
+	return target, nil
+}
+
+// bakeContextLocation locates source where it is written as a named
+// context, at rng, or returns a location with only file if it is not
+// written there as a string without interpolations or escapes.
+func bakeContextLocation(fileName string, src []byte, rng hcl.Range, source string) sourceLocation {
+	start, end := rng.Start.Byte, rng.End.Byte
+	if end > len(src) || end-start != len(source)+2 || src[start] != '"' {
+		return sourceLocation{file: fileName}
+	}
+	return offsetLocation(fileName, src, start+1, source)
+}
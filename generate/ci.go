@@ -0,0 +1,258 @@
+package generate
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// defaultCIfileGlobs are collected if Options.CI is set.
+var defaultCIfileGlobs = []string{
+	".github/workflows/*.{yml,yaml}",
+	".gitlab-ci.yml",
+}
+
+// ciImage is an image written either as a string, or as a map with an
+// 'image' key (GitHub Actions) or a 'name' key (GitLab CI).
+type ciImage string
+
+func (i *ciImage) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*i = ciImage(s)
+		return nil
+	}
+	var m struct {
+		Image string `yaml:"image"`
+		Name  string `yaml:"name"`
+	}
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+	*i = ciImage(m.Image)
+	if m.Image == "" {
+		*i = ciImage(m.Name)
+	}
+	return nil
+}
+
+type githubWorkflow struct {
+	Jobs map[string]struct {
+		Container ciImage            `yaml:"container"`
+		Services  map[string]ciImage `yaml:"services"`
+		Steps     []struct {
+			Uses string `yaml:"uses"`
+		} `yaml:"steps"`
+	} `yaml:"jobs"`
+}
+
+// gitlabJob also holds the global 'image' and 'services' of a GitLab CI
+// file. Top level keys that are not maps, such as 'stages', are not jobs and
+// are ignored.
+type gitlabJob struct {
+	Image    ciImage   `yaml:"image"`
+	Services []ciImage `yaml:"services"`
+}
+
+func (j *gitlabJob) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*j = gitlabJob{}
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	if _, ok := v.(map[interface{}]interface{}); !ok {
+		return nil
+	}
+	var job struct {
+		Image    ciImage   `yaml:"image"`
+		Services []ciImage `yaml:"services"`
+	}
+	if err := unmarshal(&job); err != nil {
+		return err
+	}
+	*j = gitlabJob(job)
+	return nil
+}
+
+type ciImageLine struct {
+	job  string
+	key  string
+	line string
+}
+
+func collectCIfiles(fsys fs.FS, opts *Options) ([]string, error) {
+	globs := opts.CIGlobs
+	if opts.CI {
+		globs = append(append([]string{}, defaultCIfileGlobs...), globs...)
+	}
+	ignorer, err := newIgnorer(fsys, opts.Excludes, opts.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+	return collectFiles(fsys, opts.CIfiles, false, "", nil, globs, ignorer)
+}
+
+// parseCIfile sends the job images of a GitHub Actions workflow or a GitLab
+// CI file. A file with a top level 'jobs' map is a GitHub Actions workflow.
+func (g *Generator) parseCIfile(fileName string, parsedImageLines chan<- parsedImageLine, wg *sync.WaitGroup) {
+	if wg != nil {
+		defer wg.Done()
+	}
+	yamlByt, err := readFile(g.fsys(), fileName)
+	if err != nil {
+		parsedImageLines <- parsedImageLine{cifileName: fileName, err: err}
+		return
+	}
+	var imageLines []ciImageLine
+	var workflow githubWorkflow
+	github := false
+	if err := yaml.Unmarshal(yamlByt, &workflow); err == nil && len(workflow.Jobs) != 0 {
+		imageLines = githubImageLines(&workflow)
+		github = true
+	} else if imageLines, err = gitlabImageLines(yamlByt); err != nil {
+		err = fmt.Errorf("%s. From file: '%s'.", err, fileName)
+		parsedImageLines <- parsedImageLine{cifileName: fileName, err: err}
+		return
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(yamlByt, &doc); err != nil {
+		doc = yamlv3.Node{}
+	}
+	source := newYAMLSource(fileName, yamlByt)
+	position := 0
+	for _, imageLine := range imageLines {
+		// Expressions, such as '${{ matrix.image }}', and variables are only
+		// known when the job runs.
+		if imageLine.line == "" || strings.Contains(imageLine.line, "$") {
+			continue
+		}
+		location := source.location(ciImageLineNode(&doc, github, imageLine)).trimPrefix("docker://")
+		if location.text != imageLine.line {
+			location = sourceLocation{file: fileName}
+		}
+		parsedImageLines <- parsedImageLine{line: imageLine.line,
+			cifileName: fileName,
+			job:        imageLine.job,
+			key:        imageLine.key,
+			position:   position,
+			location:   location}
+		position++
+	}
+}
+
+// ciImageLineNode returns the node of the image of imageLine in doc, or nil
+// if it cannot be found.
+func ciImageLineNode(doc *yamlv3.Node, github bool, imageLine ciImageLine) *yamlv3.Node {
+	key, index := imageLine.key, ""
+	if i := strings.IndexByte(key, '.'); i != -1 {
+		key, index = key[:i], key[i+1:]
+	}
+	var job *yamlv3.Node
+	switch {
+	case github:
+		job = yamlPath(doc, "jobs", imageLine.job)
+	case imageLine.job == "":
+		// The global image and services are at the top level.
+		job = yamlPath(doc)
+	default:
+		job = yamlPath(doc, imageLine.job)
+	}
+	node := yamlPath(job, key)
+	if index == "" {
+		return ciImageNode(node)
+	}
+	if github && key == "services" {
+		return ciImageNode(yamlPath(node, index))
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return nil
+	}
+	if key == "steps" {
+		return yamlPath(yamlItem(node, i), "uses")
+	}
+	return ciImageNode(yamlItem(node, i))
+}
+
+// ciImageNode returns the node of the image of a ciImage, which is written
+// either as a string or as a map with an 'image' or 'name' key.
+func ciImageNode(node *yamlv3.Node) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return node
+	}
+	if image := yamlPath(node, "image"); image != nil && image.Value != "" {
+		return image
+	}
+	return yamlPath(node, "name")
+}
+
+func githubImageLines(workflow *githubWorkflow) []ciImageLine {
+	var imageLines []ciImageLine
+	jobNames := make([]string, 0, len(workflow.Jobs))
+	for jobName := range workflow.Jobs {
+		jobNames = append(jobNames, jobName)
+	}
+	sort.Strings(jobNames)
+	for _, jobName := range jobNames {
+		job := workflow.Jobs[jobName]
+		imageLines = append(imageLines, ciImageLine{job: jobName, key: "container", line: string(job.Container)})
+		serviceNames := make([]string, 0, len(job.Services))
+		for serviceName := range job.Services {
+			serviceNames = append(serviceNames, serviceName)
+		}
+		sort.Strings(serviceNames)
+		for _, serviceName := range serviceNames {
+			imageLines = append(imageLines, ciImageLine{job: jobName,
+				key:  "services." + serviceName,
+				line: string(job.Services[serviceName])})
+		}
+		for i, step := range job.Steps {
+			if strings.HasPrefix(step.Uses, "docker://") {
+				imageLines = append(imageLines, ciImageLine{job: jobName,
+					key:  "steps." + strconv.Itoa(i),
+					line: strings.TrimPrefix(step.Uses, "docker://")})
+			}
+		}
+	}
+	return imageLines
+}
+
+func gitlabImageLines(yamlByt []byte) ([]ciImageLine, error) {
+	var global gitlabJob
+	if err := yaml.Unmarshal(yamlByt, &global); err != nil {
+		return nil, err
+	}
+	jobs := make(map[string]gitlabJob)
+	if err := yaml.Unmarshal(yamlByt, &jobs); err != nil {
+		return nil, err
+	}
+	// The global image and services have no job, so that they are not
+	// confused with those of the 'default' job.
+	delete(jobs, "image")
+	delete(jobs, "services")
+	var imageLines []ciImageLine
+	jobImageLines := func(jobName string, job gitlabJob) {
+		imageLines = append(imageLines, ciImageLine{job: jobName, key: "image", line: string(job.Image)})
+		for i, service := range job.Services {
+			imageLines = append(imageLines, ciImageLine{job: jobName,
+				key:  "services." + strconv.Itoa(i),
+				line: string(service)})
+		}
+	}
+	jobImageLines("", global)
+	jobNames := make([]string, 0, len(jobs))
+	for jobName := range jobs {
+		jobNames = append(jobNames, jobName)
+	}
+	sort.Strings(jobNames)
+	for _, jobName := range jobNames {
+		jobImageLines(jobName, jobs[jobName])
+	}
+	return imageLines, nil
+}
@@ -1,47 +1,103 @@
 package generate
 
 import (
-	"os"
+	"errors"
+	"io/fs"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
-func collectDockerfiles(flags *Flags) ([]string, error) {
+var defaultDockerfileNames = []string{
+	"Dockerfile",
+	"Dockerfile.*",
+	"*.Dockerfile",
+	"Containerfile",
+	"Containerfile.*",
+	"*.Containerfile",
+}
+
+var defaultComposefileNames = []string{
+	"docker-compose.yml",
+	"docker-compose.yaml",
+	"docker-compose.*.yml",
+	"docker-compose.*.yaml",
+	"compose.yml",
+	"compose.yaml",
+	"compose.*.yml",
+	"compose.*.yaml",
+}
+
+func collectDockerfiles(fsys fs.FS, opts *Options) ([]string, error) {
 	isDefaultDockerfile := func(fpath string) bool {
-		return filepath.Base(fpath) == "Dockerfile"
+		// Dockerfile specific ignore files, such as Dockerfile.dockerignore,
+		// match the same patterns as Dockerfiles.
+		if strings.HasSuffix(fpath, ".dockerignore") {
+			return false
+		}
+		if len(opts.DockerfileNames) == 0 {
+			return matchesName(fpath, defaultDockerfileNames)
+		}
+		return matchesName(fpath, opts.DockerfileNames)
 	}
-	return collectFiles(flags.Dockerfiles, flags.Recursive, flags.RecursiveDir, isDefaultDockerfile, flags.Globs)
+	ignorer, err := newIgnorer(fsys, opts.Excludes, opts.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+	return collectFiles(fsys, opts.Dockerfiles, opts.Recursive, opts.RecursiveDir, isDefaultDockerfile, opts.Globs, ignorer)
 }
 
-func collectComposefiles(flags *Flags) ([]string, error) {
+func collectComposefiles(fsys fs.FS, opts *Options) ([]string, error) {
 	isDefaultComposefile := func(fpath string) bool {
-		return filepath.Base(fpath) == "docker-compose.yml" || filepath.Base(fpath) == "docker-compose.yaml"
+		if len(opts.ComposefileNames) == 0 {
+			return matchesName(fpath, defaultComposefileNames)
+		}
+		return matchesName(fpath, opts.ComposefileNames)
 	}
-	return collectFiles(flags.Composefiles, flags.ComposeRecursive, flags.ComposeRecursiveDir, isDefaultComposefile, flags.ComposeGlobs)
+	ignorer, err := newIgnorer(fsys, opts.Excludes, opts.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+	return collectFiles(fsys, opts.Composefiles, opts.ComposeRecursive, opts.ComposeRecursiveDir, isDefaultComposefile, opts.ComposeGlobs, ignorer)
 }
 
-func collectFiles(files []string, recursive bool, recursiveStartDir string, isDefaultName func(string) bool, globs []string) ([]string, error) {
+func collectFiles(fsys fs.FS, files []string, recursive bool, recursiveStartDir string, isDefaultName func(string) bool, globs []string, ignorer *ignorer) ([]string, error) {
 	fileSet := make(map[string]bool)
 	for _, fileName := range files {
-		fileSet[fileName] = true
+		fileSet[filepath.Clean(fileName)] = true
 	}
 	if recursive {
-		filepath.Walk(recursiveStartDir, func(path string, info os.FileInfo, err error) error {
+		if recursiveStartDir == "" {
+			recursiveStartDir = "."
+		}
+		err := walkFiles(fsys, recursiveStartDir, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			if isDefaultName(filepath.Base(path)) {
+			if d.IsDir() {
+				if skipDir(path, recursiveStartDir) || ignorer.ignored(path, true) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isDefaultName(filepath.Base(path)) && !ignorer.ignored(path, false) {
 				fileSet[path] = true
 			}
 			return nil
 		})
+		if err != nil {
+			return nil, err
+		}
 	}
 	for _, pattern := range globs {
-		matches, err := filepath.Glob(pattern)
+		matches, err := glob(fsys, pattern)
 		if err != nil {
 			return nil, err
 		}
 		for _, match := range matches {
-			fileSet[match] = true
+			if !ignorer.ignored(match, false) {
+				fileSet[match] = true
+			}
 		}
 	}
 	collectedFiles := make([]string, len(fileSet))
@@ -50,5 +106,126 @@ func collectFiles(files []string, recursive bool, recursiveStartDir string, isDe
 		collectedFiles[i] = file
 		i++
 	}
+	sort.Strings(collectedFiles)
 	return collectedFiles, nil
 }
+
+func matchesName(fpath string, patterns []string) bool {
+	base := filepath.Base(fpath)
+	for _, pattern := range patterns {
+		if ok, err := filepath.Match(pattern, base); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterGitFiles keeps the generator's files that git tracks, if gitTracked
+// is set, and files that changed since changedSince, if it is not empty.
+// A docker-compose or bake file has also changed if a Dockerfile referenced
+// by one of its services or targets changed.
+func (g *Generator) FilterGitFiles(gitTracked bool, changedSince string) error {
+	if !gitTracked && changedSince == "" {
+		return nil
+	}
+	if !isHostFS(g.fsys()) {
+		return errors.New("Git aware collection requires the host file system.")
+	}
+	repo, err := newGitRepo()
+	if err != nil {
+		return err
+	}
+	var trackedFiles, changedFiles map[string]bool
+	if gitTracked {
+		if trackedFiles, err = repo.trackedFiles(); err != nil {
+			return err
+		}
+	}
+	if changedSince != "" {
+		if changedFiles, err = repo.changedFiles(changedSince); err != nil {
+			return err
+		}
+	}
+	keep := func(fpath string, referencedFiles []string) (bool, error) {
+		if trackedFiles != nil {
+			tracked, err := repo.contains(trackedFiles, fpath)
+			if err != nil || !tracked {
+				return false, err
+			}
+		}
+		if changedFiles == nil {
+			return true, nil
+		}
+		for _, fpath := range append([]string{fpath}, referencedFiles...) {
+			changed, err := repo.contains(changedFiles, fpath)
+			if err != nil || changed {
+				return changed, err
+			}
+		}
+		return false, nil
+	}
+	var keptDockerfiles, keptComposefiles, keptKubernetesfiles, keptCIfiles, keptBakefiles []string
+	for _, dockerfile := range g.Dockerfiles {
+		ok, err := keep(dockerfile, nil)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keptDockerfiles = append(keptDockerfiles, dockerfile)
+		}
+	}
+	for _, composefile := range g.Composefiles {
+		var referencedDockerfiles []string
+		if changedFiles != nil {
+			if referencedDockerfiles, err = g.composeDockerfiles(composefile); err != nil {
+				return err
+			}
+		}
+		ok, err := keep(composefile, referencedDockerfiles)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keptComposefiles = append(keptComposefiles, composefile)
+		}
+	}
+	for _, kubernetesfile := range g.Kubernetesfiles {
+		ok, err := keep(kubernetesfile, nil)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keptKubernetesfiles = append(keptKubernetesfiles, kubernetesfile)
+		}
+	}
+	for _, cifile := range g.CIfiles {
+		ok, err := keep(cifile, nil)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keptCIfiles = append(keptCIfiles, cifile)
+		}
+	}
+	for _, bakefile := range g.Bakefiles {
+		var referencedDockerfiles []string
+		if changedFiles != nil {
+			if referencedDockerfiles, err = g.bakeDockerfiles(bakefile); err != nil {
+				return err
+			}
+		}
+		ok, err := keep(bakefile, referencedDockerfiles)
+		if err != nil {
+			return err
+		}
+		if ok {
+			keptBakefiles = append(keptBakefiles, bakefile)
+		}
+	}
+	g.Dockerfiles = keptDockerfiles
+	g.Composefiles = keptComposefiles
+	g.Kubernetesfiles = keptKubernetesfiles
+	g.CIfiles = keptCIfiles
+	g.Bakefiles = keptBakefiles
+	return nil
+}
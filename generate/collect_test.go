@@ -1,8 +1,11 @@
 package generate
 
 import (
+	"os"
 	"path/filepath"
+	"sort"
 	"testing"
+	"testing/fstest"
 )
 
 func TestCollectDockerfilesDefault(t *testing.T) {
@@ -10,7 +13,7 @@ func TestCollectDockerfilesDefault(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	files, err := collectDockerfiles(f)
+	files, err := collectDockerfiles(hostFS{}, &f.Options)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -25,7 +28,7 @@ func TestCollectDockerfilesDuplicate(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	files, err := collectDockerfiles(f)
+	files, err := collectDockerfiles(hostFS{}, &f.Options)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -47,7 +50,7 @@ func TestCollectDockerfilesMultiple(t *testing.T) {
 		dockerfile1: false,
 		dockerfile2: false,
 	}
-	resultFiles, err := collectDockerfiles(f)
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -72,7 +75,7 @@ func TestCollectDockerfilesRecursive(t *testing.T) {
 		filepath.Join(collectDir, "Dockerfile"):              false,
 		filepath.Join(collectDir, "recursive", "Dockerfile"): false,
 	}
-	resultFiles, err := collectDockerfiles(f)
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
 	if len(resultFiles) != len(expectedFiles) {
 		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
 	}
@@ -92,9 +95,10 @@ func TestCollectDockerfilesGlobs(t *testing.T) {
 		t.Fatal(err)
 	}
 	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile"):              false,
 		filepath.Join(collectDir, "recursive", "Dockerfile"): false,
 	}
-	resultFiles, err := collectDockerfiles(f)
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
 	if len(resultFiles) != len(expectedFiles) {
 		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
 	}
@@ -118,7 +122,7 @@ func TestCollectDockerfilesMultipleGlobs(t *testing.T) {
 		filepath.Join(collectDir, "Dockerfile"):              false,
 		filepath.Join(collectDir, "recursive", "Dockerfile"): false,
 	}
-	resultFiles, err := collectDockerfiles(f)
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
 	if len(resultFiles) != len(expectedFiles) {
 		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
 	}
@@ -134,7 +138,7 @@ func TestCollectComposefilesDefault(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	files, err := collectComposefiles(f)
+	files, err := collectComposefiles(hostFS{}, &f.Options)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -149,7 +153,7 @@ func TestCollectComposefilesDuplicate(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	files, err := collectComposefiles(f)
+	files, err := collectComposefiles(hostFS{}, &f.Options)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -171,7 +175,7 @@ func TestCollectComposefilesMultiple(t *testing.T) {
 		composefile1: false,
 		composefile2: false,
 	}
-	resultFiles, err := collectComposefiles(f)
+	resultFiles, err := collectComposefiles(hostFS{}, &f.Options)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -196,7 +200,7 @@ func TestCollectComposefilesRecursive(t *testing.T) {
 		filepath.Join(collectDir, "docker-compose.yml"):               false,
 		filepath.Join(collectDir, "recursive", "docker-compose.yaml"): false,
 	}
-	resultFiles, err := collectComposefiles(f)
+	resultFiles, err := collectComposefiles(hostFS{}, &f.Options)
 	if len(resultFiles) != len(expectedFiles) {
 		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
 	}
@@ -218,7 +222,7 @@ func TestCollectComposefileGlobs(t *testing.T) {
 	expectedFiles := map[string]bool{
 		filepath.Join(collectDir, "recursive", "docker-compose.yaml"): false,
 	}
-	resultFiles, err := collectComposefiles(f)
+	resultFiles, err := collectComposefiles(hostFS{}, &f.Options)
 	if len(resultFiles) != len(expectedFiles) {
 		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
 	}
@@ -242,7 +246,175 @@ func TestCollectComposefilesMultipleGlobs(t *testing.T) {
 		filepath.Join(collectDir, "docker-compose.yml"):               false,
 		filepath.Join(collectDir, "recursive", "docker-compose.yaml"): false,
 	}
-	resultFiles, err := collectComposefiles(f)
+	resultFiles, err := collectComposefiles(hostFS{}, &f.Options)
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesSkipHidden(t *testing.T) {
+	collectDir := filepath.Join("testdata", "exclude")
+	args := []string{"-r", "-rd", collectDir}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile"):                        false,
+		filepath.Join(collectDir, "keep", "Dockerfile"):                false,
+		filepath.Join(collectDir, "node_modules", "pkg", "Dockerfile"): false,
+		filepath.Join(collectDir, "vendor", "Dockerfile"):              false,
+	}
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesExclude(t *testing.T) {
+	collectDir := filepath.Join("testdata", "exclude")
+	args := []string{"-r", "-rd", collectDir, "-exclude", "node_modules/", "-exclude", "testdata/exclude/vendor"}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile"):         false,
+		filepath.Join(collectDir, "keep", "Dockerfile"): false,
+	}
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesIgnoreFile(t *testing.T) {
+	collectDir := filepath.Join("testdata", "exclude")
+	ignoreFile := filepath.Join(collectDir, ".docker-lock-ignore")
+	args := []string{"-r", "-rd", collectDir, "-ignore-file", ignoreFile}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile"):                        false,
+		filepath.Join(collectDir, "keep", "Dockerfile"):                false,
+		filepath.Join(collectDir, "node_modules", "pkg", "Dockerfile"): false,
+	}
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesIgnoreFileWorkingDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(filepath.Join("testdata", "exclude")); err != nil {
+		t.Fatal(err)
+	}
+	for _, collectDir := range []string{".", filepath.Join("..", "exclude")} {
+		ignoreFile := filepath.Join(collectDir, ".docker-lock-ignore")
+		args := []string{"-r", "-rd", collectDir, "-ignore-file", ignoreFile}
+		f, err := NewFlags(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedFiles := map[string]bool{
+			filepath.Join(collectDir, "Dockerfile"):                        false,
+			filepath.Join(collectDir, "keep", "Dockerfile"):                false,
+			filepath.Join(collectDir, "node_modules", "pkg", "Dockerfile"): false,
+		}
+		resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resultFiles) != len(expectedFiles) {
+			t.Fatalf("Got %v. Expected the keys of '%v'.", resultFiles, expectedFiles)
+		}
+		for _, resultFile := range resultFiles {
+			if _, ok := expectedFiles[resultFile]; !ok {
+				t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+			}
+		}
+	}
+}
+
+func TestCollectComposefilesExclude(t *testing.T) {
+	collectDir := filepath.Join("testdata", "exclude")
+	globPattern := filepath.Join(collectDir, "*", "*", "docker-compose.yml")
+	args := []string{"-cr", "-crd", collectDir, "-cg", globPattern, "-exclude", "node_modules"}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "docker-compose.yml"): false,
+	}
+	resultFiles, err := collectComposefiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesDefaultNames(t *testing.T) {
+	collectDir := filepath.Join("testdata", "names")
+	args := []string{"-r", "-rd", collectDir}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile"):               false,
+		filepath.Join(collectDir, "Dockerfile.prod"):          false,
+		filepath.Join(collectDir, "api.Dockerfile"):           false,
+		filepath.Join(collectDir, "Containerfile"):            false,
+		filepath.Join(collectDir, "nested", "Dockerfile.dev"): false,
+	}
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(resultFiles) != len(expectedFiles) {
 		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
 	}
@@ -252,3 +424,216 @@ func TestCollectComposefilesMultipleGlobs(t *testing.T) {
 		}
 	}
 }
+
+func TestCollectDockerfilesCustomNames(t *testing.T) {
+	collectDir := filepath.Join("testdata", "names")
+	args := []string{"-r", "-rd", collectDir, "-rn", "Dockerfile.*"}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile.prod"):          false,
+		filepath.Join(collectDir, "nested", "Dockerfile.dev"): false,
+	}
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectComposefilesDefaultNames(t *testing.T) {
+	collectDir := filepath.Join("testdata", "names")
+	args := []string{"-cr", "-crd", collectDir}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "compose.yaml"):                false,
+		filepath.Join(collectDir, "docker-compose.override.yml"): false,
+		filepath.Join(collectDir, "nested", "compose.yml"):       false,
+	}
+	resultFiles, err := collectComposefiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectComposefilesCustomNames(t *testing.T) {
+	collectDir := filepath.Join("testdata", "names")
+	args := []string{"-cr", "-crd", collectDir, "-crn", "compose.yaml", "-crn", "compose.yml"}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "compose.yaml"):          false,
+		filepath.Join(collectDir, "nested", "compose.yml"): false,
+	}
+	resultFiles, err := collectComposefiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesBraceGlobs(t *testing.T) {
+	collectDir := filepath.Join("testdata", "names")
+	globPattern := filepath.Join(collectDir, "**", "Dockerfile.{prod,dev}")
+	args := []string{"-g", globPattern}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile.prod"):          false,
+		filepath.Join(collectDir, "nested", "Dockerfile.dev"): false,
+	}
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesGlobsSkipHidden(t *testing.T) {
+	collectDir := filepath.Join("testdata", "exclude")
+	globPattern := filepath.Join(collectDir, "**", "Dockerfile")
+	args := []string{"-g", globPattern, "-g", filepath.Join(collectDir, ".hidden", "**", "Dockerfile")}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "Dockerfile"):                        false,
+		filepath.Join(collectDir, ".hidden", "Dockerfile"):             false,
+		filepath.Join(collectDir, "keep", "Dockerfile"):                false,
+		filepath.Join(collectDir, "node_modules", "pkg", "Dockerfile"): false,
+		filepath.Join(collectDir, "vendor", "Dockerfile"):              false,
+	}
+	resultFiles, err := collectDockerfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectDockerfilesFaultyGlob(t *testing.T) {
+	args := []string{"-g", "Dockerfile.{dev"}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collectDockerfiles(hostFS{}, &f.Options); err == nil {
+		t.Fatal("Unbalanced braces should fail.")
+	}
+}
+
+func TestCollectDockerfilesWalkError(t *testing.T) {
+	args := []string{"-r", "-rd", filepath.Join("testdata", "collect", "missing")}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collectDockerfiles(hostFS{}, &f.Options); err == nil {
+		t.Fatal("Walk errors should be reported.")
+	}
+}
+
+func TestCollectKubernetesfilesRecursive(t *testing.T) {
+	collectDir := filepath.Join("testdata", "kubernetes")
+	args := []string{"-kr", "-krd", collectDir}
+	f, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := map[string]bool{
+		filepath.Join(collectDir, "deployment.yaml"):               false,
+		filepath.Join(collectDir, "charts", "web", "rendered.yml"): false,
+	}
+	resultFiles, err := collectKubernetesfiles(hostFS{}, &f.Options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %d files. Expected %d.", len(resultFiles), len(expectedFiles))
+	}
+	for _, resultFile := range resultFiles {
+		if _, ok := expectedFiles[resultFile]; !ok {
+			t.Fatalf("Got '%s'. Expected file to be a key in the map '%v'.", resultFile, expectedFiles)
+		}
+	}
+}
+
+func TestCollectCIfilesDefault(t *testing.T) {
+	fsys := fstest.MapFS{
+		".github/workflows/build.yml":   {Data: []byte("jobs: {}\n")},
+		".github/workflows/deploy.yaml": {Data: []byte("jobs: {}\n")},
+		".github/dependabot.yml":        {Data: []byte("version: 2\n")},
+		".gitlab-ci.yml":                {Data: []byte("image: ruby\n")},
+		"docker-compose.yml":            {Data: []byte("services: {}\n")},
+	}
+	expectedFiles := []string{
+		".github/workflows/build.yml",
+		".github/workflows/deploy.yaml",
+		".gitlab-ci.yml",
+	}
+	resultFiles, err := collectCIfiles(fsys, &Options{CI: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(resultFiles)
+	if len(resultFiles) != len(expectedFiles) {
+		t.Fatalf("Got %v. Expected %v.", resultFiles, expectedFiles)
+	}
+	for i := range expectedFiles {
+		if filepath.ToSlash(resultFiles[i]) != expectedFiles[i] {
+			t.Fatalf("Got '%s'. Expected '%s'.", resultFiles[i], expectedFiles[i])
+		}
+	}
+	resultFiles, err = collectCIfiles(fsys, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resultFiles) != 0 {
+		t.Fatalf("Got %v. Expected no files without the CI option.", resultFiles)
+	}
+}
@@ -0,0 +1,47 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/michaelperel/docker-lock/registry"
+	"github.com/michaelperel/docker-lock/semver"
+)
+
+// LoadConstraints reads a constraints file, which maps image names to
+// semver constraints, such as '{"node": "^12"}'.
+func LoadConstraints(fpath string) (map[string]string, error) {
+	constraintsByt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var constraints map[string]string
+	if err := json.Unmarshal(constraintsByt, &constraints); err != nil {
+		return nil, fmt.Errorf("%s. From constraints file: '%s'.", err, fpath)
+	}
+	for name, constraint := range constraints {
+		if _, err := semver.NewConstraint(constraint); err != nil {
+			return nil, fmt.Errorf("%s From image: '%s'. From constraints file: '%s'.", err, name, fpath)
+		}
+	}
+	return constraints, nil
+}
+
+// resolveConstraint returns the newest tag of name that satisfies
+// constraint.
+func resolveConstraint(wrapper registry.Wrapper, name string, constraint string) (string, error) {
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	tags, err := wrapper.GetTags(name)
+	if err != nil {
+		return "", err
+	}
+	tag, ok := c.Newest(tags)
+	if !ok {
+		return "", fmt.Errorf("No tag of '%s' matches constraint '%s'", name, constraint)
+	}
+	return tag, nil
+}
@@ -19,29 +19,90 @@ func (s *stringSliceFlag) Set(filePath string) error {
 	return nil
 }
 
-type Flags struct {
+type Options struct {
 	Dockerfiles         []string
 	Composefiles        []string
+	Kubernetesfiles     []string
 	Globs               []string
 	ComposeGlobs        []string
 	Recursive           bool
 	RecursiveDir        string
 	ComposeRecursive    bool
 	ComposeRecursiveDir string
-	Outfile             string
-	ConfigFile          string
-	EnvFile             string
+	// KubernetesRecursive collects every YAML file that is not a
+	// docker-compose file, unless KubernetesfileNames is set.
+	KubernetesRecursive    bool
+	KubernetesRecursiveDir string
+	KubernetesGlobs        []string
+	DockerfileNames        []string
+	ComposefileNames       []string
+	KubernetesfileNames    []string
+	CIfiles                []string
+	CIGlobs                []string
+	// CI collects GitHub Actions workflows in .github/workflows and
+	// .gitlab-ci.yml.
+	CI               bool
+	Bakefiles        []string
+	BakeGlobs        []string
+	BakeRecursive    bool
+	BakeRecursiveDir string
+	// BakeTargets are the targets, or groups, of bake files to lock. If
+	// empty, the 'default' group or target is locked, or else every target.
+	BakeTargets  []string
+	Excludes     []string
+	IgnoreFile   string
+	GitTracked   bool
+	ChangedSince string
+	// Env holds the variables substituted in Dockerfiles and docker-compose
+	// files. If nil, the process environment is used.
+	Env map[string]string
+	// Constraints maps image names to semver constraints, such as '^12'.
+	Constraints map[string]string
+}
+
+type Flags struct {
+	Options
+	Outfile            string
+	ConfigFile         string
+	EnvFile            string
+	RegistryConfigFile string
+	ConstraintsFile    string
+	// LockfileFormat is the name of the Lockfile's format, such as 'yaml'.
+	// If empty, the format is chosen by Outfile's extension.
+	LockfileFormat string
 }
 
 func NewFlags(cmdLineArgs []string) (*Flags, error) {
-	var dockerfiles, composefiles stringSliceFlag
-	var globs, composeGlobs stringSliceFlag
-	var recursive, composeRecursive bool
-	var recursiveDir, composeRecursiveDir string
+	command := flag.NewFlagSet("generate", flag.ExitOnError)
+	flags := AddFlags(command)
+	command.Parse(cmdLineArgs)
+	return flags()
+}
+
+// AddFlags adds generate's flags to command, so that other commands, such
+// as lint, collect files as generate does. The returned function builds the
+// Flags once command has been parsed.
+func AddFlags(command *flag.FlagSet) func() (*Flags, error) {
+	var dockerfiles, composefiles, kubernetesfiles stringSliceFlag
+	var globs, composeGlobs, kubernetesGlobs stringSliceFlag
+	var recursive, composeRecursive, kubernetesRecursive bool
+	var recursiveDir, composeRecursiveDir, kubernetesRecursiveDir string
+	var dockerfileNames, composefileNames, kubernetesfileNames stringSliceFlag
+	var cifiles, ciGlobs stringSliceFlag
+	var ci bool
+	var bakefiles, bakeGlobs, bakeTargets stringSliceFlag
+	var bakeRecursive bool
+	var bakeRecursiveDir string
+	var excludes stringSliceFlag
+	var ignoreFile string
+	var gitTracked bool
+	var changedSince string
 	var outfile string
 	var configFile string
 	var envFile string
-	command := flag.NewFlagSet("generate", flag.ExitOnError)
+	var registryConfigFile string
+	var constraintsFile string
+	var lockfileFormat string
 	command.Var(&dockerfiles, "f", "Path to Dockerfile from current directory.")
 	command.Var(&composefiles, "cf", "Path to docker-compose file from current directory.")
 	command.Var(&globs, "g", "Glob pattern to select Dockerfiles from current directory.")
@@ -50,37 +111,120 @@ func NewFlags(cmdLineArgs []string) (*Flags, error) {
 	command.StringVar(&recursiveDir, "rd", ".", "dir to start recursive walk to collect Dockerfiles.")
 	command.BoolVar(&composeRecursive, "cr", false, "recursively collect docker-compose files from current directory.")
 	command.StringVar(&composeRecursiveDir, "crd", ".", "dir to start recursive walk to collect docker-compose files.")
+	command.Var(&kubernetesfiles, "kf", "Path to Kubernetes manifest from current directory.")
+	command.Var(&kubernetesGlobs, "kg", "Glob pattern to select Kubernetes manifests from current directory.")
+	command.BoolVar(&kubernetesRecursive, "kr", false, "recursively collect Kubernetes manifests from current directory.")
+	command.StringVar(&kubernetesRecursiveDir, "krd", ".", "dir to start recursive walk to collect Kubernetes manifests.")
+	command.Var(&kubernetesfileNames, "krn", "Base name pattern of Kubernetes manifests to collect recursively. Replaces the defaults.")
+	command.Var(&cifiles, "cif", "Path to GitHub Actions workflow or GitLab CI file from current directory.")
+	command.Var(&ciGlobs, "cig", "Glob pattern to select GitHub Actions workflows or GitLab CI files from current directory.")
+	command.BoolVar(&ci, "ci", false, "collect GitHub Actions workflows in .github/workflows and .gitlab-ci.yml.")
+	command.Var(&bakefiles, "bf", "Path to bake file from current directory.")
+	command.Var(&bakeGlobs, "bg", "Glob pattern to select bake files from current directory.")
+	command.BoolVar(&bakeRecursive, "br", false, "recursively collect bake files from current directory.")
+	command.StringVar(&bakeRecursiveDir, "brd", ".", "dir to start recursive walk to collect bake files.")
+	command.Var(&bakeTargets, "bt", "Target or group of bake files to lock. Defaults to the 'default' group, if it exists, or else every target.")
+	command.Var(&dockerfileNames, "rn", "Base name pattern of Dockerfiles to collect recursively. Replaces the defaults.")
+	command.Var(&composefileNames, "crn", "Base name pattern of docker-compose files to collect recursively. Replaces the defaults.")
+	command.Var(&excludes, "exclude", "Glob pattern, with gitignore semantics, of files and dirs to exclude from collection.")
+	command.StringVar(&ignoreFile, "ignore-file", ".docker-lock-ignore", "Path to file of gitignore style patterns to exclude from collection.")
+	command.BoolVar(&gitTracked, "git-tracked", false, "Only collect files tracked by git.")
+	command.StringVar(&changedSince, "changed-since", "", "Only collect files changed since the merge base of the git ref and HEAD.")
 	command.StringVar(&outfile, "o", "docker-lock.json", "Path to save Lockfile from current directory.")
+	command.StringVar(&lockfileFormat, "lockfile-format", "", "Format of the Lockfile, 'json', 'yaml' or 'toml'. Defaults to the format of the Lockfile's extension, or 'json'.")
 	command.StringVar(&configFile, "c", "", "Path to config file for auth credentials.")
 	command.StringVar(&envFile, "e", ".env", "Path to .env file.")
-	command.Parse(cmdLineArgs)
-	if _, err := os.Stat(envFile); err != nil {
-		if envFile != ".env" {
+	command.StringVar(&registryConfigFile, "registry-config", "", "Path to config file declaring registries. Defaults to .docker-lock-registries.json, if it exists.")
+	command.StringVar(&constraintsFile, "constraints", "", "Path to JSON file of semver constraints by image name. Defaults to .docker-lock-constraints.json, if it exists.")
+	return func() (*Flags, error) {
+		for _, pattern := range append(append(dockerfileNames, composefileNames...), kubernetesfileNames...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("Invalid name pattern '%s'. %s.", pattern, err)
+			}
+		}
+		if _, err := GetLockfileFormat(lockfileFormat, outfile); err != nil {
 			return nil, err
 		}
-	} else if err := godotenv.Load(envFile); err != nil {
-		return nil, err
-	}
-	if configFile != "" {
-		if _, err := os.Stat(configFile); err != nil {
+		if len(dockerfileNames) == 0 {
+			dockerfileNames = defaultDockerfileNames
+		}
+		if len(composefileNames) == 0 {
+			composefileNames = defaultComposefileNames
+		}
+		if _, err := os.Stat(envFile); err != nil {
+			if envFile != ".env" {
+				return nil, err
+			}
+		} else if err := godotenv.Load(envFile); err != nil {
 			return nil, err
 		}
-	} else if homeDir, err := os.UserHomeDir(); err == nil {
-		defaultConfig := filepath.Join(homeDir, ".docker", "config.json")
-		if _, err := os.Stat(defaultConfig); err == nil {
-			configFile = defaultConfig
+		if _, err := os.Stat(ignoreFile); err != nil && ignoreFile != ".docker-lock-ignore" {
+			return nil, err
+		}
+		if configFile != "" {
+			if _, err := os.Stat(configFile); err != nil {
+				return nil, err
+			}
+		} else if homeDir, err := os.UserHomeDir(); err == nil {
+			defaultConfig := filepath.Join(homeDir, ".docker", "config.json")
+			if _, err := os.Stat(defaultConfig); err == nil {
+				configFile = defaultConfig
+			}
+		}
+		if registryConfigFile != "" {
+			if _, err := os.Stat(registryConfigFile); err != nil {
+				return nil, err
+			}
+		} else if _, err := os.Stat(".docker-lock-registries.json"); err == nil {
+			registryConfigFile = ".docker-lock-registries.json"
+		}
+		if constraintsFile == "" {
+			if _, err := os.Stat(".docker-lock-constraints.json"); err == nil {
+				constraintsFile = ".docker-lock-constraints.json"
+			}
+		}
+		var constraints map[string]string
+		if constraintsFile != "" {
+			var err error
+			if constraints, err = LoadConstraints(constraintsFile); err != nil {
+				return nil, err
+			}
 		}
+		return &Flags{Options: Options{Dockerfiles: []string(dockerfiles),
+			Composefiles:           []string(composefiles),
+			Globs:                  []string(globs),
+			ComposeGlobs:           []string(composeGlobs),
+			Recursive:              recursive,
+			RecursiveDir:           recursiveDir,
+			ComposeRecursive:       composeRecursive,
+			ComposeRecursiveDir:    composeRecursiveDir,
+			Kubernetesfiles:        []string(kubernetesfiles),
+			KubernetesGlobs:        []string(kubernetesGlobs),
+			KubernetesRecursive:    kubernetesRecursive,
+			KubernetesRecursiveDir: kubernetesRecursiveDir,
+			KubernetesfileNames:    []string(kubernetesfileNames),
+			CIfiles:                []string(cifiles),
+			CIGlobs:                []string(ciGlobs),
+			CI:                     ci,
+			Bakefiles:              []string(bakefiles),
+			BakeGlobs:              []string(bakeGlobs),
+			BakeRecursive:          bakeRecursive,
+			BakeRecursiveDir:       bakeRecursiveDir,
+			BakeTargets:            []string(bakeTargets),
+			DockerfileNames:        []string(dockerfileNames),
+			ComposefileNames:       []string(composefileNames),
+			Excludes:               []string(excludes),
+			IgnoreFile:             ignoreFile,
+			GitTracked:             gitTracked,
+			ChangedSince:           changedSince,
+			Constraints:            constraints,
+		},
+			Outfile:            outfile,
+			ConfigFile:         configFile,
+			EnvFile:            envFile,
+			RegistryConfigFile: registryConfigFile,
+			ConstraintsFile:    constraintsFile,
+			LockfileFormat:     lockfileFormat,
+		}, nil
 	}
-	return &Flags{Dockerfiles: []string(dockerfiles),
-		Composefiles:        []string(composefiles),
-		Globs:               []string(globs),
-		ComposeGlobs:        []string(composeGlobs),
-		Recursive:           recursive,
-		RecursiveDir:        recursiveDir,
-		ComposeRecursive:    composeRecursive,
-		ComposeRecursiveDir: composeRecursiveDir,
-		Outfile:             outfile,
-		ConfigFile:          configFile,
-		EnvFile:             envFile,
-	}, nil
 }
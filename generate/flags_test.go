@@ -36,9 +36,30 @@ func TestDefaults(t *testing.T) {
 	if f.ComposeRecursiveDir != "." {
 		t.Fatalf("Got '%s'. Expected '.'.", f.ComposeRecursiveDir)
 	}
+	if len(f.DockerfileNames) != len(defaultDockerfileNames) {
+		t.Fatalf("Got %d Dockerfile names. Expected %d.", len(f.DockerfileNames), len(defaultDockerfileNames))
+	}
+	if len(f.ComposefileNames) != len(defaultComposefileNames) {
+		t.Fatalf("Got %d docker-compose file names. Expected %d.", len(f.ComposefileNames), len(defaultComposefileNames))
+	}
+	if len(f.Excludes) != 0 {
+		t.Fatalf("Got %d excludes. Expected 0.", len(f.Excludes))
+	}
+	if f.IgnoreFile != ".docker-lock-ignore" {
+		t.Fatalf("Got '%s' ignore file. Expected '.docker-lock-ignore'.", f.IgnoreFile)
+	}
+	if f.GitTracked {
+		t.Fatal("Got true for git tracked. Expected false.")
+	}
+	if f.ChangedSince != "" {
+		t.Fatalf("Got '%s' changed since. Expected ''.", f.ChangedSince)
+	}
 	if f.Outfile != "docker-lock.json" {
 		t.Fatalf("Got '%s' outfile. Expected 'docker-lock.json'.", f.Outfile)
 	}
+	if f.RegistryConfigFile != "" {
+		t.Fatalf("Got '%s' registry config file. Expected ''.", f.RegistryConfigFile)
+	}
 	if f.EnvFile != ".env" {
 		t.Fatalf("Got '%s' env file. Expected .env.", f.EnvFile)
 	}
@@ -96,3 +117,56 @@ func TestFaultyEnvFile(t *testing.T) {
 		t.Fatal("Faulty env file should fail.")
 	}
 }
+
+func TestFaultyIgnoreFile(t *testing.T) {
+	ignoreFile := filepath.Join("testdata", "flags", ".docker-lock-ignore2")
+	args := []string{"-ignore-file", ignoreFile}
+	_, err := NewFlags(args)
+	if err == nil {
+		t.Fatal("Faulty ignore file should fail.")
+	}
+}
+
+func TestFaultyNamePattern(t *testing.T) {
+	args := []string{"-rn", "Dockerfile["}
+	_, err := NewFlags(args)
+	if err == nil {
+		t.Fatal("Faulty name pattern should fail.")
+	}
+}
+
+func TestConstraintsFile(t *testing.T) {
+	constraintsFile := filepath.Join("testdata", "flags", "constraints.json")
+	args := []string{"-constraints", constraintsFile}
+	flags, err := NewFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flags.ConstraintsFile != constraintsFile {
+		t.Fatalf("Got '%s'. Expected '%s'.", flags.ConstraintsFile, constraintsFile)
+	}
+	if flags.Constraints["node"] != "^12" || flags.Constraints["python"] != "~3.7" {
+		t.Fatalf("Got '%v'.", flags.Constraints)
+	}
+}
+
+func TestFaultyConstraintsFile(t *testing.T) {
+	for _, constraintsFile := range []string{"faulty-constraints.json", "missing-constraints.json"} {
+		args := []string{"-constraints", filepath.Join("testdata", "flags", constraintsFile)}
+		if _, err := NewFlags(args); err == nil {
+			t.Fatalf("Constraints file '%s' should fail.", constraintsFile)
+		}
+	}
+}
+
+func TestLockfileFormat(t *testing.T) {
+	if _, err := NewFlags([]string{"-o", "docker-lock.yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFlags([]string{"-lockfile-format", "toml"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFlags([]string{"-lockfile-format", "xml"}); err == nil {
+		t.Fatal("Unknown Lockfile format should fail.")
+	}
+}
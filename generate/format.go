@@ -0,0 +1,144 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// LockfileFormat encodes and decodes Lockfiles. Decoding what Encode
+// returns must produce the same Lockfile, so that verify reads what
+// generate wrote.
+type LockfileFormat interface {
+	Encode(lockfile *Lockfile) ([]byte, error)
+	Decode(byt []byte, lockfile *Lockfile) error
+}
+
+var (
+	lockfileFormatsMu  sync.RWMutex
+	lockfileFormats    = make(map[string]LockfileFormat)
+	lockfileExtensions = make(map[string]string)
+)
+
+func init() {
+	RegisterLockfileFormat("json", jsonFormat{}, ".json")
+	RegisterLockfileFormat("yaml", yamlFormat{}, ".yaml", ".yml")
+	RegisterLockfileFormat("toml", tomlFormat{}, ".toml")
+}
+
+// RegisterLockfileFormat makes format available by name, and for Lockfiles
+// with one of extensions, such as '.json'.
+func RegisterLockfileFormat(name string, format LockfileFormat, extensions ...string) {
+	lockfileFormatsMu.Lock()
+	defer lockfileFormatsMu.Unlock()
+	lockfileFormats[name] = format
+	for _, extension := range extensions {
+		lockfileExtensions[strings.ToLower(extension)] = name
+	}
+}
+
+// GetLockfileFormat returns the format called name. If name is empty, the
+// format is chosen by the extension of the Lockfile's path, fpath,
+// defaulting to JSON.
+func GetLockfileFormat(name string, fpath string) (LockfileFormat, error) {
+	lockfileFormatsMu.RLock()
+	defer lockfileFormatsMu.RUnlock()
+	if name == "" {
+		name = lockfileExtensions[strings.ToLower(filepath.Ext(fpath))]
+		if name == "" {
+			name = "json"
+		}
+	}
+	format, ok := lockfileFormats[name]
+	if !ok {
+		names := make([]string, 0, len(lockfileFormats))
+		for name := range lockfileFormats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown Lockfile format '%s'. Expected one of '%s'.", name, strings.Join(names, "', '"))
+	}
+	return format, nil
+}
+
+// ReadLockfile reads the Lockfile at fpath in the format called formatName,
+// or in the format of its extension if formatName is empty. It fails if the
+// Lockfile's integrity hash does not match its contents.
+func ReadLockfile(fpath string, formatName string) (*Lockfile, error) {
+	format, err := GetLockfileFormat(formatName, fpath)
+	if err != nil {
+		return nil, err
+	}
+	lByt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var lFile Lockfile
+	if err := format.Decode(lByt, &lFile); err != nil {
+		return nil, fmt.Errorf("%s. From Lockfile: '%s'.", err, fpath)
+	}
+	if err := lFile.CheckIntegrity(); err != nil {
+		return nil, fmt.Errorf("%s From Lockfile: '%s'.", err, fpath)
+	}
+	return &lFile, nil
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Encode(lockfile *Lockfile) ([]byte, error) {
+	return lockfile.Bytes()
+}
+
+func (jsonFormat) Decode(byt []byte, lockfile *Lockfile) error {
+	return json.Unmarshal(byt, lockfile)
+}
+
+type yamlFormat struct{}
+
+func (yamlFormat) Encode(lockfile *Lockfile) ([]byte, error) {
+	return yaml.Marshal(lockfile)
+}
+
+func (yamlFormat) Decode(byt []byte, lockfile *Lockfile) error {
+	return yaml.Unmarshal(byt, lockfile)
+}
+
+// tomlFormat converts Lockfiles to TOML through their JSON representation,
+// so that it has the same keys as the JSON format.
+type tomlFormat struct{}
+
+func (tomlFormat) Encode(lockfile *Lockfile) ([]byte, error) {
+	jsonByt, err := json.Marshal(lockfile)
+	if err != nil {
+		return nil, err
+	}
+	var table map[string]interface{}
+	if err := json.Unmarshal(jsonByt, &table); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(table); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (tomlFormat) Decode(byt []byte, lockfile *Lockfile) error {
+	var table map[string]interface{}
+	if err := toml.Unmarshal(byt, &table); err != nil {
+		return err
+	}
+	jsonByt, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonByt, lockfile)
+}
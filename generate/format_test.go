@@ -0,0 +1,130 @@
+package generate
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func testLockfile() *Lockfile {
+	return &Lockfile{
+		DockerfileImages: map[string][]DockerfileImage{
+			"Dockerfile": {
+				{Image: Image{Name: "ubuntu", Tag: "18.04", Digest: "9b1702dcfe32c873a770a32cfd306dd7fc1c4fd134adfb783db68defc8894b3c"}},
+				{Image: Image{Name: "node", Tag: "12", Digest: "abc", Constraint: "^12", ResolvedTag: "12.18.3"}},
+			},
+		},
+		ComposefileImages: map[string][]ComposefileImage{
+			"docker-compose.yml": {
+				{Image: Image{Name: "busybox", Tag: "latest", Digest: "def"}, ServiceName: "web", Dockerfile: "web/Dockerfile"},
+			},
+			"empty/docker-compose.yml": {},
+		},
+		KubernetesfileImages: map[string][]KubernetesfileImage{
+			"k8s/app.yaml": {
+				{Image: Image{Name: "nginx", Tag: "1.19", Digest: "123"}, Kind: "Deployment", ResourceName: "web", ContainerName: "web"},
+			},
+		},
+		CIfileImages: map[string][]CIfileImage{
+			".gitlab-ci.yml": {
+				{Image: Image{Name: "ruby", Tag: "2.6", Digest: "456"}, Job: "test \"unit\"", Key: "image"},
+			},
+		},
+		BakefileImages: map[string][]BakefileImage{
+			"docker-bake.hcl": {
+				{Image: Image{Name: "alpine", Tag: "3.12", Digest: "789"}, Target: "app", Context: "base"},
+			},
+		},
+	}
+}
+
+func TestLockfileFormatRoundTrip(t *testing.T) {
+	lFile := testLockfile()
+	expected, err := lFile.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"json", "yaml", "toml"} {
+		format, err := GetLockfileFormat(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byt, err := format.Encode(lFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Lockfile
+		if err := format.Decode(byt, &decoded); err != nil {
+			t.Fatalf("Failed to decode %s. Err: '%s'. Lockfile:\n%s", name, err, byt)
+		}
+		got, err := decoded.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, expected) {
+			t.Fatalf("Got %s Lockfile:\n%s\nExpected:\n%s", name, got, expected)
+		}
+		reencoded, err := format.Encode(&decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(reencoded, byt) {
+			t.Fatalf("Got %s Lockfile:\n%s\nExpected:\n%s", name, reencoded, byt)
+		}
+	}
+}
+
+func TestGetLockfileFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		fpath    string
+		expected LockfileFormat
+	}{
+		{fpath: "docker-lock.json", expected: jsonFormat{}},
+		{fpath: "docker-lock.yml", expected: yamlFormat{}},
+		{fpath: filepath.Join("dir", "docker-lock.YAML"), expected: yamlFormat{}},
+		{fpath: "docker-lock.toml", expected: tomlFormat{}},
+		{fpath: "docker-lock", expected: jsonFormat{}},
+		{name: "toml", fpath: "docker-lock.json", expected: tomlFormat{}},
+	}
+	for _, test := range tests {
+		format, err := GetLockfileFormat(test.name, test.fpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != test.expected {
+			t.Fatalf("Got %T for '%s'. Expected %T.", format, test.fpath, test.expected)
+		}
+	}
+	if _, err := GetLockfileFormat("xml", ""); err == nil {
+		t.Fatal("Unknown Lockfile format should fail.")
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	src := `# Written by hand.
+dockerfiles = {}
+
+[composefiles]
+
+[[composefiles."docker-compose.yml"]]
+name = 'busybox' # Literal strings are not escaped.
+tag = "latest"
+digest = "abc"
+serviceName = "web"
+dockerfile = ""
+`
+	var lFile Lockfile
+	if err := (tomlFormat{}).Decode([]byte(src), &lFile); err != nil {
+		t.Fatal(err)
+	}
+	cImages := lFile.ComposefileImages["docker-compose.yml"]
+	if len(cImages) != 1 || cImages[0].Name != "busybox" || cImages[0].ServiceName != "web" {
+		t.Fatalf("Got %+v. Expected the 'busybox' image of service 'web'.", cImages)
+	}
+	for _, faulty := range []string{"dockerfiles = ", "dockerfiles = {}\ndockerfiles = {}", "[dockerfiles\n", "a = \"unterminated\n"} {
+		if err := (tomlFormat{}).Decode([]byte(faulty), &Lockfile{}); err == nil {
+			t.Fatalf("Decoding '%s' should fail.", faulty)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package generate
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// hostFS implements fs.FS with the host's file system. Unlike os.DirFS,
+// it does not restrict paths to a root, so paths such as '../Dockerfile'
+// and absolute paths continue to work from the command line.
+type hostFS struct{}
+
+func (hostFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
+func (g *Generator) fsys() fs.FS {
+	if g.FS == nil {
+		return hostFS{}
+	}
+	return g.FS
+}
+
+func isHostFS(fsys fs.FS) bool {
+	_, ok := fsys.(hostFS)
+	return ok
+}
+
+func readFile(fsys fs.FS, fpath string) ([]byte, error) {
+	return fs.ReadFile(fsys, filepath.ToSlash(fpath))
+}
+
+func openFile(fsys fs.FS, fpath string) (fs.File, error) {
+	return fsys.Open(filepath.ToSlash(fpath))
+}
+
+func statFile(fsys fs.FS, fpath string) (fs.FileInfo, error) {
+	return fs.Stat(fsys, filepath.ToSlash(fpath))
+}
+
+// walkFiles walks the file tree rooted at root, calling fn with paths that use
+// the host's path separator.
+func walkFiles(fsys fs.FS, root string, fn func(fpath string, d fs.DirEntry, err error) error) error {
+	return fs.WalkDir(fsys, filepath.ToSlash(root), func(fpath string, d fs.DirEntry, err error) error {
+		return fn(filepath.FromSlash(fpath), d, err)
+	})
+}
+
+func (g *Generator) getenv(key string) string {
+	if g.Env == nil {
+		return os.Getenv(key)
+	}
+	return g.Env[key]
+}
+
+func (g *Generator) expandEnv(s string) string {
+	return os.Expand(s, g.getenv)
+}
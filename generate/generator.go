@@ -3,8 +3,8 @@ package generate
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"sort"
 	"sync"
@@ -13,41 +13,122 @@ import (
 )
 
 type Generator struct {
-	Dockerfiles  []string
-	Composefiles []string
-	outfile      string
+	Dockerfiles     []string
+	Composefiles    []string
+	Kubernetesfiles []string
+	CIfiles         []string
+	Bakefiles       []string
+	// BakeTargets are the targets, or groups, of Bakefiles to lock. If
+	// empty, the 'default' group or target is locked, or else every target.
+	BakeTargets []string
+	// FS is the file system that Dockerfiles and docker-compose files are
+	// read from. If nil, the host's file system is used.
+	FS fs.FS
+	// Env holds the variables substituted in Dockerfiles and docker-compose
+	// files. If nil, the process environment is used.
+	Env map[string]string
+	// Constraints maps image names to semver constraints, such as '^12'.
+	// Images with a constraint are locked to their newest matching tag.
+	Constraints map[string]string
+	// collectedKubernetesfiles are Kubernetesfiles that were collected
+	// recursively or by glob, rather than named explicitly.
+	collectedKubernetesfiles map[string]bool
+	outfile                  string
+	lockfileFormat           LockfileFormat
 }
 
+// Image's Tag is the tag written in the file. If the image has a semver
+// Constraint, ResolvedTag is the newest tag that satisfied it, whose digest
+// is locked.
 type Image struct {
-	Name   string `json:"name"`
-	Tag    string `json:"tag"`
-	Digest string `json:"digest"`
+	Name        string `json:"name" yaml:"name"`
+	Tag         string `json:"tag" yaml:"tag"`
+	Digest      string `json:"digest" yaml:"digest"`
+	Constraint  string `json:"constraint,omitempty" yaml:"constraint,omitempty"`
+	ResolvedTag string `json:"resolvedTag,omitempty" yaml:"resolvedTag,omitempty"`
+}
+
+// LockedTag returns the tag whose digest is locked.
+func (i Image) LockedTag() string {
+	if i.ResolvedTag != "" {
+		return i.ResolvedTag
+	}
+	return i.Tag
 }
 
 type DockerfileImage struct {
-	Image
+	Image    `yaml:",inline"`
 	position int
 }
 
 type ComposefileImage struct {
-	Image
-	ServiceName string `json:"serviceName"`
-	Dockerfile  string `json:"dockerfile"`
+	Image       `yaml:",inline"`
+	ServiceName string `json:"serviceName" yaml:"serviceName"`
+	Dockerfile  string `json:"dockerfile" yaml:"dockerfile"`
 	position    int
 }
 
+// KubernetesfileImage is the image of a container, or init container, in a
+// Kubernetes workload, such as a Deployment.
+type KubernetesfileImage struct {
+	Image         `yaml:",inline"`
+	Kind          string `json:"kind" yaml:"kind"`
+	ResourceName  string `json:"resourceName" yaml:"resourceName"`
+	ContainerName string `json:"containerName" yaml:"containerName"`
+	position      int
+}
+
+// CIfileImage is an image used by a job in a GitHub Actions workflow or a
+// GitLab CI file. Key is where the job uses the image, such as 'container',
+// 'services.redis' or 'steps.2'. The global image and services of a GitLab
+// CI file have no Job.
+type CIfileImage struct {
+	Image    `yaml:",inline"`
+	Job      string `json:"job" yaml:"job"`
+	Key      string `json:"key" yaml:"key"`
+	position int
+}
+
+// BakefileImage is an image of a target in a bake file. It is either the
+// image of a named context, such as 'docker-image://alpine:3.12', or an
+// image in the target's Dockerfile.
+type BakefileImage struct {
+	Image      `yaml:",inline"`
+	Target     string `json:"target" yaml:"target"`
+	Context    string `json:"context,omitempty" yaml:"context,omitempty"`
+	Dockerfile string `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"`
+	position   int
+}
+
+// Lockfile's Integrity is the hash of the rest of the Lockfile, as returned
+// by Hash.
 type Lockfile struct {
-	DockerfileImages  map[string][]DockerfileImage  `json:"dockerfiles"`
-	ComposefileImages map[string][]ComposefileImage `json:"composefiles"`
+	DockerfileImages     map[string][]DockerfileImage     `json:"dockerfiles" yaml:"dockerfiles"`
+	ComposefileImages    map[string][]ComposefileImage    `json:"composefiles" yaml:"composefiles"`
+	KubernetesfileImages map[string][]KubernetesfileImage `json:"kubernetesfiles,omitempty" yaml:"kubernetesfiles,omitempty"`
+	CIfileImages         map[string][]CIfileImage         `json:"cifiles,omitempty" yaml:"cifiles,omitempty"`
+	BakefileImages       map[string][]BakefileImage       `json:"bakefiles,omitempty" yaml:"bakefiles,omitempty"`
+	Integrity            string                           `json:"integrity,omitempty" yaml:"integrity,omitempty"`
 }
 
 type imageResult struct {
-	image           Image
-	dockerfileName  string
-	composefileName string
-	position        int
-	serviceName     string
-	err             error
+	image              Image
+	dockerfileName     string
+	composefileName    string
+	kubernetesfileName string
+	cifileName         string
+	bakefileName       string
+	position           int
+	location           sourceLocation
+	serviceName        string
+	kind               string
+	resourceName       string
+	containerName      string
+	job                string
+	key                string
+	target             string
+	context            string
+	err                error
 }
 
 func (i Image) String() string {
@@ -56,31 +137,84 @@ func (i Image) String() string {
 }
 
 func NewGenerator(flags *Flags) (*Generator, error) {
-	dockerfiles, err := collectDockerfiles(flags)
+	g, err := NewGeneratorFS(nil, flags.Options)
+	if err != nil {
+		return nil, err
+	}
+	g.outfile = flags.Outfile
+	if g.lockfileFormat, err = GetLockfileFormat(flags.LockfileFormat, flags.Outfile); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// NewGeneratorFS collects Dockerfiles and docker-compose files from fsys
+// according to opts. If fsys is nil, the host's file system is used.
+func NewGeneratorFS(fsys fs.FS, opts Options) (*Generator, error) {
+	g := &Generator{FS: fsys, Env: opts.Env, Constraints: opts.Constraints, BakeTargets: opts.BakeTargets}
+	dockerfiles, err := collectDockerfiles(g.fsys(), &opts)
+	if err != nil {
+		return nil, err
+	}
+	composefiles, err := collectComposefiles(g.fsys(), &opts)
+	if err != nil {
+		return nil, err
+	}
+	kubernetesfiles, err := collectKubernetesfiles(g.fsys(), &opts)
+	if err != nil {
+		return nil, err
+	}
+	cifiles, err := collectCIfiles(g.fsys(), &opts)
 	if err != nil {
 		return nil, err
 	}
-	composefiles, err := collectComposefiles(flags)
+	bakefiles, err := collectBakefiles(g.fsys(), &opts)
 	if err != nil {
 		return nil, err
 	}
-	if len(dockerfiles) == 0 && len(composefiles) == 0 {
-		fi, err := os.Stat("Dockerfile")
+	if len(dockerfiles) == 0 && len(composefiles) == 0 && len(kubernetesfiles) == 0 && len(cifiles) == 0 && len(bakefiles) == 0 {
+		fi, err := statFile(g.fsys(), "Dockerfile")
 		if err == nil {
 			if mode := fi.Mode(); mode.IsRegular() {
 				dockerfiles = []string{"Dockerfile"}
 			}
 		}
-		for _, defaultComposefile := range []string{"docker-compose.yml", "docker-compose.yaml"} {
-			fi, err := os.Stat(defaultComposefile)
+		for _, defaultComposefile := range []string{"docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"} {
+			fi, err := statFile(g.fsys(), defaultComposefile)
 			if err == nil {
 				if mode := fi.Mode(); mode.IsRegular() {
 					composefiles = append(composefiles, defaultComposefile)
 				}
 			}
 		}
+		for _, defaultBakefile := range defaultBakefileNames {
+			fi, err := statFile(g.fsys(), defaultBakefile)
+			if err == nil {
+				if mode := fi.Mode(); mode.IsRegular() {
+					bakefiles = append(bakefiles, defaultBakefile)
+				}
+			}
+		}
+	}
+	g.Dockerfiles = dockerfiles
+	g.Composefiles = composefiles
+	g.Kubernetesfiles = kubernetesfiles
+	explicitKubernetesfiles := make(map[string]bool)
+	for _, fpath := range opts.Kubernetesfiles {
+		explicitKubernetesfiles[filepath.Clean(fpath)] = true
 	}
-	return &Generator{Dockerfiles: dockerfiles, Composefiles: composefiles, outfile: flags.Outfile}, nil
+	g.collectedKubernetesfiles = make(map[string]bool)
+	for _, fpath := range kubernetesfiles {
+		if !explicitKubernetesfiles[fpath] {
+			g.collectedKubernetesfiles[fpath] = true
+		}
+	}
+	g.CIfiles = cifiles
+	g.Bakefiles = bakefiles
+	if err := g.FilterGitFiles(opts.GitTracked, opts.ChangedSince); err != nil {
+		return nil, err
+	}
+	return g, nil
 }
 
 func (g *Generator) GenerateLockfile(wrapperManager *registry.WrapperManager) error {
@@ -91,7 +225,22 @@ func (g *Generator) GenerateLockfile(wrapperManager *registry.WrapperManager) er
 	return ioutil.WriteFile(g.outfile, lockfileBytes, 0644)
 }
 
+// GenerateLockfileBytes encodes the Lockfile in the format of the Flags
+// that the Generator was created with, or in JSON.
 func (g *Generator) GenerateLockfileBytes(wrapperManager *registry.WrapperManager) ([]byte, error) {
+	lockfile, err := g.Generate(wrapperManager)
+	if err != nil {
+		return nil, err
+	}
+	if g.lockfileFormat == nil {
+		return lockfile.Bytes()
+	}
+	return g.lockfileFormat.Encode(lockfile)
+}
+
+// Generate resolves the digest of every image in the generator's files.
+// Unlike GenerateLockfile, it does not write the Lockfile.
+func (g *Generator) Generate(wrapperManager *registry.WrapperManager) (*Lockfile, error) {
 	dImages, err := g.getDockerfileImages(wrapperManager)
 	if err != nil {
 		return nil, err
@@ -111,12 +260,52 @@ func (g *Generator) GenerateLockfileBytes(wrapperManager *registry.WrapperManage
 		}
 		cSlashImages[filepath.ToSlash(fileName)] = cImages[fileName]
 	}
-	lockfile := Lockfile{DockerfileImages: dSlashImages, ComposefileImages: cSlashImages}
-	lockfileBytes, err := json.MarshalIndent(lockfile, "", "\t")
+	kImages, err := g.getKubernetesfileImages(wrapperManager)
 	if err != nil {
 		return nil, err
 	}
-	return lockfileBytes, nil
+	kSlashImages := make(map[string][]KubernetesfileImage)
+	for fileName := range kImages {
+		kSlashImages[filepath.ToSlash(fileName)] = kImages[fileName]
+	}
+	ciImages, err := g.getCIfileImages(wrapperManager)
+	if err != nil {
+		return nil, err
+	}
+	ciSlashImages := make(map[string][]CIfileImage)
+	for fileName := range ciImages {
+		ciSlashImages[filepath.ToSlash(fileName)] = ciImages[fileName]
+	}
+	bImages, err := g.getBakefileImages(wrapperManager)
+	if err != nil {
+		return nil, err
+	}
+	bSlashImages := make(map[string][]BakefileImage)
+	for fileName := range bImages {
+		for i := range bImages[fileName] {
+			bImages[fileName][i].Dockerfile = filepath.ToSlash(bImages[fileName][i].Dockerfile)
+		}
+		bSlashImages[filepath.ToSlash(fileName)] = bImages[fileName]
+	}
+	lockfile := &Lockfile{DockerfileImages: dSlashImages,
+		ComposefileImages:    cSlashImages,
+		KubernetesfileImages: kSlashImages,
+		CIfileImages:         ciSlashImages,
+		BakefileImages:       bSlashImages,
+	}
+	if lockfile.Integrity, err = lockfile.Hash(); err != nil {
+		return nil, err
+	}
+	return lockfile, nil
+}
+
+func (l *Lockfile) Bytes() ([]byte, error) {
+	// encoding/json sorts map keys, so identical images produce identical bytes.
+	lockfileBytes, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(lockfileBytes, '\n'), nil
 }
 
 func (g *Generator) getDockerfileImages(wrapperManager *registry.WrapperManager) (map[string][]DockerfileImage, error) {
@@ -124,7 +313,7 @@ func (g *Generator) getDockerfileImages(wrapperManager *registry.WrapperManager)
 	var wg sync.WaitGroup
 	for _, fileName := range g.Dockerfiles {
 		wg.Add(1)
-		go parseDockerfile(fileName, nil, "", "", parsedImageLines, &wg)
+		go g.parseDockerfile(fileName, nil, "", "", parsedImageLines, &wg)
 	}
 	go func() {
 		wg.Wait()
@@ -166,7 +355,7 @@ func (g *Generator) getComposefileImages(wrapperManager *registry.WrapperManager
 	var wg sync.WaitGroup
 	for _, fileName := range g.Composefiles {
 		wg.Add(1)
-		go parseComposefile(fileName, parsedImageLines, &wg)
+		go g.parseComposefile(fileName, parsedImageLines, &wg)
 	}
 	go func() {
 		wg.Wait()
@@ -202,7 +391,7 @@ func (g *Generator) getComposefileImages(wrapperManager *registry.WrapperManager
 		sort.Slice(imageSlice, func(i, j int) bool {
 			if imageSlice[i].ServiceName != imageSlice[j].ServiceName {
 				return imageSlice[i].ServiceName < imageSlice[j].ServiceName
-			} else if imageSlice[i].Dockerfile != imageSlice[i].Dockerfile {
+			} else if imageSlice[i].Dockerfile != imageSlice[j].Dockerfile {
 				return imageSlice[i].Dockerfile < imageSlice[j].Dockerfile
 			} else {
 				return imageSlice[i].position < imageSlice[j].position
@@ -212,11 +401,153 @@ func (g *Generator) getComposefileImages(wrapperManager *registry.WrapperManager
 	return images, nil
 }
 
+func (g *Generator) getKubernetesfileImages(wrapperManager *registry.WrapperManager) (map[string][]KubernetesfileImage, error) {
+	parsedImageLines := make(chan parsedImageLine)
+	var wg sync.WaitGroup
+	for _, fileName := range g.Kubernetesfiles {
+		wg.Add(1)
+		go g.parseKubernetesfile(fileName, parsedImageLines, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(parsedImageLines)
+	}()
+	imageResults := make(chan imageResult)
+	var numImages int
+	for parsedImageLine := range parsedImageLines {
+		if parsedImageLine.err != nil {
+			return nil, parsedImageLine.err
+		}
+		numImages++
+		go g.getImage(parsedImageLine, wrapperManager, imageResults)
+	}
+	images := make(map[string][]KubernetesfileImage)
+	for i := 0; i < numImages; i++ {
+		result := <-imageResults
+		if result.err != nil {
+			return nil, result.err
+		}
+		kImage := KubernetesfileImage{Image: result.image,
+			Kind:          result.kind,
+			ResourceName:  result.resourceName,
+			ContainerName: result.containerName,
+			position:      result.position}
+		images[result.kubernetesfileName] = append(images[result.kubernetesfileName], kImage)
+	}
+	for _, imageSlice := range images {
+		sort.Slice(imageSlice, func(i, j int) bool {
+			return imageSlice[i].position < imageSlice[j].position
+		})
+	}
+	return images, nil
+}
+
+func (g *Generator) getCIfileImages(wrapperManager *registry.WrapperManager) (map[string][]CIfileImage, error) {
+	parsedImageLines := make(chan parsedImageLine)
+	var wg sync.WaitGroup
+	for _, fileName := range g.CIfiles {
+		wg.Add(1)
+		go g.parseCIfile(fileName, parsedImageLines, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(parsedImageLines)
+	}()
+	imageResults := make(chan imageResult)
+	var numImages int
+	for parsedImageLine := range parsedImageLines {
+		if parsedImageLine.err != nil {
+			return nil, parsedImageLine.err
+		}
+		numImages++
+		go g.getImage(parsedImageLine, wrapperManager, imageResults)
+	}
+	images := make(map[string][]CIfileImage)
+	for i := 0; i < numImages; i++ {
+		result := <-imageResults
+		if result.err != nil {
+			return nil, result.err
+		}
+		ciImage := CIfileImage{Image: result.image,
+			Job:      result.job,
+			Key:      result.key,
+			position: result.position}
+		images[result.cifileName] = append(images[result.cifileName], ciImage)
+	}
+	for _, imageSlice := range images {
+		sort.Slice(imageSlice, func(i, j int) bool {
+			return imageSlice[i].position < imageSlice[j].position
+		})
+	}
+	return images, nil
+}
+
+func (g *Generator) getBakefileImages(wrapperManager *registry.WrapperManager) (map[string][]BakefileImage, error) {
+	parsedImageLines := make(chan parsedImageLine)
+	var wg sync.WaitGroup
+	for _, fileName := range g.Bakefiles {
+		wg.Add(1)
+		go g.parseBakefile(fileName, parsedImageLines, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(parsedImageLines)
+	}()
+	imageResults := make(chan imageResult)
+	var numImages int
+	for parsedImageLine := range parsedImageLines {
+		if parsedImageLine.err != nil {
+			return nil, parsedImageLine.err
+		}
+		numImages++
+		go g.getImage(parsedImageLine, wrapperManager, imageResults)
+	}
+	images := make(map[string][]BakefileImage)
+	for i := 0; i < numImages; i++ {
+		result := <-imageResults
+		if result.err != nil {
+			return nil, result.err
+		}
+		bImage := BakefileImage{Image: result.image,
+			Target:     result.target,
+			Context:    result.context,
+			Dockerfile: result.dockerfileName,
+			position:   result.position}
+		images[result.bakefileName] = append(images[result.bakefileName], bImage)
+	}
+	for _, imageSlice := range images {
+		sort.Slice(imageSlice, func(i, j int) bool {
+			return imageSlice[i].position < imageSlice[j].position
+		})
+	}
+	return images, nil
+}
+
 func (g *Generator) getImage(imLine parsedImageLine, wrapperManager *registry.WrapperManager, imageResults chan<- imageResult) {
 	line := imLine.line
+	result := imageResult{position: imLine.position,
+		location:           imLine.location,
+		serviceName:        imLine.serviceName,
+		dockerfileName:     imLine.dockerfileName,
+		composefileName:    imLine.composefileName,
+		kubernetesfileName: imLine.kubernetesfileName,
+		cifileName:         imLine.cifileName,
+		bakefileName:       imLine.bakefileName,
+		kind:               imLine.kind,
+		resourceName:       imLine.resourceName,
+		containerName:      imLine.containerName,
+		job:                imLine.job,
+		key:                imLine.key,
+		target:             imLine.target,
+		context:            imLine.context}
 	tagSeparator := -1
 	digestSeparator := -1
 	for i, c := range line {
+		// A ':' before the last '/' separates a registry's host and port,
+		// as in 'localhost:5000/app', not a tag.
+		if c == '/' {
+			tagSeparator = -1
+		}
 		if c == ':' {
 			tagSeparator = i
 		}
@@ -226,63 +557,55 @@ func (g *Generator) getImage(imLine parsedImageLine, wrapperManager *registry.Wr
 		}
 	}
 	// 4 valid cases
+	switch {
 	// ubuntu:18.04@sha256:9b1702dcfe32c873a770a32cfd306dd7fc1c4fd134adfb783db68defc8894b3c
-	if tagSeparator != -1 && digestSeparator != -1 {
+	case tagSeparator != -1 && digestSeparator != -1:
 		name := line[:tagSeparator]
 		tag := line[tagSeparator+1 : digestSeparator]
 		digest := line[digestSeparator+1+len("sha256:"):]
-		imageResults <- imageResult{image: Image{Name: name, Tag: tag, Digest: digest},
-			position:        imLine.position,
-			serviceName:     imLine.serviceName,
-			dockerfileName:  imLine.dockerfileName,
-			composefileName: imLine.composefileName}
-		return
-	}
-	// ubuntu:18.04
-	if tagSeparator != -1 && digestSeparator == -1 {
-		name := line[:tagSeparator]
-		tag := line[tagSeparator+1:]
-		wrapper := wrapperManager.GetWrapper(name)
-		digest, err := wrapper.GetDigest(name, tag)
-		if err != nil {
-			err := fmt.Errorf("%s. From line: '%s'. From file: '%s'.", err, line, imLine.dockerfileName)
-			imageResults <- imageResult{err: err}
-			return
-		}
-		imageResults <- imageResult{image: Image{Name: name, Tag: tag, Digest: digest},
-			position:        imLine.position,
-			serviceName:     imLine.serviceName,
-			composefileName: imLine.composefileName,
-			dockerfileName:  imLine.dockerfileName}
-		return
-	}
+		result.image = Image{Name: name, Tag: tag, Digest: digest}
 	// ubuntu@sha256:9b1702dcfe32c873a770a32cfd306dd7fc1c4fd134adfb783db68defc8894b3c
-	if tagSeparator == -1 && digestSeparator != -1 {
+	case tagSeparator == -1 && digestSeparator != -1:
 		name := line[:digestSeparator]
 		digest := line[digestSeparator+1+len("sha256:"):]
-		imageResults <- imageResult{image: Image{Name: name, Digest: digest},
-			position:        imLine.position,
-			serviceName:     imLine.serviceName,
-			composefileName: imLine.composefileName,
-			dockerfileName:  imLine.dockerfileName}
-		return
-	}
-	// ubuntu
-	if tagSeparator == -1 && digestSeparator == -1 {
+		result.image = Image{Name: name, Digest: digest}
+	// ubuntu:18.04 and ubuntu
+	default:
 		name := line
 		tag := "latest"
+		if tagSeparator != -1 {
+			name = line[:tagSeparator]
+			tag = line[tagSeparator+1:]
+		}
 		wrapper := wrapperManager.GetWrapper(name)
-		digest, err := wrapper.GetDigest(name, tag)
+		image, err := ResolveImage(wrapper, name, tag, g.Constraints[name])
 		if err != nil {
-			err := fmt.Errorf("%s. From line: '%s'. From file: '%s'.", err, line, imLine.dockerfileName)
+			err := fmt.Errorf("%s. From line: '%s'. From file: '%s'.", err, line, imLine.source())
 			imageResults <- imageResult{err: err}
 			return
 		}
-		imageResults <- imageResult{image: Image{Name: name, Tag: tag, Digest: digest},
-			position:        imLine.position,
-			serviceName:     imLine.serviceName,
-			dockerfileName:  imLine.dockerfileName,
-			composefileName: imLine.composefileName}
-		return
+		result.image = image
+	}
+	imageResults <- result
+}
+
+// ResolveImage gets the digest of name:tag. If constraint is set, the digest
+// of the newest tag that satisfies it is locked instead, and the tag is
+// recorded as the Image's ResolvedTag. The written tag is kept.
+func ResolveImage(wrapper registry.Wrapper, name string, tag string, constraint string) (Image, error) {
+	image := Image{Name: name, Tag: tag, Constraint: constraint}
+	lockedTag := tag
+	if constraint != "" {
+		var err error
+		if lockedTag, err = resolveConstraint(wrapper, name, constraint); err != nil {
+			return Image{}, err
+		}
+		image.ResolvedTag = lockedTag
+	}
+	digest, err := wrapper.GetDigest(name, lockedTag)
+	if err != nil {
+		return Image{}, err
 	}
+	image.Digest = digest
+	return image, nil
 }
@@ -1,12 +1,36 @@
 package generate
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"github.com/michaelperel/docker-lock/registry"
+	"math/rand"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
+type mockWrapper struct {
+	tags map[string][]string
+}
+
+func (w *mockWrapper) GetDigest(name string, tag string) (string, error) {
+	digest := sha256.Sum256([]byte(name + ":" + tag))
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func (w *mockWrapper) GetTags(name string) ([]string, error) {
+	return w.tags[name], nil
+}
+
+func (w *mockWrapper) Prefix() string {
+	return ""
+}
+
 func TestCompose(t *testing.T) {
 	baseDir := filepath.Join("testdata", "generate")
 	envFile := filepath.Join(baseDir, ".env")
@@ -54,3 +78,348 @@ func TestCompose(t *testing.T) {
 		}
 	}
 }
+
+func TestDeterministicLockfile(t *testing.T) {
+	baseDir := filepath.Join("testdata", "generate", "deterministic")
+	dockerfiles := []string{
+		filepath.Join(baseDir, "Dockerfile"),
+		filepath.Join(baseDir, "api", "Dockerfile"),
+		filepath.Join(baseDir, "worker", "Dockerfile"),
+	}
+	composefiles := []string{filepath.Join(baseDir, "docker-compose.yml")}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g := &Generator{Dockerfiles: dockerfiles, Composefiles: composefiles}
+	expectedByt, err := g.GenerateLockfileBytes(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(expectedByt, []byte("}\n")) {
+		t.Fatal("Lockfile should end with a trailing newline.")
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		shuffledDockerfiles := append([]string{}, dockerfiles...)
+		r.Shuffle(len(shuffledDockerfiles), func(i, j int) {
+			shuffledDockerfiles[i], shuffledDockerfiles[j] = shuffledDockerfiles[j], shuffledDockerfiles[i]
+		})
+		g := &Generator{Dockerfiles: shuffledDockerfiles, Composefiles: composefiles}
+		lByt, err := g.GenerateLockfileBytes(wm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(lByt, expectedByt) {
+			t.Fatalf("Got lockfile:\n%s\nExpected lockfile:\n%s", lByt, expectedByt)
+		}
+	}
+	var lFile Lockfile
+	if err := json.Unmarshal(expectedByt, &lFile); err != nil {
+		t.Fatal(err)
+	}
+	services := []string{"admin", "admin", "admin", "cache", "db", "web", "web", "web", "worker", "worker"}
+	cImages := lFile.ComposefileImages[filepath.ToSlash(composefiles[0])]
+	if len(cImages) != len(services) {
+		t.Fatalf("Got %d images. Expected %d.", len(cImages), len(services))
+	}
+	for i, cImage := range cImages {
+		if cImage.ServiceName != services[i] {
+			t.Fatalf("Got service '%s' at index %d. Expected '%s'.", cImage.ServiceName, i, services[i])
+		}
+	}
+	dImages := lFile.DockerfileImages[filepath.ToSlash(dockerfiles[0])]
+	names := []string{"busybox", "ubuntu", "python"}
+	for i, dImage := range dImages {
+		if dImage.Name != names[i] {
+			t.Fatalf("Got image '%s' at index %d. Expected '%s'.", dImage.Name, i, names[i])
+		}
+	}
+}
+
+func TestGenerateFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":         {Data: []byte("FROM alpine:3.10\n")},
+		"web/Dockerfile":     {Data: []byte("FROM node:12\n")},
+		"docker-compose.yml": {Data: []byte("services:\n  web:\n    build: ./web\n  db:\n    image: ${DB_IMAGE}\n")},
+	}
+	env := map[string]string{"DB_IMAGE": "postgres:12"}
+	g, err := NewGeneratorFS(fsys, Options{Env: env})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dImages := lFile.DockerfileImages["Dockerfile"]
+	if len(dImages) != 1 || dImages[0].Name != "alpine" || dImages[0].Tag != "3.10" {
+		t.Fatalf("Got %+v. Expected 'alpine:3.10'.", dImages)
+	}
+	cImages := lFile.ComposefileImages["docker-compose.yml"]
+	if len(cImages) != 2 {
+		t.Fatalf("Got %d images. Expected 2.", len(cImages))
+	}
+	if cImages[0].Name != "postgres" || cImages[0].Tag != "12" {
+		t.Fatalf("Got '%s:%s'. Expected 'postgres:12'.", cImages[0].Name, cImages[0].Tag)
+	}
+	if cImages[1].Name != "node" || cImages[1].Dockerfile != "web/Dockerfile" {
+		t.Fatalf("Got '%s' from '%s'. Expected 'node' from 'web/Dockerfile'.", cImages[1].Name, cImages[1].Dockerfile)
+	}
+	if _, ok := os.LookupEnv("DB_IMAGE"); ok {
+		t.Fatal("Generating from options should not modify the process environment.")
+	}
+}
+
+func TestGenerateRegistryPort(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile": {Data: []byte("FROM localhost:5000/app\nFROM localhost:5000/app:1.0\nFROM localhost:5000/app@sha256:abc\n")},
+	}
+	g, err := NewGeneratorFS(fsys, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(registry.NewWrapperManager(&mockWrapper{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dImages := lFile.DockerfileImages["Dockerfile"]
+	expected := []Image{
+		{Name: "localhost:5000/app", Tag: "latest"},
+		{Name: "localhost:5000/app", Tag: "1.0"},
+		{Name: "localhost:5000/app", Digest: "abc"},
+	}
+	if len(dImages) != len(expected) {
+		t.Fatalf("Got %d images. Expected %d.", len(dImages), len(expected))
+	}
+	for i := range expected {
+		if dImages[i].Name != expected[i].Name || dImages[i].Tag != expected[i].Tag {
+			t.Fatalf("Got '%s' tagged '%s'. Expected '%s' tagged '%s'.", dImages[i].Name, dImages[i].Tag, expected[i].Name, expected[i].Tag)
+		}
+		if expected[i].Digest != "" && dImages[i].Digest != expected[i].Digest {
+			t.Fatalf("Got digest '%s'. Expected '%s'.", dImages[i].Digest, expected[i].Digest)
+		}
+	}
+}
+
+func TestGenerateErrorLocation(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":         {Data: []byte("# base\nFROM  node:12\n")},
+		"docker-compose.yml": {Data: []byte("services:\n  web:\n    image: \"node:12\"\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{tags: map[string][]string{"node": {"12.18.3"}}})
+	tests := []struct {
+		opts     Options
+		expected string
+	}{
+		{Options{Dockerfiles: []string{"Dockerfile"}}, "From file: 'Dockerfile:2:7'."},
+		{Options{Composefiles: []string{"docker-compose.yml"}}, "From file: 'docker-compose.yml:3:13'."},
+	}
+	for _, test := range tests {
+		test.opts.Constraints = map[string]string{"node": "^14"}
+		g, err := NewGeneratorFS(fsys, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.Generate(wm); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("Got '%v'. Expected an error containing '%s'.", err, test.expected)
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":         {Data: []byte("FROM node:12\nFROM python\nFROM ubuntu:18.04\n")},
+		"docker-compose.yml": {Data: []byte("services:\n  web:\n    image: node\n")},
+	}
+	constraints := map[string]string{"node": "^12", "python": "~3.7"}
+	g, err := NewGeneratorFS(fsys, Options{Constraints: constraints})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{tags: map[string][]string{
+		"node":   {"latest", "12", "12.18.3", "12.18.4-alpine", "12.9.0", "14.4.0"},
+		"python": {"3.7.8", "3.8.5", "3.7.10"},
+	}})
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Image{
+		{Name: "node", Tag: "12", Constraint: "^12", ResolvedTag: "12.18.3"},
+		{Name: "python", Tag: "latest", Constraint: "~3.7", ResolvedTag: "3.7.10"},
+		{Name: "ubuntu", Tag: "18.04"},
+	}
+	dImages := lFile.DockerfileImages["Dockerfile"]
+	if len(dImages) != len(expected) {
+		t.Fatalf("Got %d images. Expected %d.", len(dImages), len(expected))
+	}
+	for i, image := range expected {
+		image.Digest, _ = (&mockWrapper{}).GetDigest(image.Name, image.LockedTag())
+		if dImages[i].Image != image {
+			t.Fatalf("Got %+v. Expected %+v.", dImages[i].Image, image)
+		}
+	}
+	if cImage := lFile.ComposefileImages["docker-compose.yml"][0]; cImage.Tag != "latest" || cImage.ResolvedTag != "12.18.3" || cImage.Constraint != "^12" {
+		t.Fatalf("Got %+v. Expected 'node:latest' resolved to '12.18.3' from constraint '^12'.", cImage.Image)
+	}
+	g.Constraints = map[string]string{"node": "^16"}
+	if _, err := g.Generate(wm); err == nil {
+		t.Fatal("Constraint without a matching tag should fail.")
+	}
+}
+
+func TestGenerateKubernetesfiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":   {Data: []byte("FROM alpine:3.10\n")},
+		"k8s/app.yaml": {Data: []byte("kind: Deployment\nmetadata:\n  name: app\nspec:\n  template:\n    spec:\n      initContainers:\n        - name: init\n          image: busybox\n      containers:\n        - name: app\n          image: node:12\n")},
+	}
+	g, err := NewGeneratorFS(fsys, Options{Dockerfiles: []string{"Dockerfile"}, Kubernetesfiles: []string{"k8s/app.yaml"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kImages := lFile.KubernetesfileImages["k8s/app.yaml"]
+	if len(kImages) != 2 {
+		t.Fatalf("Got %d images. Expected 2.", len(kImages))
+	}
+	expected := []KubernetesfileImage{
+		{Image: Image{Name: "busybox", Tag: "latest"}, Kind: "Deployment", ResourceName: "app", ContainerName: "init", position: 0},
+		{Image: Image{Name: "node", Tag: "12"}, Kind: "Deployment", ResourceName: "app", ContainerName: "app", position: 1},
+	}
+	for i := range expected {
+		if kImages[i].Digest == "" {
+			t.Fatalf("Got no digest for '%s'.", kImages[i].Name)
+		}
+		kImages[i].Digest = ""
+		if kImages[i] != expected[i] {
+			t.Fatalf("Got %+v. Expected %+v.", kImages[i], expected[i])
+		}
+	}
+	g, err = NewGeneratorFS(fsys, Options{Dockerfiles: []string{"Dockerfile"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err = g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lByt, err := json.Marshal(lFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(lByt, []byte("kubernetesfiles")) {
+		t.Fatalf("Got '%s'. Expected no kubernetesfiles section.", lByt)
+	}
+}
+
+func TestGenerateKubernetesfilesRecursive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"k8s/app.yaml":                    {Data: []byte("kind: Pod\nmetadata:\n  name: app\nspec:\n  containers:\n    - name: app\n      image: node:12\n")},
+		"chart/templates/deployment.yaml": {Data: []byte("kind: Deployment\nmetadata:\n  name: {{ .Release.Name }}\nspec:\n  template:\n    spec:\n      containers:\n        - name: web\n          image: {{ .Values.image }}\n")},
+		"chart/values.yaml":               {Data: []byte("image: nginx:1.19\nspec: web\n")},
+		".github/dependabot.yml":          {Data: []byte("version: 2\n")},
+		"k8s/multi.yaml":                  {Data: []byte("kind: Pod\nspec: oops\n---\nkind: Deployment\nmetadata:\n  name: web\nspec:\n  template:\n    spec:\n      containers:\n        - name: web\n          image: nginx:1.19\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g, err := NewGeneratorFS(fsys, Options{KubernetesRecursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lFile.KubernetesfileImages) != 2 || len(lFile.KubernetesfileImages["k8s/app.yaml"]) != 1 {
+		t.Fatalf("Got %+v. Expected only the images of 'k8s/app.yaml' and 'k8s/multi.yaml'.", lFile.KubernetesfileImages)
+	}
+	// The malformed Pod is skipped, but not the Deployment next to it.
+	if kImages := lFile.KubernetesfileImages["k8s/multi.yaml"]; len(kImages) != 1 || kImages[0].ResourceName != "web" {
+		t.Fatalf("Got %+v. Expected the image of the 'web' Deployment.", kImages)
+	}
+	for _, fpath := range []string{"chart/templates/deployment.yaml", "chart/values.yaml", "k8s/multi.yaml"} {
+		g, err := NewGeneratorFS(fsys, Options{Kubernetesfiles: []string{fpath}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := g.Generate(wm); err == nil || !strings.Contains(err.Error(), fpath) {
+			t.Fatalf("Got '%v'. Expected explicit file '%s' to fail.", err, fpath)
+		}
+	}
+	g, err = NewGeneratorFS(fsys, Options{Kubernetesfiles: []string{"k8s/multi.yaml"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Generate(wm); err == nil || !strings.Contains(err.Error(), "From document: 1.") {
+		t.Fatalf("Got '%v'. Expected the error to name the malformed document.", err)
+	}
+}
+
+func TestGenerateBakefiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docker-bake.hcl":  {Data: []byte("target \"web\" {\n  context = \"web\"\n  args = { NODE = \"14\" }\n  contexts = { base = \"docker-image://alpine:3.12\" }\n}\n")},
+		"web/Dockerfile":   {Data: []byte("ARG NODE=12\nFROM node:${NODE}\nFROM base\n")},
+		"other/Dockerfile": {Data: []byte("FROM busybox\n")},
+	}
+	g, err := NewGeneratorFS(fsys, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lFile.DockerfileImages) != 0 {
+		t.Fatalf("Got %+v. Expected only the bake file to be collected by default.", lFile.DockerfileImages)
+	}
+	bImages := lFile.BakefileImages["docker-bake.hcl"]
+	expected := []BakefileImage{
+		{Image: Image{Name: "alpine", Tag: "3.12"}, Target: "web", Context: "base", position: 0},
+		{Image: Image{Name: "node", Tag: "14"}, Target: "web", Dockerfile: "web/Dockerfile", position: 1},
+	}
+	if len(bImages) != len(expected) {
+		t.Fatalf("Got %d images. Expected %d.", len(bImages), len(expected))
+	}
+	for i := range expected {
+		if bImages[i].Digest == "" {
+			t.Fatalf("Got no digest for '%s'.", bImages[i].Name)
+		}
+		bImages[i].Digest = ""
+		if bImages[i] != expected[i] {
+			t.Fatalf("Got %+v. Expected %+v.", bImages[i], expected[i])
+		}
+	}
+}
+
+func TestImageLinesBakeTargets(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docker-bake.hcl": {Data: []byte("target \"a\" {\n  context = \"a\"\n}\ntarget \"b\" {\n  context = \"b\"\n  contexts = { base = \"docker-image://alpine:3.12\" }\n}\n")},
+		"a/Dockerfile":    {Data: []byte("FROM ubuntu:18.04\n")},
+		"b/Dockerfile":    {Data: []byte("FROM base\n")},
+	}
+	g, err := NewGeneratorFS(fsys, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(registry.NewWrapperManager(&mockWrapper{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageLines, err := g.ImageLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bImages := lFile.BakefileImages["docker-bake.hcl"]
+	if len(imageLines) != len(bImages) {
+		t.Fatalf("Got %d image lines. Expected %d.", len(imageLines), len(bImages))
+	}
+	for _, imageLine := range imageLines {
+		image := bImages[imageLine.Position].Image
+		if imageLine.Image != image.Name+":"+image.Tag {
+			t.Fatalf("Got '%s' at position %d. Expected '%s:%s'.", imageLine.Image, imageLine.Position, image.Name, image.Tag)
+		}
+	}
+}
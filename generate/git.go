@@ -0,0 +1,83 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+type gitRepo struct {
+	root string
+}
+
+func newGitRepo() (*gitRepo, error) {
+	out, err := runGit("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	return &gitRepo{root: filepath.FromSlash(strings.TrimSpace(out))}, nil
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("Unable to run 'git %s'. %s %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// files returns the set of paths, relative to the root of the repository,
+// listed by a git command that outputs NUL separated paths.
+func (r *gitRepo) files(args ...string) (map[string]bool, error) {
+	out, err := runGit(r.root, args...)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]bool)
+	for _, fpath := range strings.Split(out, "\x00") {
+		if fpath != "" {
+			files[filepath.FromSlash(fpath)] = true
+		}
+	}
+	return files, nil
+}
+
+func (r *gitRepo) trackedFiles() (map[string]bool, error) {
+	return r.files("ls-files", "-z", "--full-name")
+}
+
+// changedFiles returns files that differ between the working tree and the
+// merge base of ref and HEAD, as a PR pipeline would compare against its base
+// branch.
+func (r *gitRepo) changedFiles(ref string) (map[string]bool, error) {
+	out, err := runGit(r.root, "merge-base", ref, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return r.files("diff", "--name-only", "-z", strings.TrimSpace(out))
+}
+
+func (r *gitRepo) relPath(fpath string) (string, error) {
+	absPath, err := filepath.Abs(fpath)
+	if err != nil {
+		return "", err
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(absPath)); err == nil {
+		absPath = filepath.Join(dir, filepath.Base(absPath))
+	}
+	return filepath.Rel(r.root, absPath)
+}
+
+func (r *gitRepo) contains(files map[string]bool, fpath string) (bool, error) {
+	relPath, err := r.relPath(fpath)
+	if err != nil {
+		return false, err
+	}
+	return files[relPath], nil
+}
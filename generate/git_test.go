@@ -0,0 +1,100 @@
+package generate
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFilterGitFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed.")
+	}
+	repoDir, err := ioutil.TempDir("", "docker-lock-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(repoDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	writeFile := func(fpath string, contents string) {
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git := func(args ...string) {
+		args = append([]string{"-c", "user.name=docker-lock", "-c", "user.email=docker-lock@example.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed. %s %s", args, err, out)
+		}
+	}
+	writeFile(filepath.Join("api", "Dockerfile"), "FROM busybox\n")
+	writeFile(filepath.Join("web", "Dockerfile"), "FROM busybox\n")
+	writeFile("docker-compose.yml", "services:\n  web:\n    build: ./web\n")
+	writeFile("compose.yaml", "services:\n  db:\n    image: postgres\n")
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "base")
+	git("tag", "base")
+	writeFile(filepath.Join("web", "Dockerfile"), "FROM ubuntu\n")
+	git("commit", "-q", "-a", "-m", "change web")
+	writeFile(filepath.Join("untracked", "Dockerfile"), "FROM busybox\n")
+	dockerfiles := []string{
+		filepath.Join("api", "Dockerfile"),
+		filepath.Join("untracked", "Dockerfile"),
+		filepath.Join("web", "Dockerfile"),
+	}
+	composefiles := []string{"compose.yaml", "docker-compose.yml"}
+	tests := []struct {
+		gitTracked           bool
+		changedSince         string
+		expectedDockerfiles  []string
+		expectedComposefiles []string
+	}{
+		{false, "", dockerfiles, composefiles},
+		{true, "", []string{filepath.Join("api", "Dockerfile"), filepath.Join("web", "Dockerfile")}, composefiles},
+		{false, "base", []string{filepath.Join("web", "Dockerfile")}, []string{"docker-compose.yml"}},
+		{true, "HEAD", nil, nil},
+	}
+	for _, test := range tests {
+		g := &Generator{Dockerfiles: dockerfiles, Composefiles: composefiles}
+		if err := g.FilterGitFiles(test.gitTracked, test.changedSince); err != nil {
+			t.Fatal(err)
+		}
+		resultDockerfiles, resultComposefiles := g.Dockerfiles, g.Composefiles
+		sort.Strings(resultDockerfiles)
+		sort.Strings(resultComposefiles)
+		if len(resultDockerfiles) != len(test.expectedDockerfiles) {
+			t.Fatalf("Got %v Dockerfiles. Expected %v.", resultDockerfiles, test.expectedDockerfiles)
+		}
+		for i := range resultDockerfiles {
+			if resultDockerfiles[i] != test.expectedDockerfiles[i] {
+				t.Fatalf("Got %v Dockerfiles. Expected %v.", resultDockerfiles, test.expectedDockerfiles)
+			}
+		}
+		if len(resultComposefiles) != len(test.expectedComposefiles) {
+			t.Fatalf("Got %v docker-compose files. Expected %v.", resultComposefiles, test.expectedComposefiles)
+		}
+		for i := range resultComposefiles {
+			if resultComposefiles[i] != test.expectedComposefiles[i] {
+				t.Fatalf("Got %v docker-compose files. Expected %v.", resultComposefiles, test.expectedComposefiles)
+			}
+		}
+	}
+	g := &Generator{Dockerfiles: dockerfiles, Composefiles: composefiles}
+	if err := g.FilterGitFiles(false, "missing-ref"); err == nil {
+		t.Fatal("Unknown git ref should fail.")
+	}
+}
@@ -0,0 +1,181 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// glob extends filepath.Glob with brace expansion, such as
+// 'Dockerfile.{dev,prod}', and '**' segments that match zero or more
+// directories. As in shells, '**' does not descend into hidden directories.
+func glob(fsys fs.FS, pattern string) ([]string, error) {
+	patterns, err := expandBraces(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, pattern := range patterns {
+		m, err := globWalk(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m...)
+	}
+	return matches, nil
+}
+
+func globWalk(fsys fs.FS, pattern string) ([]string, error) {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/")
+	for _, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, err
+		}
+	}
+	var baseSegments []string
+	for _, segment := range segments {
+		if strings.ContainsAny(segment, `*?[\`) {
+			break
+		}
+		baseSegments = append(baseSegments, segment)
+	}
+	baseDir := strings.Join(baseSegments, "/")
+	if baseDir == "" {
+		if len(baseSegments) == 0 {
+			baseDir = "."
+		} else {
+			baseDir = "/"
+		}
+	}
+	baseDir = filepath.FromSlash(baseDir)
+	if _, err := statFile(fsys, baseDir); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	var matches []string
+	err := walkFiles(fsys, baseDir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		fpathSegments := strings.Split(filepath.ToSlash(fpath), "/")
+		if fpath == "." {
+			fpathSegments = nil
+		}
+		if d.IsDir() && fpath != baseDir && !globMatchPrefix(segments, fpathSegments) {
+			return fs.SkipDir
+		}
+		if globMatch(segments, fpathSegments) {
+			matches = append(matches, fpath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s. From glob: '%s'.", err, pattern)
+	}
+	return matches, nil
+}
+
+func globMatch(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if globMatch(pattern[1:], segments) {
+			return true
+		}
+		if len(segments) == 0 || strings.HasPrefix(segments[0], ".") {
+			return false
+		}
+		return globMatch(pattern, segments[1:])
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return globMatch(pattern[1:], segments[1:])
+}
+
+// globMatchPrefix reports whether a directory could contain a match, so that
+// the walk can skip directories that cannot.
+func globMatchPrefix(pattern []string, segments []string) bool {
+	if len(segments) == 0 {
+		return true
+	}
+	if len(pattern) == 0 {
+		return false
+	}
+	if pattern[0] == "**" {
+		if !strings.HasPrefix(segments[0], ".") && globMatchPrefix(pattern, segments[1:]) {
+			return true
+		}
+		return globMatchPrefix(pattern[1:], segments)
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return globMatchPrefix(pattern[1:], segments[1:])
+}
+
+// expandBraces expands 'a{b,c{d,e}}' into 'ab', 'acd' and 'ace'.
+func expandBraces(pattern string) ([]string, error) {
+	start := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("Unbalanced braces in glob '%s'.", pattern)
+			}
+			depth--
+			if depth != 0 {
+				continue
+			}
+			var expanded []string
+			for _, alternative := range splitAlternatives(pattern[start+1 : i]) {
+				subPatterns, err := expandBraces(pattern[:start] + alternative + pattern[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				expanded = append(expanded, subPatterns...)
+			}
+			return expanded, nil
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("Unbalanced braces in glob '%s'.", pattern)
+	}
+	return []string{pattern}, nil
+}
+
+func splitAlternatives(s string) []string {
+	var alternatives []string
+	depth := 0
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(alternatives, s[last:])
+}
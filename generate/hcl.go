@@ -0,0 +1,506 @@
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/ext/userfunc"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// bakeFunctions are the functions that bake files may call, named as in
+// buildx.
+var bakeFunctions = map[string]function.Function{
+	"absolute":               stdlib.AbsoluteFunc,
+	"add":                    stdlib.AddFunc,
+	"and":                    stdlib.AndFunc,
+	"byteslen":               stdlib.BytesLenFunc,
+	"bytesslice":             stdlib.BytesSliceFunc,
+	"can":                    tryfunc.CanFunc,
+	"ceil":                   stdlib.CeilFunc,
+	"chomp":                  stdlib.ChompFunc,
+	"chunklist":              stdlib.ChunklistFunc,
+	"coalesce":               stdlib.CoalesceFunc,
+	"coalescelist":           stdlib.CoalesceListFunc,
+	"compact":                stdlib.CompactFunc,
+	"concat":                 stdlib.ConcatFunc,
+	"contains":               stdlib.ContainsFunc,
+	"csvdecode":              stdlib.CSVDecodeFunc,
+	"distinct":               stdlib.DistinctFunc,
+	"divide":                 stdlib.DivideFunc,
+	"element":                stdlib.ElementFunc,
+	"equal":                  stdlib.EqualFunc,
+	"flatten":                stdlib.FlattenFunc,
+	"floor":                  stdlib.FloorFunc,
+	"format":                 stdlib.FormatFunc,
+	"formatdate":             stdlib.FormatDateFunc,
+	"formatlist":             stdlib.FormatListFunc,
+	"greaterthan":            stdlib.GreaterThanFunc,
+	"greaterthanorequalto":   stdlib.GreaterThanOrEqualToFunc,
+	"hasindex":               stdlib.HasIndexFunc,
+	"indent":                 stdlib.IndentFunc,
+	"index":                  stdlib.IndexFunc,
+	"int":                    stdlib.IntFunc,
+	"join":                   stdlib.JoinFunc,
+	"jsondecode":             stdlib.JSONDecodeFunc,
+	"jsonencode":             stdlib.JSONEncodeFunc,
+	"keys":                   stdlib.KeysFunc,
+	"length":                 stdlib.LengthFunc,
+	"lessthan":               stdlib.LessThanFunc,
+	"lessthanorequalto":      stdlib.LessThanOrEqualToFunc,
+	"log":                    stdlib.LogFunc,
+	"lookup":                 stdlib.LookupFunc,
+	"lower":                  stdlib.LowerFunc,
+	"max":                    stdlib.MaxFunc,
+	"merge":                  stdlib.MergeFunc,
+	"min":                    stdlib.MinFunc,
+	"modulo":                 stdlib.ModuloFunc,
+	"multiply":               stdlib.MultiplyFunc,
+	"negate":                 stdlib.NegateFunc,
+	"not":                    stdlib.NotFunc,
+	"notequal":               stdlib.NotEqualFunc,
+	"or":                     stdlib.OrFunc,
+	"parseint":               stdlib.ParseIntFunc,
+	"pow":                    stdlib.PowFunc,
+	"range":                  stdlib.RangeFunc,
+	"regex":                  stdlib.RegexFunc,
+	"regex_replace":          stdlib.RegexReplaceFunc,
+	"regexall":               stdlib.RegexAllFunc,
+	"replace":                stdlib.ReplaceFunc,
+	"reverse":                stdlib.ReverseFunc,
+	"reverselist":            stdlib.ReverseListFunc,
+	"sethaselement":          stdlib.SetHasElementFunc,
+	"setintersection":        stdlib.SetIntersectionFunc,
+	"setproduct":             stdlib.SetProductFunc,
+	"setsubtract":            stdlib.SetSubtractFunc,
+	"setsymmetricdifference": stdlib.SetSymmetricDifferenceFunc,
+	"setunion":               stdlib.SetUnionFunc,
+	"signum":                 stdlib.SignumFunc,
+	"slice":                  stdlib.SliceFunc,
+	"sort":                   stdlib.SortFunc,
+	"split":                  stdlib.SplitFunc,
+	"strlen":                 stdlib.StrlenFunc,
+	"substr":                 stdlib.SubstrFunc,
+	"subtract":               stdlib.SubtractFunc,
+	"timeadd":                stdlib.TimeAddFunc,
+	"title":                  stdlib.TitleFunc,
+	"trim":                   stdlib.TrimFunc,
+	"trimprefix":             stdlib.TrimPrefixFunc,
+	"trimspace":              stdlib.TrimSpaceFunc,
+	"trimsuffix":             stdlib.TrimSuffixFunc,
+	"try":                    tryfunc.TryFunc,
+	"upper":                  stdlib.UpperFunc,
+	"values":                 stdlib.ValuesFunc,
+	"zipmap":                 stdlib.ZipmapFunc,
+}
+
+var bakeSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "group", LabelNames: []string{"name"}},
+		{Type: "target", LabelNames: []string{"name"}},
+	},
+}
+
+var bakeVariableSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "default"}},
+}
+
+// bakeFile is a bake file whose variables and attributes are evaluated.
+type bakeFile struct {
+	groups  map[string][]string
+	targets map[string]*bakeBlock
+}
+
+// bakeBlock is a target as written in its block, before it is merged with
+// the targets it inherits from. Attributes that are not set are nil.
+type bakeBlock struct {
+	Inherits         []string
+	Context          *string
+	Dockerfile       *string
+	DockerfileInline *string
+	Args             map[string]string
+	Contexts         map[string]string
+	// contextRanges maps named contexts to where their source is written.
+	contextRanges map[string]hcl.Range
+}
+
+// decodeBakefile decodes a bake file written in HCL, or in JSON if its
+// extension is '.json', with HashiCorp's HCL library, as bake does.
+// Variables are overridden by the environment, as read by getenv, and
+// attributes may call functions, including those declared in 'function'
+// blocks, and refer to variables and to other targets' attributes, such as
+// 'target.base.args'.
+func decodeBakefile(fileName string, src []byte, getenv func(string) string) (*bakeFile, error) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if filepath.Ext(fileName) == ".json" {
+		file, diags = json.Parse(src, fileName)
+	} else {
+		file, diags = hclsyntax.ParseConfig(src, fileName, hcl.InitialPos)
+	}
+	if diags.HasErrors() {
+		return nil, bakeError(diags)
+	}
+	e := &bakeEvaluator{getenv: getenv,
+		variables:  make(map[string]hcl.Expression),
+		targets:    make(map[string]hcl.Attributes),
+		varVals:    make(map[string]cty.Value),
+		targetVals: make(map[string]cty.Value),
+		visiting:   make(map[string]bool),
+	}
+	userFunctions, body, diags := userfunc.DecodeUserFunctions(file.Body, "function", e.functionContext)
+	if diags.HasErrors() {
+		return nil, bakeError(diags)
+	}
+	e.functions = make(map[string]function.Function)
+	for name, fn := range bakeFunctions {
+		e.functions[name] = fn
+	}
+	for name, fn := range userFunctions {
+		e.functions[name] = fn
+	}
+	content, _, diags := body.PartialContent(bakeSchema)
+	if diags.HasErrors() {
+		return nil, bakeError(diags)
+	}
+	groups := make(map[string]hcl.Attributes)
+	for _, block := range content.Blocks {
+		name := block.Labels[0]
+		switch block.Type {
+		case "variable":
+			varContent, _, diags := block.Body.PartialContent(bakeVariableSchema)
+			if diags.HasErrors() {
+				return nil, bakeError(diags)
+			}
+			e.variables[name] = nil
+			if attr, ok := varContent.Attributes["default"]; ok {
+				e.variables[name] = attr.Expr
+			}
+		case "group", "target":
+			attrs, diags := block.Body.JustAttributes()
+			if diags.HasErrors() {
+				return nil, bakeError(diags)
+			}
+			blocks := groups
+			if block.Type == "target" {
+				blocks = e.targets
+			}
+			// As in bake, blocks with the same name are merged.
+			if blocks[name] == nil {
+				blocks[name] = make(hcl.Attributes)
+			}
+			for attrName, attr := range attrs {
+				blocks[name][attrName] = attr
+			}
+		}
+	}
+	// Blocks are decoded in order of name, so that errors do not depend on
+	// map iteration. As in bake, every variable is evaluated, even if no
+	// target refers to it.
+	varNames := make([]string, 0, len(e.variables))
+	for name := range e.variables {
+		varNames = append(varNames, name)
+	}
+	sort.Strings(varNames)
+	for _, name := range varNames {
+		if diags := e.evalVariable(name, hcl.Range{}); diags.HasErrors() {
+			return nil, bakeError(diags)
+		}
+	}
+	bFile := &bakeFile{groups: make(map[string][]string), targets: make(map[string]*bakeBlock)}
+	for _, name := range sortedKeys(groups) {
+		bFile.groups[name] = nil
+		if attr, ok := groups[name]["targets"]; ok {
+			val, diags := e.eval(attr.Expr)
+			if diags.HasErrors() {
+				return nil, bakeError(diags)
+			}
+			if bFile.groups[name], diags = bakeStrings(attr, val); diags.HasErrors() {
+				return nil, bakeError(diags)
+			}
+		}
+	}
+	for _, name := range sortedKeys(e.targets) {
+		block, diags := e.decodeTarget(name)
+		if diags.HasErrors() {
+			return nil, bakeError(diags)
+		}
+		bFile.targets[name] = block
+	}
+	return bFile, nil
+}
+
+// bakeEvaluator evaluates variables and targets when they are first
+// referred to, so that they may refer to each other in any order.
+type bakeEvaluator struct {
+	getenv     func(string) string
+	functions  map[string]function.Function
+	variables  map[string]hcl.Expression
+	targets    map[string]hcl.Attributes
+	varVals    map[string]cty.Value
+	targetVals map[string]cty.Value
+	visiting   map[string]bool
+}
+
+// eval evaluates expr, after the variables and targets that it refers to.
+func (e *bakeEvaluator) eval(expr hcl.Expression) (cty.Value, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	for _, traversal := range expr.Variables() {
+		name := traversal.RootName()
+		if name == "target" && len(traversal) > 1 {
+			if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+				if _, ok := e.targets[attr.Name]; ok {
+					diags = append(diags, e.evalTarget(attr.Name, traversal.SourceRange())...)
+				}
+			}
+		} else if _, ok := e.variables[name]; ok {
+			diags = append(diags, e.evalVariable(name, traversal.SourceRange())...)
+		}
+	}
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return expr.Value(e.evalContext())
+}
+
+func (e *bakeEvaluator) evalContext() *hcl.EvalContext {
+	vars := make(map[string]cty.Value)
+	for name, val := range e.varVals {
+		vars[name] = val
+	}
+	if len(e.targetVals) != 0 {
+		vars["target"] = cty.ObjectVal(e.targetVals)
+	}
+	return &hcl.EvalContext{Variables: vars, Functions: e.functions}
+}
+
+// functionContext is the context of user functions' bodies, which may refer
+// to any variable that does not call them.
+func (e *bakeEvaluator) functionContext() *hcl.EvalContext {
+	for name := range e.variables {
+		if !e.visiting["variable."+name] {
+			e.evalVariable(name, hcl.Range{})
+		}
+	}
+	return e.evalContext()
+}
+
+func (e *bakeEvaluator) evalVariable(name string, rng hcl.Range) hcl.Diagnostics {
+	if _, ok := e.varVals[name]; ok {
+		return nil
+	}
+	key := "variable." + name
+	if e.visiting[key] {
+		return hcl.Diagnostics{{Severity: hcl.DiagError,
+			Summary: fmt.Sprintf("Cycle in variable '%s'", name),
+			Subject: rng.Ptr(),
+		}}
+	}
+	e.visiting[key] = true
+	defer delete(e.visiting, key)
+	val := cty.StringVal("")
+	if expr := e.variables[name]; expr != nil {
+		var diags hcl.Diagnostics
+		if val, diags = e.eval(expr); diags.HasErrors() {
+			return diags
+		}
+	}
+	// As in bake, variables are overridden by the environment, converted
+	// to the type of their default.
+	if env := e.getenv(name); env != "" {
+		envVal := cty.StringVal(env)
+		if val.Type() == cty.Bool || val.Type() == cty.Number {
+			var err error
+			if envVal, err = convert.Convert(envVal, val.Type()); err != nil {
+				return hcl.Diagnostics{{Severity: hcl.DiagError,
+					Summary: fmt.Sprintf("Invalid value of variable '%s' from the environment", name),
+					Detail:  err.Error(),
+				}}
+			}
+		}
+		val = envVal
+	}
+	e.varVals[name] = val
+	return nil
+}
+
+func (e *bakeEvaluator) evalTarget(name string, rng hcl.Range) hcl.Diagnostics {
+	if _, ok := e.targetVals[name]; ok {
+		return nil
+	}
+	key := "target." + name
+	if e.visiting[key] {
+		return hcl.Diagnostics{{Severity: hcl.DiagError,
+			Summary: fmt.Sprintf("Cycle in target '%s'", name),
+			Subject: rng.Ptr(),
+		}}
+	}
+	e.visiting[key] = true
+	defer delete(e.visiting, key)
+	vals := make(map[string]cty.Value)
+	for attrName, attr := range e.targets[name] {
+		val, diags := e.eval(attr.Expr)
+		if diags.HasErrors() {
+			return diags
+		}
+		vals[attrName] = val
+	}
+	e.targetVals[name] = cty.ObjectVal(vals)
+	return nil
+}
+
+// decodeTarget converts the attributes of the target called name.
+func (e *bakeEvaluator) decodeTarget(name string) (*bakeBlock, hcl.Diagnostics) {
+	if diags := e.evalTarget(name, hcl.Range{}); diags.HasErrors() {
+		return nil, diags
+	}
+	attrs := e.targets[name]
+	vals := e.targetVals[name]
+	block := &bakeBlock{}
+	var diags hcl.Diagnostics
+	for attrName, attr := range attrs {
+		val := vals.GetAttr(attrName)
+		switch attrName {
+		case "inherits":
+			block.Inherits, diags = bakeStrings(attr, val)
+		case "context":
+			block.Context, diags = bakeString(attr, val)
+		case "dockerfile":
+			block.Dockerfile, diags = bakeString(attr, val)
+		case "dockerfile-inline":
+			block.DockerfileInline, diags = bakeString(attr, val)
+		case "args":
+			block.Args, diags = bakeStringMap(attr, val)
+		case "contexts":
+			if block.Contexts, diags = bakeStringMap(attr, val); diags.HasErrors() {
+				break
+			}
+			block.contextRanges, diags = e.contextRanges(attr)
+		}
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	}
+	return block, nil
+}
+
+// contextRanges returns where the source of each named context is written,
+// if the contexts are written as an object, such as
+// 'contexts = { base = "docker-image://alpine:3.12" }'.
+func (e *bakeEvaluator) contextRanges(attr *hcl.Attribute) (map[string]hcl.Range, hcl.Diagnostics) {
+	pairs, diags := hcl.ExprMap(attr.Expr)
+	if diags.HasErrors() {
+		return nil, nil
+	}
+	ranges := make(map[string]hcl.Range)
+	for _, pair := range pairs {
+		key, diags := e.eval(pair.Key)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		if key, err := convert.Convert(key, cty.String); err == nil && key.IsKnown() && !key.IsNull() {
+			ranges[key.AsString()] = pair.Value.Range()
+		}
+	}
+	return ranges, nil
+}
+
+func sortedKeys(blocks map[string]hcl.Attributes) []string {
+	names := make([]string, 0, len(blocks))
+	for name := range blocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func bakeString(attr *hcl.Attribute, val cty.Value) (*string, hcl.Diagnostics) {
+	if val.IsNull() {
+		return nil, nil
+	}
+	val, err := convert.Convert(val, cty.String)
+	if err != nil || !val.IsKnown() {
+		return nil, bakeAttrError(attr, "a string", err)
+	}
+	s := val.AsString()
+	return &s, nil
+}
+
+func bakeStrings(attr *hcl.Attribute, val cty.Value) ([]string, hcl.Diagnostics) {
+	if val.IsNull() {
+		return nil, nil
+	}
+	val, err := convert.Convert(val, cty.List(cty.String))
+	if err != nil || !val.IsWhollyKnown() {
+		return nil, bakeAttrError(attr, "a list of strings", err)
+	}
+	var strs []string
+	for _, elem := range val.AsValueSlice() {
+		if !elem.IsNull() {
+			strs = append(strs, elem.AsString())
+		}
+	}
+	return strs, nil
+}
+
+// bakeStringMap converts an object or map to strings. Null values, such as
+// args that are not set, are left out.
+func bakeStringMap(attr *hcl.Attribute, val cty.Value) (map[string]string, hcl.Diagnostics) {
+	if val.IsNull() {
+		return nil, nil
+	}
+	val, err := convert.Convert(val, cty.Map(cty.String))
+	if err != nil || !val.IsWhollyKnown() {
+		return nil, bakeAttrError(attr, "a map of strings", err)
+	}
+	m := make(map[string]string)
+	for key, elem := range val.AsValueMap() {
+		if !elem.IsNull() {
+			m[key] = elem.AsString()
+		}
+	}
+	return m, nil
+}
+
+func bakeAttrError(attr *hcl.Attribute, expected string, err error) hcl.Diagnostics {
+	detail := fmt.Sprintf("'%s' must be %s", attr.Name, expected)
+	if err != nil {
+		detail = fmt.Sprintf("'%s' must be %s, %s", attr.Name, expected, err)
+	}
+	return hcl.Diagnostics{{Severity: hcl.DiagError,
+		Summary: "Invalid attribute",
+		Detail:  detail,
+		Subject: attr.Expr.Range().Ptr(),
+	}}
+}
+
+// bakeError joins the errors of diags, prefixed by where they are, such as
+// 'docker-bake.hcl:3:5: Unknown variable: There is no variable named "x"'.
+func bakeError(diags hcl.Diagnostics) error {
+	var msgs []string
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		msg := diag.Summary
+		if diag.Detail != "" {
+			msg += ": " + strings.TrimSuffix(diag.Detail, ".")
+		}
+		if diag.Subject != nil {
+			msg = fmt.Sprintf("%s:%d:%d: %s", diag.Subject.Filename, diag.Subject.Start.Line, diag.Subject.Start.Column, msg)
+		}
+		msgs = append(msgs, msg)
+	}
+	return errors.New(strings.Join(msgs, ". "))
+}
@@ -0,0 +1,182 @@
+package generate
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var vcsDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".svn": true,
+	".bzr": true,
+	"CVS":  true,
+}
+
+type ignoreRule struct {
+	// base is the directory, relative to baseDir, that the rule is anchored
+	// to, such as the directory of the ignore file.
+	base     []string
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+type ignorer struct {
+	rules   []ignoreRule
+	baseDir string
+}
+
+func newIgnorer(fsys fs.FS, excludes []string, ignoreFile string) (*ignorer, error) {
+	i := &ignorer{}
+	if isHostFS(fsys) {
+		baseDir, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		i.baseDir = baseDir
+	}
+	if ignoreFile != "" {
+		f, err := openFile(fsys, ignoreFile)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		} else {
+			defer f.Close()
+			base := i.relSegments(filepath.Dir(ignoreFile))
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				i.addPattern(scanner.Text(), base)
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, pattern := range excludes {
+		i.addPattern(pattern, nil)
+	}
+	return i, nil
+}
+
+// addPattern follows gitignore semantics. A pattern without a slash, other
+// than a trailing one, matches at any depth below base. Otherwise, it is
+// anchored to base. Patterns of the ignore file are relative to its
+// directory, and those of -exclude to the directory docker-lock is run from.
+func (i *ignorer) addPattern(pattern string, base []string) {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return
+	}
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	rule.segments = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	i.rules = append(i.rules, rule)
+}
+
+// ignored reports whether fpath, or any directory containing it, is excluded.
+func (i *ignorer) ignored(fpath string, isDir bool) bool {
+	if i == nil || len(i.rules) == 0 {
+		return false
+	}
+	segments := i.relSegments(fpath)
+	for n := 1; n < len(segments); n++ {
+		if i.match(segments[:n], true) {
+			return true
+		}
+	}
+	return i.match(segments, isDir)
+}
+
+func (i *ignorer) match(segments []string, isDir bool) bool {
+	var ignored bool
+	for _, rule := range i.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if !hasSegmentsPrefix(segments, rule.base) {
+			continue
+		}
+		if matchSegments(rule.segments, segments[len(rule.base):]) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (i *ignorer) relSegments(fpath string) []string {
+	if filepath.IsAbs(fpath) && i.baseDir != "" {
+		if rel, err := filepath.Rel(i.baseDir, fpath); err == nil {
+			fpath = rel
+		}
+	}
+	fpath = path.Clean(filepath.ToSlash(fpath))
+	if fpath == "." {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(fpath, "/"), "/")
+}
+
+func hasSegmentsPrefix(segments []string, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for n, segment := range prefix {
+		if segments[n] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSegments matches slash separated path segments against pattern
+// segments, where a "**" segment matches zero or more path segments.
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for n := 0; n <= len(segments); n++ {
+			if matchSegments(pattern[1:], segments[n:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
+
+func skipDir(dirPath string, root string) bool {
+	if filepath.Clean(dirPath) == filepath.Clean(root) {
+		return false
+	}
+	base := filepath.Base(dirPath)
+	return vcsDirs[base] || strings.HasPrefix(base, ".")
+}
@@ -0,0 +1,47 @@
+package generate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Hash returns the sha256 digest, as 'sha256:<hex>', of the Lockfile's
+// canonical encoding: compact JSON without Integrity. As the encoding does
+// not depend on the Lockfile's format, a Lockfile has the same hash
+// whether it is written as JSON, YAML or TOML.
+func (l *Lockfile) Hash() (string, error) {
+	canonical := *l
+	canonical.Integrity = ""
+	// YAML and TOML do not distinguish an empty section from a missing one.
+	if canonical.DockerfileImages == nil {
+		canonical.DockerfileImages = make(map[string][]DockerfileImage)
+	}
+	if canonical.ComposefileImages == nil {
+		canonical.ComposefileImages = make(map[string][]ComposefileImage)
+	}
+	byt, err := json.Marshal(&canonical)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(byt)
+	return "sha256:" + hex.EncodeToString(digest[:]), nil
+}
+
+// CheckIntegrity fails if the Lockfile has an integrity hash that does not
+// match its contents, for instance because a digest was edited by hand.
+// Lockfiles without an integrity hash pass.
+func (l *Lockfile) CheckIntegrity() error {
+	if l.Integrity == "" {
+		return nil
+	}
+	hash, err := l.Hash()
+	if err != nil {
+		return err
+	}
+	if hash != l.Integrity {
+		return fmt.Errorf("Lockfile integrity hash '%s' does not match its contents, which hash to '%s'.", l.Integrity, hash)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package generate
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockfileHash(t *testing.T) {
+	lFile := testLockfile()
+	hash, err := lFile.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile.Integrity = hash
+	if err := lFile.CheckIntegrity(); err != nil {
+		t.Fatal(err)
+	}
+	// The hash is of the Lockfile's contents, not of its format.
+	for _, name := range []string{"json", "yaml", "toml"} {
+		format, err := GetLockfileFormat(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byt, err := format.Encode(lFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Lockfile
+		if err := format.Decode(byt, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if err := decoded.CheckIntegrity(); err != nil {
+			t.Fatalf("Got '%s' for %s. Expected a matching hash.", err, name)
+		}
+	}
+	lFile.DockerfileImages["Dockerfile"][0].Digest = "tampered"
+	if err := lFile.CheckIntegrity(); err == nil {
+		t.Fatal("Tampered Lockfile should fail integrity check.")
+	}
+}
+
+func TestReadLockfileIntegrity(t *testing.T) {
+	lFile := testLockfile()
+	hash, err := lFile.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile.Integrity = hash
+	lFile.DockerfileImages["Dockerfile"][0].Tag = "20.04"
+	lByt, err := lFile.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpath := filepath.Join(t.TempDir(), "docker-lock.json")
+	if err := ioutil.WriteFile(fpath, lByt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLockfile(fpath, ""); err == nil {
+		t.Fatal("Tampered Lockfile should fail to be read.")
+	}
+}
@@ -0,0 +1,193 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// defaultKubernetesfileNames are collected recursively. Documents that are
+// not Kubernetes workloads, such as docker-compose files, have no images.
+var defaultKubernetesfileNames = []string{
+	"*.yml",
+	"*.yaml",
+}
+
+type kubernetesContainer struct {
+	Name  string `yaml:"name"`
+	Image string `yaml:"image"`
+}
+
+type kubernetesPodSpec struct {
+	InitContainers      []kubernetesContainer `yaml:"initContainers"`
+	Containers          []kubernetesContainer `yaml:"containers"`
+	EphemeralContainers []kubernetesContainer `yaml:"ephemeralContainers"`
+}
+
+type kubernetesPodTemplate struct {
+	Spec kubernetesPodSpec `yaml:"spec"`
+}
+
+type kubernetesDoc struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Spec struct {
+		kubernetesPodSpec `yaml:",inline"`
+		Template          kubernetesPodTemplate `yaml:"template"`
+		JobTemplate       struct {
+			Spec struct {
+				Template kubernetesPodTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+	} `yaml:"spec"`
+	// Items holds the resources of a List, as output by 'kubectl get -o yaml'.
+	Items []kubernetesDoc `yaml:"items"`
+}
+
+// podSpec returns the pod spec of workloads, and nil for other kinds.
+func (d *kubernetesDoc) podSpec() *kubernetesPodSpec {
+	switch d.Kind {
+	case "Pod":
+		return &d.Spec.kubernetesPodSpec
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job", "PodTemplate":
+		return &d.Spec.Template.Spec
+	case "CronJob":
+		return &d.Spec.JobTemplate.Spec.Template.Spec
+	}
+	return nil
+}
+
+// podSpecNode returns the node of the pod spec in node, the document that
+// d was decoded from.
+func (d *kubernetesDoc) podSpecNode(node *yamlv3.Node) *yamlv3.Node {
+	switch d.Kind {
+	case "Pod":
+		return yamlPath(node, "spec")
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job", "PodTemplate":
+		return yamlPath(node, "spec", "template", "spec")
+	case "CronJob":
+		return yamlPath(node, "spec", "jobTemplate", "spec", "template", "spec")
+	}
+	return nil
+}
+
+func collectKubernetesfiles(fsys fs.FS, opts *Options) ([]string, error) {
+	isDefaultKubernetesfile := func(fpath string) bool {
+		if len(opts.KubernetesfileNames) != 0 {
+			return matchesName(fpath, opts.KubernetesfileNames)
+		}
+		composefileNames := opts.ComposefileNames
+		if len(composefileNames) == 0 {
+			composefileNames = defaultComposefileNames
+		}
+		return matchesName(fpath, defaultKubernetesfileNames) && !matchesName(fpath, composefileNames)
+	}
+	ignorer, err := newIgnorer(fsys, opts.Excludes, opts.IgnoreFile)
+	if err != nil {
+		return nil, err
+	}
+	return collectFiles(fsys, opts.Kubernetesfiles, opts.KubernetesRecursive, opts.KubernetesRecursiveDir, isDefaultKubernetesfile, opts.KubernetesGlobs, ignorer)
+}
+
+// parseKubernetesfile parses every document of a multi-document YAML file,
+// such as the output of 'helm template', sending the image of every
+// container in the file's workloads. Documents of files that were collected
+// recursively or by glob, rather than named explicitly, are skipped if they
+// cannot be decoded, such as unrendered Helm templates or other YAML files.
+// Documents without a workload kind have no images.
+func (g *Generator) parseKubernetesfile(fileName string, parsedImageLines chan<- parsedImageLine, wg *sync.WaitGroup) {
+	if wg != nil {
+		defer wg.Done()
+	}
+	yamlByt, err := readFile(g.fsys(), fileName)
+	if err != nil {
+		parsedImageLines <- parsedImageLine{kubernetesfileName: fileName, err: err}
+		return
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(yamlByt))
+	// Documents are decoded again with yaml.v3, which records where images
+	// are. If it fails, images have no location.
+	nodeDecoder := yamlv3.NewDecoder(bytes.NewReader(yamlByt))
+	source := newYAMLSource(fileName, yamlByt)
+	// Images are only sent once every document is decoded, so that no
+	// images of a file that fails are locked.
+	var imLines []parsedImageLine
+	for docIndex := 1; ; docIndex++ {
+		var doc kubernetesDoc
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		var node *yamlv3.Node
+		if nodeDecoder != nil {
+			node = &yamlv3.Node{}
+			if err := nodeDecoder.Decode(node); err != nil {
+				node, nodeDecoder = nil, nil
+			}
+		}
+		if err != nil {
+			if !g.collectedKubernetesfiles[fileName] {
+				err = fmt.Errorf("%s. From document: %d. From file: '%s'.", err, docIndex, fileName)
+				parsedImageLines <- parsedImageLine{kubernetesfileName: fileName, err: err}
+				return
+			}
+			// Collected files may hold documents that are not Kubernetes
+			// resources. They are skipped, but documents after one that is
+			// not valid YAML cannot be read.
+			if _, ok := err.(*yaml.TypeError); ok {
+				continue
+			}
+			break
+		}
+		imLines = appendKubernetesImages(imLines, source, &doc, node)
+	}
+	for _, imLine := range imLines {
+		parsedImageLines <- imLine
+	}
+}
+
+// appendKubernetesImages appends the images of doc, positioned after the
+// images in imLines.
+func appendKubernetesImages(imLines []parsedImageLine, source *yamlSource, doc *kubernetesDoc, node *yamlv3.Node) []parsedImageLine {
+	for i := range doc.Items {
+		imLines = appendKubernetesImages(imLines, source, &doc.Items[i], yamlItem(yamlPath(node, "items"), i))
+	}
+	podSpec := doc.podSpec()
+	if podSpec == nil {
+		return imLines
+	}
+	podSpecNode := doc.podSpecNode(node)
+	for _, containers := range []struct {
+		key        string
+		containers []kubernetesContainer
+	}{
+		{"initContainers", podSpec.InitContainers},
+		{"containers", podSpec.Containers},
+		{"ephemeralContainers", podSpec.EphemeralContainers},
+	} {
+		for i, container := range containers.containers {
+			if container.Image == "" {
+				continue
+			}
+			imageNode := yamlPath(yamlItem(yamlPath(podSpecNode, containers.key), i), "image")
+			if imageNode != nil && imageNode.Value != container.Image {
+				imageNode = nil
+			}
+			imLines = append(imLines, parsedImageLine{line: container.Image,
+				kubernetesfileName: source.file,
+				kind:               doc.Kind,
+				resourceName:       doc.Metadata.Name,
+				containerName:      container.Name,
+				position:           len(imLines),
+				location:           source.location(imageNode)})
+		}
+	}
+	return imLines
+}
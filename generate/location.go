@@ -0,0 +1,189 @@
+package generate
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// sourceLocation is where an image reference is written. text is the
+// reference as written, before variables are substituted, such as
+// '${BASE}' in 'FROM ${BASE}'. Quotes around the reference are not part of
+// text. text starts offset bytes into file, at line and column, which count
+// bytes from 1. line is 0 if the reference could not be located.
+type sourceLocation struct {
+	file   string
+	line   int
+	column int
+	offset int
+	text   string
+}
+
+// String returns the location as 'file:line:column', or file if the
+// reference could not be located.
+func (l sourceLocation) String() string {
+	if l.line == 0 {
+		return l.file
+	}
+	return fmt.Sprintf("%s:%d:%d", l.file, l.line, l.column)
+}
+
+// trimPrefix removes prefix, such as 'docker://', from the start of text.
+func (l sourceLocation) trimPrefix(prefix string) sourceLocation {
+	if l.line == 0 || !strings.HasPrefix(l.text, prefix) {
+		return l
+	}
+	l.text = l.text[len(prefix):]
+	l.offset += len(prefix)
+	l.column += len(prefix)
+	return l
+}
+
+// offsetLocation locates text, which starts offset bytes into src, or
+// returns a location with only file if text does not start there.
+func offsetLocation(file string, src []byte, offset int, text string) sourceLocation {
+	if text == "" || offset < 0 || !bytes.HasPrefix(src[offset:], []byte(text)) {
+		return sourceLocation{file: file}
+	}
+	lineStart := bytes.LastIndexByte(src[:offset], '\n') + 1
+	return sourceLocation{file: file,
+		line:   bytes.Count(src[:offset], []byte("\n")) + 1,
+		column: offset - lineStart + 1,
+		offset: offset,
+		text:   text,
+	}
+}
+
+// utf16Column returns the column of offset in src, counted in UTF-16 code
+// units from 1.
+func utf16Column(src []byte, offset int) int {
+	column := 1
+	for _, r := range string(src[bytes.LastIndexByte(src[:offset], '\n')+1 : offset]) {
+		column += len(utf16.Encode([]rune{r}))
+	}
+	return column
+}
+
+// yamlSource locates the nodes of a YAML file parsed by yaml.v3, whose
+// columns count characters rather than bytes.
+type yamlSource struct {
+	file       string
+	src        []byte
+	lineStarts []int
+}
+
+func newYAMLSource(file string, src []byte) *yamlSource {
+	lineStarts := []int{0}
+	for i, b := range src {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return &yamlSource{file: file, src: src, lineStarts: lineStarts}
+}
+
+// location returns where the scalar node is written, or a location with
+// only file if node is nil or not a scalar.
+func (s *yamlSource) location(node *yamlv3.Node) sourceLocation {
+	if node == nil || node.Kind != yamlv3.ScalarNode || node.Line < 1 || node.Line > len(s.lineStarts) {
+		return sourceLocation{file: s.file}
+	}
+	lineStart := s.lineStarts[node.Line-1]
+	lineEnd := len(s.src)
+	if node.Line < len(s.lineStarts) {
+		lineEnd = s.lineStarts[node.Line] - 1
+	}
+	offset := lineStart
+	for i := 1; i < node.Column && offset < lineEnd; i++ {
+		_, size := utf8.DecodeRune(s.src[offset:lineEnd])
+		offset += size
+	}
+	// Block scalars, such as '|', span lines, and plain scalars may be
+	// folded, so text ends at the end of the first line of the value.
+	end := offset + len(node.Value)
+	switch {
+	case node.Style&yamlv3.DoubleQuotedStyle != 0:
+		offset++
+		end = quotedEnd(s.src[offset:lineEnd], '"') + offset
+	case node.Style&yamlv3.SingleQuotedStyle != 0:
+		offset++
+		end = quotedEnd(s.src[offset:lineEnd], '\'') + offset
+	}
+	if end > lineEnd {
+		end = lineEnd
+	}
+	return sourceLocation{file: s.file,
+		line:   node.Line,
+		column: offset - lineStart + 1,
+		offset: offset,
+		text:   string(s.src[offset:end]),
+	}
+}
+
+// quotedEnd returns the index of the quote that closes the quoted string at
+// the start of src, or len(src) if it is not closed on the line.
+func quotedEnd(src []byte, quote byte) int {
+	for i := 0; i < len(src); i++ {
+		switch {
+		case quote == '"' && src[i] == '\\':
+			i++
+		case src[i] == quote && quote == '\'' && i+1 < len(src) && src[i+1] == '\'':
+			i++
+		case src[i] == quote:
+			return i
+		}
+	}
+	return len(src)
+}
+
+// yamlPath returns the node at the path of mapping keys from node, or nil if
+// there is none. Documents and aliases are followed.
+func yamlPath(node *yamlv3.Node, keys ...string) *yamlv3.Node {
+	node = yamlResolve(node)
+	for _, key := range keys {
+		node = yamlMappingValue(node, key)
+	}
+	return node
+}
+
+// yamlItem returns the i-th item of a sequence node, or nil if there is none.
+func yamlItem(node *yamlv3.Node, i int) *yamlv3.Node {
+	node = yamlResolve(node)
+	if node == nil || node.Kind != yamlv3.SequenceNode || i >= len(node.Content) {
+		return nil
+	}
+	return yamlResolve(node.Content[i])
+}
+
+// yamlMappingValue returns the value of key in node, or nil if node is not
+// a mapping that contains key.
+func yamlMappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	node = yamlResolve(node)
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return yamlResolve(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+func yamlResolve(node *yamlv3.Node) *yamlv3.Node {
+	for node != nil {
+		switch {
+		case node.Kind == yamlv3.DocumentNode && len(node.Content) != 0:
+			node = node.Content[0]
+		case node.Kind == yamlv3.AliasNode:
+			node = node.Alias
+		default:
+			return node
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package generate
+
+import (
+	"testing"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+func TestYAMLSourceLocation(t *testing.T) {
+	src := []byte("services:\n" +
+		"  plain:\n    image: busybox\n" +
+		"  double:\n    image: \"ubuntu:18.04\" # comment\n" +
+		"  single:\n    image: 'it''s:1'\n" +
+		"  unicode:\n    x: { é: 1, image: node:12 }\n")
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(src, &doc); err != nil {
+		t.Fatal(err)
+	}
+	source := newYAMLSource("docker-compose.yml", src)
+	tests := []struct {
+		path     []string
+		expected sourceLocation
+	}{
+		{[]string{"services", "plain", "image"}, sourceLocation{line: 3, column: 12, offset: 30, text: "busybox"}},
+		{[]string{"services", "double", "image"}, sourceLocation{line: 5, column: 13, offset: 60, text: "ubuntu:18.04"}},
+		{[]string{"services", "single", "image"}, sourceLocation{line: 7, column: 13, offset: 106, text: "it''s:1"}},
+		{[]string{"services", "unicode", "x", "image"}, sourceLocation{line: 9, column: 24, offset: 149, text: "node:12"}},
+		{[]string{"services", "missing", "image"}, sourceLocation{}},
+	}
+	for _, test := range tests {
+		test.expected.file = "docker-compose.yml"
+		location := source.location(yamlPath(&doc, test.path...))
+		if location != test.expected {
+			t.Fatalf("Got %#v. Expected %#v.", location, test.expected)
+		}
+	}
+}
+
+func TestBakeContextLocation(t *testing.T) {
+	src := []byte(`target "app" {
+  contexts = { base = "docker-image://alpine:3.12" }
+}
+# The same image, in "another" target {.
+target "docs" {
+  inherits = ["app"]
+  args = { base = "docker-image://alpine:3.12" }
+  contexts = {
+    database = "docker-image://postgres:13"
+    base = "docker-image://alpine:3.12"
+  }
+}
+variable "TAG" { default = "3.12" }
+target "tags" {
+  contexts = { base = "docker-image://alpine:${TAG}" }
+}
+`)
+	bFile, err := decodeBakefile("docker-bake.hcl", src, func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		targetName  string
+		contextName string
+		expected    sourceLocation
+	}{
+		{"app", "base", sourceLocation{line: 2, column: 39, offset: 53, text: "alpine:3.12"}},
+		{"docs", "base", sourceLocation{line: 10, column: 28, offset: 283, text: "alpine:3.12"}},
+		{"docs", "database", sourceLocation{line: 9, column: 32, offset: 243, text: "postgres:13"}},
+		// The source is interpolated, so it is not written as is.
+		{"tags", "base", sourceLocation{}},
+	}
+	for _, test := range tests {
+		test.expected.file = "docker-bake.hcl"
+		block := bFile.targets[test.targetName]
+		location := bakeContextLocation("docker-bake.hcl", src, block.contextRanges[test.contextName], block.Contexts[test.contextName]).trimPrefix("docker-image://")
+		if location != test.expected {
+			t.Fatalf("Got %#v for target '%s'. Expected %#v.", location, test.targetName, test.expected)
+		}
+	}
+	jsonSrc := []byte(`{"group": {"app": {"targets": ["app"]}}, "target": {"other": {"contexts": {"base": "docker-image://alpine:3.12"}}, "app": {"contexts": {"base": "docker-image://alpine:3.12"}}}}`)
+	if bFile, err = decodeBakefile("docker-bake.json", jsonSrc, func(string) string { return "" }); err != nil {
+		t.Fatal(err)
+	}
+	expected := sourceLocation{file: "docker-bake.json", line: 1, column: 161, offset: 160, text: "alpine:3.12"}
+	block := bFile.targets["app"]
+	if location := bakeContextLocation("docker-bake.json", jsonSrc, block.contextRanges["base"], block.Contexts["base"]).trimPrefix("docker-image://"); location != expected {
+		t.Fatalf("Got %#v. Expected %#v.", location, expected)
+	}
+	if expected.String() != "docker-bake.json:1:161" {
+		t.Fatalf("Got '%s'. Expected 'docker-bake.json:1:161'.", expected.String())
+	}
+}
@@ -3,22 +3,196 @@ package generate
 import (
 	"bufio"
 	"errors"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
 	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 type parsedImageLine struct {
-	line            string
-	dockerfileName  string
-	composefileName string
-	position        int
-	serviceName     string
-	err             error
+	line               string
+	dockerfileName     string
+	composefileName    string
+	kubernetesfileName string
+	cifileName         string
+	bakefileName       string
+	position           int
+	location           sourceLocation
+	serviceName        string
+	kind               string
+	resourceName       string
+	containerName      string
+	job                string
+	key                string
+	target             string
+	context            string
+	err                error
+}
+
+// fileName returns the file that line is in.
+func (l *parsedImageLine) fileName() string {
+	if l.dockerfileName != "" {
+		return l.dockerfileName
+	}
+	if l.composefileName != "" {
+		return l.composefileName
+	}
+	if l.kubernetesfileName != "" {
+		return l.kubernetesfileName
+	}
+	if l.bakefileName != "" {
+		return l.bakefileName
+	}
+	return l.cifileName
+}
+
+// section returns the Lockfile section and file that l is listed under.
+func (l *parsedImageLine) section() (string, string) {
+	switch {
+	case l.composefileName != "":
+		return "composefiles", filepath.ToSlash(l.composefileName)
+	case l.bakefileName != "":
+		return "bakefiles", filepath.ToSlash(l.bakefileName)
+	case l.kubernetesfileName != "":
+		return "kubernetesfiles", filepath.ToSlash(l.kubernetesfileName)
+	case l.cifileName != "":
+		return "cifiles", filepath.ToSlash(l.cifileName)
+	default:
+		return "dockerfiles", filepath.ToSlash(l.dockerfileName)
+	}
+}
+
+// source returns where line is written, as 'file:line:column', or the file
+// that line is in if it could not be located.
+func (l *parsedImageLine) source() string {
+	if l.location.line == 0 {
+		return l.fileName()
+	}
+	return l.location.String()
+}
+
+// ImageLine is an image as written in a file, before its digest is
+// resolved, such as 'ubuntu:18.04' in 'FROM ubuntu:18.04'.
+type ImageLine struct {
+	Image string
+	// File is the file that Image is written in. Text is Image as written,
+	// before variables are substituted and without quotes, and starts
+	// Offset bytes into File, at Line and Column, which count bytes from 1.
+	// Line and Column are 0 if Image could not be located.
+	File   string
+	Line   int
+	Column int
+	Offset int
+	Text   string
+	// UTF16Column is Column counted in UTF-16 code units, as SARIF and
+	// editors count columns.
+	UTF16Column int
+	// Section, SectionFile and Position are where Image is locked in the
+	// Lockfile, such as the first image of 'composefiles' for the
+	// docker-compose file whose service builds File.
+	Section     string
+	SectionFile string
+	Position    int
+}
+
+// ImageLines parses the images in the Generator's files without resolving
+// their digests. Images are sorted by Section, SectionFile and Position.
+func (g *Generator) ImageLines() ([]ImageLine, error) {
+	parsedImageLines := make(chan parsedImageLine)
+	var wg sync.WaitGroup
+	for _, fileName := range g.Dockerfiles {
+		wg.Add(1)
+		go g.parseDockerfile(fileName, nil, "", "", parsedImageLines, &wg)
+	}
+	for _, fileName := range g.Composefiles {
+		wg.Add(1)
+		go g.parseComposefile(fileName, parsedImageLines, &wg)
+	}
+	for _, fileName := range g.Kubernetesfiles {
+		wg.Add(1)
+		go g.parseKubernetesfile(fileName, parsedImageLines, &wg)
+	}
+	for _, fileName := range g.CIfiles {
+		wg.Add(1)
+		go g.parseCIfile(fileName, parsedImageLines, &wg)
+	}
+	for _, fileName := range g.Bakefiles {
+		wg.Add(1)
+		go g.parseBakefile(fileName, parsedImageLines, &wg)
+	}
+	go func() {
+		wg.Wait()
+		close(parsedImageLines)
+	}()
+	var imLines []parsedImageLine
+	var err error
+	for imLine := range parsedImageLines {
+		if imLine.err != nil {
+			if err == nil {
+				err = imLine.err
+			}
+			continue
+		}
+		imLines = append(imLines, imLine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Images are ordered as in the Lockfile, where docker-compose files'
+	// images are sorted by service and Dockerfile, and other files' images
+	// by position.
+	sort.SliceStable(imLines, func(i, j int) bool {
+		a, b := imLines[i], imLines[j]
+		aSection, aSectionFile := a.section()
+		bSection, bSectionFile := b.section()
+		if aSection != bSection {
+			return aSection < bSection
+		}
+		if aSectionFile != bSectionFile {
+			return aSectionFile < bSectionFile
+		}
+		if aSection == "composefiles" {
+			if a.serviceName != b.serviceName {
+				return a.serviceName < b.serviceName
+			}
+			if a.dockerfileName != b.dockerfileName {
+				return a.dockerfileName < b.dockerfileName
+			}
+		}
+		return a.position < b.position
+	})
+	var imageLines []ImageLine
+	positions := make(map[string]int)
+	srcs := make(map[string][]byte)
+	for _, imLine := range imLines {
+		imageLine := ImageLine{Image: imLine.line,
+			File:   filepath.ToSlash(imLine.fileName()),
+			Line:   imLine.location.line,
+			Column: imLine.location.column,
+			Offset: imLine.location.offset,
+			Text:   imLine.location.text,
+		}
+		imageLine.Section, imageLine.SectionFile = imLine.section()
+		if imageLine.Line != 0 {
+			src, ok := srcs[imLine.fileName()]
+			if !ok {
+				if src, err = readFile(g.fsys(), imLine.fileName()); err != nil {
+					return nil, err
+				}
+				srcs[imLine.fileName()] = src
+			}
+			imageLine.UTF16Column = utf16Column(src, imageLine.Offset)
+		}
+		key := imageLine.Section + "\x00" + imageLine.SectionFile
+		imageLine.Position = positions[key]
+		positions[key]++
+		imageLines = append(imageLines, imageLine)
+	}
+	return imageLines, nil
 }
 
 type compose struct {
@@ -55,11 +229,11 @@ func (b *buildWrapper) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return errors.New("Unable to parse service.")
 }
 
-func parseComposefile(fileName string, parsedImageLines chan<- parsedImageLine, wg *sync.WaitGroup) {
+func (g *Generator) parseComposefile(fileName string, parsedImageLines chan<- parsedImageLine, wg *sync.WaitGroup) {
 	if wg != nil {
 		defer wg.Done()
 	}
-	yamlByt, err := ioutil.ReadFile(fileName)
+	yamlByt, err := readFile(g.fsys(), fileName)
 	if err != nil {
 		parsedImageLines <- parsedImageLine{composefileName: fileName, err: err}
 		return
@@ -69,35 +243,72 @@ func parseComposefile(fileName string, parsedImageLines chan<- parsedImageLine,
 		parsedImageLines <- parsedImageLine{composefileName: fileName, err: err}
 		return
 	}
+	// Images are located with yaml.v3, which records where nodes are.
+	// Images of services that cannot be located, such as ones inherited
+	// through merge keys, have no location.
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(yamlByt, &doc); err != nil {
+		doc = yamlv3.Node{}
+	}
+	source := newYAMLSource(fileName, yamlByt)
 	for serviceName, service := range comp.Services {
 		if service.BuildWrapper == nil {
-			line := os.ExpandEnv(service.ImageName)
-			parsedImageLines <- parsedImageLine{line: line, composefileName: fileName, serviceName: serviceName}
+			line := g.expandEnv(service.ImageName)
+			parsedImageLines <- parsedImageLine{line: line,
+				composefileName: fileName,
+				serviceName:     serviceName,
+				location:        source.location(yamlPath(&doc, "services", serviceName, "image"))}
 			continue
 		}
+		dockerfile := g.composeDockerfile(fileName, service.BuildWrapper)
 		switch build := service.BuildWrapper.Build.(type) {
 		case simple:
-			dockerfile := filepath.Join(filepath.Dir(fileName), os.ExpandEnv(string(build)), "Dockerfile")
-			parseDockerfile(dockerfile, nil, fileName, serviceName, parsedImageLines, nil)
+			g.parseDockerfile(dockerfile, nil, fileName, serviceName, parsedImageLines, nil)
 		case verbose:
-			context := filepath.Join(filepath.Dir(fileName), os.ExpandEnv(build.Context))
-			dockerfile := os.ExpandEnv(build.Dockerfile)
-			if dockerfile == "" {
-				dockerfile = filepath.Join(context, "Dockerfile")
-			} else {
-				dockerfile = filepath.Join(context, dockerfile)
-			}
 			buildArgs := make(map[string]string)
 			for _, arg := range build.Args {
-				kv := strings.Split(os.ExpandEnv(arg), "=")
+				kv := strings.Split(g.expandEnv(arg), "=")
 				buildArgs[kv[0]] = kv[1]
 			}
-			parseDockerfile(dockerfile, buildArgs, fileName, serviceName, parsedImageLines, nil)
+			g.parseDockerfile(dockerfile, buildArgs, fileName, serviceName, parsedImageLines, nil)
+		}
+	}
+}
+
+func (g *Generator) composeDockerfile(fileName string, buildWrapper *buildWrapper) string {
+	switch build := buildWrapper.Build.(type) {
+	case simple:
+		return filepath.Join(filepath.Dir(fileName), g.expandEnv(string(build)), "Dockerfile")
+	case verbose:
+		context := filepath.Join(filepath.Dir(fileName), g.expandEnv(build.Context))
+		dockerfile := g.expandEnv(build.Dockerfile)
+		if dockerfile == "" {
+			return filepath.Join(context, "Dockerfile")
+		}
+		return filepath.Join(context, dockerfile)
+	}
+	return ""
+}
+
+func (g *Generator) composeDockerfiles(fileName string) ([]string, error) {
+	yamlByt, err := readFile(g.fsys(), fileName)
+	if err != nil {
+		return nil, err
+	}
+	var comp compose
+	if err := yaml.Unmarshal(yamlByt, &comp); err != nil {
+		return nil, err
+	}
+	var dockerfiles []string
+	for _, service := range comp.Services {
+		if service.BuildWrapper != nil {
+			dockerfiles = append(dockerfiles, g.composeDockerfile(fileName, service.BuildWrapper))
 		}
 	}
+	return dockerfiles, nil
 }
 
-func parseDockerfile(dockerfileName string,
+func (g *Generator) parseDockerfile(dockerfileName string,
 	composeArgs map[string]string,
 	composefileName string,
 	serviceName string,
@@ -105,7 +316,7 @@ func parseDockerfile(dockerfileName string,
 	if wg != nil {
 		defer wg.Done()
 	}
-	dockerfile, err := os.Open(dockerfileName)
+	dockerfile, err := openFile(g.fsys(), dockerfileName)
 	if err != nil {
 		parsedImageLines <- parsedImageLine{dockerfileName: dockerfileName,
 			composefileName: composefileName,
@@ -117,11 +328,21 @@ func parseDockerfile(dockerfileName string,
 	stageNames := make(map[string]bool)
 	globalArgs := make(map[string]string)
 	scanner := bufio.NewScanner(dockerfile)
-	scanner.Split(bufio.ScanLines)
+	// lineStart is the offset of the scanned line in the Dockerfile.
+	lineStart, offset := 0, 0
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		lineStart = offset
+		offset += advance
+		return advance, token, err
+	})
 	globalContext := true
 	position := 0
+	lineNumber := 0
 	for scanner.Scan() {
-		fields := strings.Fields(scanner.Text())
+		lineNumber++
+		text := scanner.Text()
+		fields := strings.Fields(text)
 		if len(fields) > 0 {
 			switch instruction := strings.ToLower(fields[0]); instruction {
 			case "arg":
@@ -141,11 +362,19 @@ func parseDockerfile(dockerfileName string,
 				globalContext = false
 				line := expandField(fields[1], globalArgs, composeArgs)
 				if !stageNames[line] {
+					// The image is the first field after the instruction.
+					afterInstruction := strings.Index(text, fields[0]) + len(fields[0])
+					column := afterInstruction + strings.Index(text[afterInstruction:], fields[1]) + 1
 					parsedImageLines <- parsedImageLine{line: line,
 						dockerfileName:  dockerfileName,
 						composefileName: composefileName,
 						serviceName:     serviceName,
-						position:        position}
+						position:        position,
+						location: sourceLocation{file: dockerfileName,
+							line:   lineNumber,
+							column: column,
+							offset: lineStart + column - 1,
+							text:   fields[1]}}
 					position++
 				}
 				// FROM <image> AS <stage>
@@ -1,9 +1,14 @@
 package generate
 
 import (
+	"fmt"
+	"io/ioutil"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
 
 	"github.com/joho/godotenv"
 )
@@ -14,21 +19,26 @@ func TestParseComposeFile(t *testing.T) {
 		t.Fatalf("Unable to load dotenv before running test.")
 	}
 	composefileName := filepath.Join(baseDir, "docker-compose.yml")
+	// Every Dockerfile starts with 'FROM busybox'.
+	dockerfileLocation := func(dockerfileName string) sourceLocation {
+		return sourceLocation{file: dockerfileName, line: 1, column: 6, offset: 5, text: "busybox"}
+	}
 	results := map[parsedImageLine]bool{
-		{line: "busybox", composefileName: composefileName, dockerfileName: "", serviceName: "simple1"}:                                                         false,
-		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "simple2build", "Dockerfile"), serviceName: "simple2"}:       false,
-		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "simple3build", "Dockerfile"), serviceName: "simple3"}:       false,
-		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "simple4build", "Dockerfile"), serviceName: "simple4"}:       false,
-		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose1build", "Dockerfile"), serviceName: "verbose1"}:     false,
-		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose2build", "Dockerfile"), serviceName: "verbose2"}:     false,
-		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose3build", "Dockerfile"), serviceName: "verbose3"}:     false,
-		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose4build", "Dockerfile-dev"), serviceName: "verbose4"}: false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: "", serviceName: "simple1", location: sourceLocation{file: composefileName, line: 5, column: 12, offset: 46, text: "busybox"}}:                                               false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "simple2build", "Dockerfile"), serviceName: "simple2", location: dockerfileLocation(filepath.Join(baseDir, "simple2build", "Dockerfile"))}:            false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "simple3build", "Dockerfile"), serviceName: "simple3", location: dockerfileLocation(filepath.Join(baseDir, "simple3build", "Dockerfile"))}:            false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "simple4build", "Dockerfile"), serviceName: "simple4", location: dockerfileLocation(filepath.Join(baseDir, "simple4build", "Dockerfile"))}:            false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose1build", "Dockerfile"), serviceName: "verbose1", location: dockerfileLocation(filepath.Join(baseDir, "verbose1build", "Dockerfile"))}:         false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose2build", "Dockerfile"), serviceName: "verbose2", location: dockerfileLocation(filepath.Join(baseDir, "verbose2build", "Dockerfile"))}:         false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose3build", "Dockerfile"), serviceName: "verbose3", location: dockerfileLocation(filepath.Join(baseDir, "verbose3build", "Dockerfile"))}:         false,
+		{line: "busybox", composefileName: composefileName, dockerfileName: filepath.Join(baseDir, "verbose4build", "Dockerfile-dev"), serviceName: "verbose4", location: dockerfileLocation(filepath.Join(baseDir, "verbose4build", "Dockerfile-dev"))}: false,
 	}
+	g := &Generator{}
 	parsedImageLines := make(chan parsedImageLine)
 	var wg sync.WaitGroup
+	wg.Add(1)
 	go func() {
-		wg.Add(1)
-		parseComposefile(composefileName, parsedImageLines, &wg)
+		g.parseComposefile(composefileName, parsedImageLines, &wg)
 		wg.Wait()
 		close(parsedImageLines)
 	}()
@@ -62,8 +72,9 @@ func TestParseDockerfileOverride(t *testing.T) {
 	baseDir := filepath.Join("testdata", "parse", "dockerfile")
 	dockerfile := filepath.Join(baseDir, "override", "Dockerfile")
 	composeArgs := map[string]string{"IMAGE_NAME": "debian"}
+	g := &Generator{}
 	parsedImageLines := make(chan parsedImageLine)
-	go parseDockerfile(dockerfile, composeArgs, "", "", parsedImageLines, nil)
+	go g.parseDockerfile(dockerfile, composeArgs, "", "", parsedImageLines, nil)
 	result := <-parsedImageLines
 	if result.line != composeArgs["IMAGE_NAME"] {
 		t.Fatalf("Got '%s'. Want '%s'.", result.line, composeArgs["IMAGE_NAME"])
@@ -76,8 +87,9 @@ func TestParseDockerfileEmpty(t *testing.T) {
 	baseDir := filepath.Join("testdata", "parse", "dockerfile")
 	dockerfile := filepath.Join(baseDir, "empty", "Dockerfile")
 	composeArgs := map[string]string{"IMAGE_NAME": "debian"}
+	g := &Generator{}
 	parsedImageLines := make(chan parsedImageLine)
-	go parseDockerfile(dockerfile, composeArgs, "", "", parsedImageLines, nil)
+	go g.parseDockerfile(dockerfile, composeArgs, "", "", parsedImageLines, nil)
 	result := <-parsedImageLines
 	if result.line != composeArgs["IMAGE_NAME"] {
 		t.Fatalf("Got '%s'. Want '%s'.", result.line, composeArgs["IMAGE_NAME"])
@@ -89,8 +101,9 @@ func TestParseDockerfileNoArg(t *testing.T) {
 	// Should behave as though no composefile existed.
 	baseDir := filepath.Join("testdata", "parse", "dockerfile")
 	dockerfile := filepath.Join(baseDir, "noarg", "Dockerfile")
+	g := &Generator{}
 	parsedImageLines := make(chan parsedImageLine)
-	go parseDockerfile(dockerfile, nil, "", "", parsedImageLines, nil)
+	go g.parseDockerfile(dockerfile, nil, "", "", parsedImageLines, nil)
 	result := <-parsedImageLines
 	imageName := "busybox"
 	if result.line != imageName {
@@ -103,8 +116,9 @@ func TestParseDockerfileLocalArg(t *testing.T) {
 	// be overridden by ARG defined after FROM (aka local arg)
 	baseDir := filepath.Join("testdata", "parse", "dockerfile")
 	dockerfile := filepath.Join(baseDir, "localarg", "Dockerfile")
+	g := &Generator{}
 	parsedImageLines := make(chan parsedImageLine)
-	go parseDockerfile(dockerfile, nil, "", "", parsedImageLines, nil)
+	go g.parseDockerfile(dockerfile, nil, "", "", parsedImageLines, nil)
 	results := []parsedImageLine{<-parsedImageLines, <-parsedImageLines}
 	imageName := "busybox"
 	for _, result := range results {
@@ -123,8 +137,9 @@ func TestParseDockerfileBuildStage(t *testing.T) {
 	// should only parse 'busybox', the second field in the first line.
 	baseDir := filepath.Join("testdata", "parse", "dockerfile")
 	dockerfile := filepath.Join(baseDir, "buildstage", "Dockerfile")
+	g := &Generator{}
 	parsedImageLines := make(chan parsedImageLine)
-	go parseDockerfile(dockerfile, nil, "", "", parsedImageLines, nil)
+	go g.parseDockerfile(dockerfile, nil, "", "", parsedImageLines, nil)
 	results := []parsedImageLine{<-parsedImageLines, <-parsedImageLines}
 	imageNames := []string{"busybox", "ubuntu"}
 	for i, result := range results {
@@ -134,3 +149,435 @@ func TestParseDockerfileBuildStage(t *testing.T) {
 	}
 
 }
+
+func TestParseKubernetesfile(t *testing.T) {
+	baseDir := filepath.Join("testdata", "kubernetes")
+	kubernetesfileName := filepath.Join(baseDir, "deployment.yaml")
+	expected := []parsedImageLine{
+		{line: "busybox", kubernetesfileName: kubernetesfileName, kind: "Deployment", resourceName: "web", containerName: "migrate", position: 0},
+		{line: "nginx:1.19", kubernetesfileName: kubernetesfileName, kind: "Deployment", resourceName: "web", containerName: "web", position: 1},
+		{line: "envoyproxy/envoy@sha256:9b1702dcfe32c873a770a32cfd306dd7fc1c4fd134adfb783db68defc8894b3c", kubernetesfileName: kubernetesfileName, kind: "Deployment", resourceName: "web", containerName: "sidecar", position: 2},
+		{line: "postgres:12", kubernetesfileName: kubernetesfileName, kind: "CronJob", resourceName: "backup", containerName: "backup", position: 3},
+	}
+	expectedLines := []int{18, 21, 23, 37}
+	src, err := ioutil.ReadFile(kubernetesfileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &Generator{}
+	parsedImageLines := make(chan parsedImageLine)
+	go func() {
+		g.parseKubernetesfile(kubernetesfileName, parsedImageLines, nil)
+		close(parsedImageLines)
+	}()
+	var results []parsedImageLine
+	for imLine := range parsedImageLines {
+		if imLine.err != nil {
+			t.Fatalf("Failed to parse. Kubernetesfile: '%s'. Err: '%s'.", imLine.kubernetesfileName, imLine.err)
+		}
+		results = append(results, imLine)
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Got %d results. Expected %d.", len(results), len(expected))
+	}
+	for i := range expected {
+		location := results[i].location
+		if location.file != kubernetesfileName || location.line != expectedLines[i] || location.text != expected[i].line ||
+			string(src[location.offset:location.offset+len(location.text)]) != location.text {
+			t.Fatalf("Got %+v. Expected '%s' at line %d.", location, expected[i].line, expectedLines[i])
+		}
+		results[i].location = sourceLocation{}
+		if results[i] != expected[i] {
+			t.Fatalf("Got '%+v'. Expected '%+v'.", results[i], expected[i])
+		}
+	}
+}
+
+func TestParseKubernetesfileList(t *testing.T) {
+	kubernetesfileName := filepath.Join("testdata", "kubernetes", "charts", "web", "rendered.yml")
+	expected := []string{"Pod/debug/debug", "StatefulSet/db/db", "DaemonSet/agent/agent", "Job/seed/seed"}
+	g := &Generator{}
+	parsedImageLines := make(chan parsedImageLine)
+	go func() {
+		g.parseKubernetesfile(kubernetesfileName, parsedImageLines, nil)
+		close(parsedImageLines)
+	}()
+	var results []string
+	for imLine := range parsedImageLines {
+		if imLine.err != nil {
+			t.Fatalf("Failed to parse. Kubernetesfile: '%s'. Err: '%s'.", imLine.kubernetesfileName, imLine.err)
+		}
+		results = append(results, imLine.kind+"/"+imLine.resourceName+"/"+imLine.containerName)
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Got %v. Expected %v.", results, expected)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Fatalf("Got '%s'. Expected '%s'.", results[i], expected[i])
+		}
+	}
+}
+
+func TestParseKubernetesfileFaulty(t *testing.T) {
+	kubernetesfileName := filepath.Join("testdata", "kubernetes", "faulty.yaml.txt")
+	g := &Generator{}
+	parsedImageLines := make(chan parsedImageLine, 1)
+	g.parseKubernetesfile(kubernetesfileName, parsedImageLines, nil)
+	close(parsedImageLines)
+	imLine := <-parsedImageLines
+	if imLine.err == nil {
+		t.Fatal("Parsing faulty YAML should fail.")
+	}
+}
+
+func TestParseCIfile(t *testing.T) {
+	baseDir := filepath.Join("testdata", "ci")
+	tests := []struct {
+		fileName string
+		expected []string
+	}{
+		{
+			fileName: filepath.Join(baseDir, ".github", "workflows", "build.yml"),
+			expected: []string{
+				"lint/container/golang:1.15",
+				"test/container/node:12",
+				"test/services.db/postgres:12",
+				"test/services.redis/redis:6",
+				"test/steps.1/alpine:3.12",
+			},
+		},
+		{
+			fileName: filepath.Join(baseDir, ".gitlab-ci.yml"),
+			expected: []string{
+				"/image/ruby:2.6",
+				"/services.0/postgres:12",
+				"test/image/node:12",
+				"test/services.0/redis:6",
+			},
+		},
+		{
+			fileName: filepath.Join(baseDir, "default", ".gitlab-ci.yml"),
+			expected: []string{
+				"/image/ruby:2.6",
+				"default/image/ruby:2.7",
+				"default/services.0/postgres:12",
+			},
+		},
+	}
+	for _, test := range tests {
+		g := &Generator{}
+		parsedImageLines := make(chan parsedImageLine)
+		go func() {
+			g.parseCIfile(test.fileName, parsedImageLines, nil)
+			close(parsedImageLines)
+		}()
+		var results []string
+		for imLine := range parsedImageLines {
+			if imLine.err != nil {
+				t.Fatalf("Failed to parse. CI file: '%s'. Err: '%s'.", imLine.cifileName, imLine.err)
+			}
+			if imLine.position != len(results) {
+				t.Fatalf("Got position %d. Expected %d.", imLine.position, len(results))
+			}
+			checkLocation(t, imLine, imLine.line)
+			results = append(results, imLine.job+"/"+imLine.key+"/"+imLine.line)
+		}
+		if len(results) != len(test.expected) {
+			t.Fatalf("Got %v. Expected %v.", results, test.expected)
+		}
+		for i := range test.expected {
+			if results[i] != test.expected[i] {
+				t.Fatalf("Got '%s'. Expected '%s'.", results[i], test.expected[i])
+			}
+		}
+	}
+}
+
+func TestParseFaultyGitlabCIfile(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitlab-ci.yml": {Data: []byte("test:\n  image: [node, ruby]\n")},
+	}
+	g := &Generator{FS: fsys}
+	parsedImageLines := make(chan parsedImageLine, 1)
+	g.parseCIfile(".gitlab-ci.yml", parsedImageLines, nil)
+	close(parsedImageLines)
+	if imLine := <-parsedImageLines; imLine.err == nil {
+		t.Fatal("Job with a faulty image should fail.")
+	}
+}
+
+func TestParseBakefile(t *testing.T) {
+	baseDir := filepath.Join("testdata", "bake")
+	dockerfile := filepath.Join(baseDir, "app", "Dockerfile")
+	docsDockerfile := filepath.Join(baseDir, "app", "Dockerfile.docs")
+	jsonDockerfile := filepath.Join(baseDir, "json", "..", "app", "Dockerfile.docs")
+	tests := []struct {
+		fileName    string
+		bakeTargets []string
+		env         map[string]string
+		expected    []string
+	}{
+		{
+			fileName: filepath.Join(baseDir, "docker-bake.hcl"),
+			expected: []string{
+				"app/alpine//alpine:3.12",
+				"app//" + dockerfile + "/node:12",
+				"docs//" + docsDockerfile + "/python:3.7",
+			},
+		},
+		{
+			fileName:    filepath.Join(baseDir, "docker-bake.hcl"),
+			bakeTargets: []string{"app"},
+			env:         map[string]string{"NODE_VERSION": "14"},
+			expected: []string{
+				"app/alpine//alpine:3.12",
+				"app//" + dockerfile + "/node:14",
+			},
+		},
+		{
+			fileName:    filepath.Join(baseDir, "json", "docker-bake.json"),
+			bakeTargets: []string{"default"},
+			expected: []string{
+				"app/base//alpine:3.12",
+				"app//" + filepath.Clean(jsonDockerfile) + "/python:3.7",
+			},
+		},
+	}
+	for _, test := range tests {
+		env := test.env
+		if env == nil {
+			env = map[string]string{}
+		}
+		g := &Generator{BakeTargets: test.bakeTargets, Env: env}
+		parsedImageLines := make(chan parsedImageLine)
+		go func() {
+			g.parseBakefile(test.fileName, parsedImageLines, nil)
+			close(parsedImageLines)
+		}()
+		var results []string
+		for imLine := range parsedImageLines {
+			if imLine.err != nil {
+				t.Fatalf("Failed to parse. Bake file: '%s'. Err: '%s'.", imLine.bakefileName, imLine.err)
+			}
+			switch {
+			case imLine.dockerfileName != "":
+			case filepath.Ext(test.fileName) == ".json":
+				// The context's source, 'docker-image://alpine:${TAG}', is
+				// interpolated, so it cannot be located.
+				if imLine.location.line != 0 {
+					t.Fatalf("Got %+v. Expected no location.", imLine.location)
+				}
+			default:
+				checkLocation(t, imLine, imLine.line)
+			}
+			results = append(results, imLine.target+"/"+imLine.context+"/"+imLine.dockerfileName+"/"+imLine.line)
+		}
+		if len(results) != len(test.expected) {
+			t.Fatalf("Got %v. Expected %v.", results, test.expected)
+		}
+		for i := range test.expected {
+			if results[i] != test.expected[i] {
+				t.Fatalf("Got '%s'. Expected '%s'.", results[i], test.expected[i])
+			}
+		}
+	}
+}
+
+func TestDecodeBakefile(t *testing.T) {
+	src := `
+variable "TAG" { default = "latest" }
+variable "DEBUG" { default = false }
+function "image" {
+  params = [name]
+  result = "${name}:${TAG}"
+}
+target "base" {
+  args = { "A" = 1, B: true, C = null, D = "$${literal}" }
+}
+target "app" {
+  args = merge(target.base.args, { E = upper(TAG), F = DEBUG ? "debug" : "release" })
+  contexts = { base = "docker-image://${image("alpine")}" }
+  dockerfile-inline = <<EOT
+FROM "alpine"
+EOT
+}
+`
+	env := map[string]string{"DEBUG": "true"}
+	bFile, err := decodeBakefile("docker-bake.hcl", []byte(src), func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := bFile.targets["app"]
+	expectedArgs := map[string]string{"A": "1", "B": "true", "D": "${literal}", "E": "LATEST", "F": "debug"}
+	if !reflect.DeepEqual(app.Args, expectedArgs) {
+		t.Fatalf("Got %v. Expected %v.", app.Args, expectedArgs)
+	}
+	if base := app.Contexts["base"]; base != "docker-image://alpine:latest" {
+		t.Fatalf("Got '%s'. Expected 'docker-image://alpine:latest'.", base)
+	}
+	if app.DockerfileInline == nil || *app.DockerfileInline != "FROM \"alpine\"\n" {
+		t.Fatalf("Got %v. Expected an inline Dockerfile.", app.DockerfileInline)
+	}
+	env["DEBUG"] = "maybe"
+	if _, err := decodeBakefile("docker-bake.hcl", []byte(src), func(name string) string { return env[name] }); err == nil {
+		t.Fatal("Variable whose value from the environment is not a bool should fail.")
+	}
+	for _, faulty := range []string{
+		`target "app" {`,
+		`target "app" { tags = [ }`,
+		`target "app" { args = lookup(x) }`,
+		`target "app" { context = undefined }`,
+		`target "app" { context = target.app.dockerfile }`,
+		`target "app" { args = ["a"] }`,
+		`a = "unterminated`,
+	} {
+		if _, err := decodeBakefile("docker-bake.hcl", []byte(faulty), func(string) string { return "" }); err == nil {
+			t.Fatalf("Decoding '%s' should fail.", faulty)
+		}
+	}
+}
+
+func TestBakeChainedVariables(t *testing.T) {
+	src := `variable "IMAGE" {
+  default = "${REGISTRY}/alpine:${TAG}"
+}
+variable "REGISTRY" {
+  default = "${HOST}/library"
+}
+variable "HOST" {
+  default = "docker.io"
+}
+variable "TAG" {
+  default = "3.12"
+}
+target "app" {
+  contexts = {
+    base = "docker-image://${IMAGE}"
+  }
+}
+`
+	fsys := fstest.MapFS{"docker-bake.hcl": {Data: []byte(src)}}
+	g := &Generator{FS: fsys, Env: map[string]string{"TAG": "3.13"}}
+	// Variables are stored in a map, so resolve them repeatedly to catch
+	// dependence on iteration order.
+	for i := 0; i < 20; i++ {
+		targets, err := g.bakeTargets("docker-bake.hcl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if base := targets["app"].Contexts["base"]; base != "docker-image://docker.io/library/alpine:3.13" {
+			t.Fatalf("Got '%s'. Expected 'docker-image://docker.io/library/alpine:3.13'.", base)
+		}
+	}
+	fsys["docker-bake.hcl"] = &fstest.MapFile{Data: []byte(`variable "A" {
+  default = "${B}"
+}
+variable "B" {
+  default = "x-${A}"
+}
+target "app" {}
+`)}
+	if _, err := g.bakeTargets("docker-bake.hcl"); err == nil || !strings.Contains(err.Error(), "Cycle in variable") {
+		t.Fatalf("Got '%v'. Expected an error about the cycle in variables.", err)
+	}
+}
+
+func TestParseBakefileSharedImage(t *testing.T) {
+	fileName := filepath.Join("testdata", "bake", "shared", "docker-bake.hcl")
+	g := &Generator{Env: map[string]string{}}
+	parsedImageLines := make(chan parsedImageLine)
+	go func() {
+		g.parseBakefile(fileName, parsedImageLines, nil)
+		close(parsedImageLines)
+	}()
+	var results []string
+	for imLine := range parsedImageLines {
+		if imLine.err != nil {
+			t.Fatal(imLine.err)
+		}
+		checkLocation(t, imLine, imLine.line)
+		results = append(results, fmt.Sprintf("%s/%s", imLine.target, imLine.location))
+	}
+	// 'child' inherits the named context written in the block of 'docs'.
+	expected := []string{
+		fmt.Sprintf("app/%s:5:28", fileName),
+		fmt.Sprintf("child/%s:12:28", fileName),
+		fmt.Sprintf("docs/%s:12:28", fileName),
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Got %v. Expected %v.", results, expected)
+	}
+}
+
+func TestParseBakefileUnknownTarget(t *testing.T) {
+	fileName := filepath.Join("testdata", "bake", "docker-bake.hcl")
+	g := &Generator{BakeTargets: []string{"missing"}, Env: map[string]string{}}
+	parsedImageLines := make(chan parsedImageLine, 1)
+	g.parseBakefile(fileName, parsedImageLines, nil)
+	close(parsedImageLines)
+	if imLine := <-parsedImageLines; imLine.err == nil {
+		t.Fatal("Parsing an unknown target should fail.")
+	}
+}
+
+func TestImageLines(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":         {Data: []byte("ARG BASE=ubuntu:18.04\n\nFROM ${BASE} AS build\nRUN make\nFROM build\n  from\tbusybox\n")},
+		"docker-compose.yml": {Data: []byte("services:\n  db:\n    image: postgres:12\n  web:\n    build: web\n")},
+		"web/Dockerfile":     {Data: []byte("# web\nFROM node:12\n")},
+	}
+	g, err := NewGeneratorFS(fsys, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageLines, err := g.ImageLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ImageLine{
+		{Image: "postgres:12", File: "docker-compose.yml", Line: 3, Column: 12, UTF16Column: 12, Offset: 27, Text: "postgres:12", Section: "composefiles", SectionFile: "docker-compose.yml"},
+		{Image: "node:12", File: "web/Dockerfile", Line: 2, Column: 6, UTF16Column: 6, Offset: 11, Text: "node:12", Section: "composefiles", SectionFile: "docker-compose.yml", Position: 1},
+		{Image: "ubuntu:18.04", File: "Dockerfile", Line: 3, Column: 6, UTF16Column: 6, Offset: 28, Text: "${BASE}", Section: "dockerfiles", SectionFile: "Dockerfile"},
+		{Image: "busybox", File: "Dockerfile", Line: 6, Column: 8, UTF16Column: 8, Offset: 72, Text: "busybox", Section: "dockerfiles", SectionFile: "Dockerfile", Position: 1},
+	}
+	if !reflect.DeepEqual(imageLines, expected) {
+		t.Fatalf("Got %+v. Expected %+v.", imageLines, expected)
+	}
+}
+
+func TestImageLinesUTF16Column(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docker-compose.yml": {Data: []byte("services:\n  db: {x: \"🐳\", image: postgres:12}\n")},
+	}
+	g, err := NewGeneratorFS(fsys, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageLines, err := g.ImageLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imageLines) != 1 || imageLines[0].Column != 26 || imageLines[0].UTF16Column != 24 {
+		t.Fatalf("Got %+v. Expected 'postgres:12' at byte column 26 and UTF-16 column 24.", imageLines)
+	}
+}
+
+// checkLocation fails unless imLine's location has text and points at it.
+func checkLocation(t *testing.T, imLine parsedImageLine, text string) {
+	t.Helper()
+	location := imLine.location
+	if location.file != imLine.fileName() || location.line == 0 || location.text != text {
+		t.Fatalf("Got %+v. Expected '%s' to be located in '%s'.", location, text, imLine.fileName())
+	}
+	src, err := ioutil.ReadFile(location.file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineStart := strings.LastIndexByte(string(src[:location.offset]), '\n') + 1
+	if string(src[location.offset:location.offset+len(text)]) != text ||
+		strings.Count(string(src[:location.offset]), "\n")+1 != location.line ||
+		location.offset-lineStart+1 != location.column {
+		t.Fatalf("Got %+v. Expected it to point at '%s'.", location, text)
+	}
+}
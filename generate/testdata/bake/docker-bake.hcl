@@ -0,0 +1,47 @@
+// Bake file covering variables, inheritance, groups and named contexts.
+variable "NODE_VERSION" {
+  default = "12"
+}
+
+variable "BASE" {
+  default = "node:${NODE_VERSION}"
+}
+
+group "default" {
+  targets = ["app", "docs"]
+}
+
+target "_common" {
+  context = "app"
+  args = {
+    BASE_IMAGE = BASE
+  }
+}
+
+target "app" {
+  inherits = ["_common"]
+  contexts = {
+    tools = "target:tools"
+    # FROM alpine uses the image of the named context.
+    alpine = "docker-image://alpine:3.12"
+  }
+}
+
+target "tools" {
+  dockerfile-inline = <<-EOT
+    FROM busybox
+  EOT
+}
+
+target "docs" {
+  context    = "app"
+  dockerfile = "Dockerfile.docs"
+  contexts = {
+    src = "."
+  }
+}
+
+/* Targets that are not in the default group are only locked if named. */
+target "remote" {
+  context = "https://github.com/docker/buildx.git"
+}
@@ -0,0 +1,18 @@
+# Targets whose named contexts use the same image.
+target "app" {
+  dockerfile-inline = "FROM base"
+  contexts = {
+    base = "docker-image://alpine:3.12"
+  }
+}
+
+target "docs" {
+  dockerfile-inline = "FROM base"
+  contexts = {
+    base = "docker-image://alpine:3.12"
+  }
+}
+
+target "child" {
+  inherits = ["docs"]
+}
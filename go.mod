@@ -1,8 +1,12 @@
 module github.com/michaelperel/docker-lock
 
-go 1.12
+go 1.16
 
 require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/hashicorp/hcl/v2 v2.12.0
 	github.com/joho/godotenv v1.3.0
+	github.com/zclconf/go-cty v1.8.0
 	gopkg.in/yaml.v2 v2.2.2
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,48 @@
+package lint
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+// Flags has generate's flags, which select the files to lint, and the
+// Lockfile, Outfile, whose entries are linted too if it exists.
+type Flags struct {
+	generate.Flags
+	PolicyFile string
+	Policy     *Policy
+	Format     string
+}
+
+func NewFlags(cmdLineArgs []string) (*Flags, error) {
+	var policyFile string
+	var format string
+	command := flag.NewFlagSet("lint", flag.ExitOnError)
+	generateFlags := generate.AddFlags(command)
+	command.StringVar(&policyFile, "policy", ".docker-lock-policy.json", "Path to JSON file of policy rules.")
+	command.StringVar(&format, "format", "text", "Output format, 'text', 'json' or 'sarif'.")
+	command.Parse(cmdLineArgs)
+	if format != "text" && format != "json" && format != "sarif" {
+		return nil, fmt.Errorf("Unsupported format '%s'. Expected 'text', 'json' or 'sarif'.", format)
+	}
+	gFlags, err := generateFlags()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(policyFile); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("Policy file '%s' does not exist.", policyFile)
+	}
+	policy, err := LoadPolicy(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Flags{Flags: *gFlags,
+		PolicyFile: policyFile,
+		Policy:     policy,
+		Format:     format,
+	}, nil
+}
@@ -0,0 +1,34 @@
+package lint
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyFile(t *testing.T) {
+	f, err := NewFlags([]string{"-policy", filepath.Join("testdata", "policy.json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Format != "text" {
+		t.Fatalf("Got '%s' format. Expected 'text'.", f.Format)
+	}
+	if f.Outfile != "docker-lock.json" {
+		t.Fatalf("Got '%s' outfile. Expected 'docker-lock.json'.", f.Outfile)
+	}
+	if len(f.Policy.Rules) != 3 || f.Policy.Rules[0].Severity != "error" {
+		t.Fatalf("Got %+v. Expected 3 rules, defaulting to severity 'error'.", f.Policy.Rules)
+	}
+}
+
+func TestMissingPolicyFile(t *testing.T) {
+	if _, err := NewFlags([]string{}); err == nil {
+		t.Fatal("Missing policy file should fail.")
+	}
+}
+
+func TestFaultyFormat(t *testing.T) {
+	if _, err := NewFlags([]string{"-policy", filepath.Join("testdata", "policy.json"), "-format", "xml"}); err == nil {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
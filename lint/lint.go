@@ -0,0 +1,327 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/sarif"
+)
+
+// Linter checks the images in a Generator's files, and the entries of a
+// Lockfile, against a Policy.
+type Linter struct {
+	*generate.Generator
+	Policy *Policy
+	// Lockfile's entries are also checked, unless it is nil. Violations in
+	// it are reported in LockfilePath.
+	Lockfile     *generate.Lockfile
+	LockfilePath string
+}
+
+// Violation's Line and Column are 0 if the position of Image in File is
+// unknown.
+type Violation struct {
+	RuleID   string `json:"ruleId"`
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Image    string `json:"image"`
+	Message  string `json:"message"`
+	// utf16Column is Column counted in UTF-16 code units, as in SARIF.
+	utf16Column int
+}
+
+type Report struct {
+	Violations []Violation `json:"violations"`
+	rules      []Rule
+}
+
+// reference is an image as written, such as 'ubuntu:18.04@sha256:<hex>'.
+type reference struct {
+	name   string
+	tag    string
+	digest string
+}
+
+func NewLinter(flags *Flags) (*Linter, error) {
+	g, err := generate.NewGenerator(&flags.Flags)
+	if err != nil {
+		return nil, err
+	}
+	l := &Linter{Generator: g, Policy: flags.Policy}
+	if _, err := os.Stat(flags.Outfile); err == nil {
+		if l.Lockfile, err = generate.ReadLockfile(flags.Outfile, flags.LockfileFormat); err != nil {
+			return nil, err
+		}
+		l.LockfilePath = flags.Outfile
+	}
+	return l, nil
+}
+
+// Lint parses the Generator's files and reports every image that breaks a
+// rule of the Policy. An image in the Lockfile is not reported again for a
+// rule that the image it was locked from breaks.
+func (l *Linter) Lint() (*Report, error) {
+	imageLines, err := l.ImageLines()
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{rules: l.Policy.Rules}
+	reported := make(map[string]bool)
+	for _, imageLine := range imageLines {
+		if imageLine.Image == "" {
+			continue
+		}
+		ref := parseReference(imageLine.Image)
+		for i := range l.Policy.Rules {
+			rule := &l.Policy.Rules[i]
+			if !rule.applies(imageLine.Section, imageLine.File) {
+				continue
+			}
+			message := rule.check(imageLine.Image, ref, true)
+			if message == "" {
+				continue
+			}
+			reported[rule.ID+"\x00"+imageLine.SectionFile+"\x00"+ref.name+":"+ref.tag] = true
+			report.Violations = append(report.Violations, Violation{RuleID: rule.ID,
+				Severity:    rule.Severity,
+				File:        imageLine.File,
+				Line:        imageLine.Line,
+				Column:      imageLine.Column,
+				Image:       imageLine.Image,
+				Message:     message,
+				utf16Column: imageLine.UTF16Column,
+			})
+		}
+	}
+	for _, entry := range lockfileEntries(l.Lockfile) {
+		for i := range l.Policy.Rules {
+			rule := &l.Policy.Rules[i]
+			if !rule.applies(entry.section, entry.file) {
+				continue
+			}
+			if reported[rule.ID+"\x00"+entry.file+"\x00"+entry.ref.name+":"+entry.ref.tag] {
+				continue
+			}
+			message := rule.check(entry.image, entry.ref, false)
+			if message == "" {
+				continue
+			}
+			report.Violations = append(report.Violations, Violation{RuleID: rule.ID,
+				Severity: rule.Severity,
+				File:     l.LockfilePath,
+				Image:    entry.image,
+				Message:  fmt.Sprintf("%s Locked for '%s'.", message, entry.file),
+			})
+		}
+	}
+	sort.SliceStable(report.Violations, func(i, j int) bool {
+		a, b := report.Violations[i], report.Violations[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return report, nil
+}
+
+// check returns why image breaks the rule, or "" if it does not. Digests
+// are only required of images as written, as the Lockfile always has them.
+func (r *Rule) check(image string, ref reference, written bool) string {
+	switch r.Type {
+	case "allowed-registries":
+		host := registryHost(ref.name)
+		for _, pattern := range r.Registries {
+			if matches(strings.ToLower(pattern), host) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("Image '%s' is from registry '%s', which is not allowed.", image, host)
+	case "forbidden-tags":
+		if ref.tag == "" {
+			return ""
+		}
+		for _, pattern := range r.Tags {
+			if matches(pattern, ref.tag) {
+				return fmt.Sprintf("Image '%s' uses forbidden tag '%s'.", image, ref.tag)
+			}
+		}
+	case "require-digest":
+		if written && ref.digest == "" {
+			return fmt.Sprintf("Image '%s' is not pinned to a digest.", image)
+		}
+	}
+	return ""
+}
+
+// parseReference splits image as generate does. An image without a tag or
+// digest uses 'latest'.
+func parseReference(image string) reference {
+	var ref reference
+	if i := strings.Index(image, "@"); i != -1 {
+		ref.digest = strings.TrimPrefix(image[i+1:], "sha256:")
+		image = image[:i]
+	}
+	ref.name = image
+	if i := strings.LastIndex(image, ":"); i != -1 && !strings.Contains(image[i:], "/") {
+		ref.name, ref.tag = image[:i], image[i+1:]
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = "latest"
+	}
+	return ref
+}
+
+// registryHost returns the registry of name, such as 'mcr.microsoft.com' or
+// 'docker.io'. As in docker, the first component of name is only a host if
+// it contains a '.' or a ':', or is 'localhost'.
+func registryHost(name string) string {
+	i := strings.Index(name, "/")
+	if i == -1 {
+		return "docker.io"
+	}
+	host := name[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "docker.io"
+	}
+	if host == "index.docker.io" || host == "registry-1.docker.io" {
+		return "docker.io"
+	}
+	return strings.ToLower(host)
+}
+
+type lockfileEntry struct {
+	section string
+	file    string
+	image   string
+	ref     reference
+}
+
+func lockfileEntries(lFile *generate.Lockfile) []lockfileEntry {
+	if lFile == nil {
+		return nil
+	}
+	var entries []lockfileEntry
+	add := func(section string, file string, image generate.Image) {
+		entry := lockfileEntry{section: section,
+			file: file,
+			ref:  reference{name: image.Name, tag: image.LockedTag(), digest: image.Digest},
+		}
+		entry.image = image.Name
+		if tag := image.LockedTag(); tag != "" {
+			entry.image += ":" + tag
+		}
+		if image.Digest != "" {
+			entry.image += "@sha256:" + image.Digest
+		}
+		entries = append(entries, entry)
+	}
+	for file, images := range lFile.DockerfileImages {
+		for _, image := range images {
+			add("dockerfiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.ComposefileImages {
+		for _, image := range images {
+			add("composefiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.KubernetesfileImages {
+		for _, image := range images {
+			add("kubernetesfiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.CIfileImages {
+		for _, image := range images {
+			add("cifiles", file, image.Image)
+		}
+	}
+	for file, images := range lFile.BakefileImages {
+		for _, image := range images {
+			add("bakefiles", file, image.Image)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].section != entries[j].section {
+			return entries[i].section < entries[j].section
+		}
+		return entries[i].file < entries[j].file
+	})
+	return entries
+}
+
+// Err returns an error if the report has a violation of a rule whose
+// severity is 'error'.
+func (r *Report) Err() error {
+	var errs int
+	for _, violation := range r.Violations {
+		if violation.Severity == "error" {
+			errs++
+		}
+	}
+	if errs == 0 {
+		return nil
+	}
+	return fmt.Errorf("Found %d policy violations.", errs)
+}
+
+// Write writes the report as text, JSON or SARIF, depending on format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		rByt, err := json.MarshalIndent(r, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(rByt, '\n'))
+		return err
+	case "sarif":
+		rules := make([]sarif.Rule, len(r.rules))
+		for i, rule := range r.rules {
+			rules[i] = sarif.Rule{ID: rule.ID, ShortDescription: &sarif.Message{Text: ruleDescription(rule)}}
+		}
+		results := make([]sarif.Result, len(r.Violations))
+		for i, violation := range r.Violations {
+			results[i] = sarif.Result{RuleID: violation.RuleID,
+				Level:     violation.Severity,
+				Message:   sarif.Message{Text: violation.Message},
+				Locations: []sarif.Location{sarif.NewLocation(violation.File, violation.Line, violation.utf16Column)},
+			}
+		}
+		return sarif.NewLog(rules, results).Write(w)
+	case "text":
+		for _, violation := range r.Violations {
+			location := violation.File
+			if violation.Line != 0 {
+				location = fmt.Sprintf("%s:%d", location, violation.Line)
+				if violation.Column != 0 {
+					location = fmt.Sprintf("%s:%d", location, violation.Column)
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%s: %s: [%s] %s\n", location, violation.Severity, violation.RuleID, violation.Message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Unsupported format '%s'. Expected 'text', 'json' or 'sarif'.", format)
+}
+
+func ruleDescription(rule Rule) string {
+	switch rule.Type {
+	case "allowed-registries":
+		return fmt.Sprintf("Images must come from '%s'.", strings.Join(rule.Registries, "', '"))
+	case "forbidden-tags":
+		return fmt.Sprintf("Images must not use tags '%s'.", strings.Join(rule.Tags, "', '"))
+	}
+	return "Images must be pinned to a digest."
+}
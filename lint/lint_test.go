@@ -0,0 +1,147 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/sarif"
+)
+
+func testLinter(t *testing.T) *Linter {
+	fsys := fstest.MapFS{
+		"Dockerfile":         {Data: []byte("FROM ubuntu:18.04@sha256:9b1702dcfe32c873a770a32cfd306dd7fc1c4fd134adfb783db68defc8894b3c\nFROM myregistry.azurecr.io/app:1.0\n\nFROM busybox\n")},
+		"docker-compose.yml": {Data: []byte("services:\n  db:\n    image: mcr.microsoft.com/mssql/server:latest\n")},
+	}
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(filepath.Join("testdata", "policy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Linter{Generator: g, Policy: policy}
+}
+
+func TestLint(t *testing.T) {
+	l := testLinter(t)
+	l.LockfilePath = "docker-lock.json"
+	l.Lockfile = &generate.Lockfile{
+		DockerfileImages: map[string][]generate.DockerfileImage{
+			"Dockerfile": {
+				{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "9b1702dcfe32c873a770a32cfd306dd7fc1c4fd134adfb783db68defc8894b3c"}},
+				{Image: generate.Image{Name: "myregistry.azurecr.io/app", Tag: "1.0", Digest: "abc"}},
+				{Image: generate.Image{Name: "busybox", Tag: "latest", Digest: "def"}},
+			},
+		},
+		KubernetesfileImages: map[string][]generate.KubernetesfileImage{
+			"k8s/app.yaml": {
+				{Image: generate.Image{Name: "nginx", Tag: "latest", Digest: "123"}},
+			},
+		},
+	}
+	report, err := l.Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Violation{
+		{RuleID: "allowed-registries", Severity: "error", File: "Dockerfile", Line: 2, Column: 6, Image: "myregistry.azurecr.io/app:1.0",
+			Message: "Image 'myregistry.azurecr.io/app:1.0' is from registry 'myregistry.azurecr.io', which is not allowed.", utf16Column: 6},
+		{RuleID: "pinned-from", Severity: "warning", File: "Dockerfile", Line: 2, Column: 6, Image: "myregistry.azurecr.io/app:1.0",
+			Message: "Image 'myregistry.azurecr.io/app:1.0' is not pinned to a digest.", utf16Column: 6},
+		{RuleID: "no-latest", Severity: "error", File: "Dockerfile", Line: 4, Column: 6, Image: "busybox",
+			Message: "Image 'busybox' uses forbidden tag 'latest'.", utf16Column: 6},
+		{RuleID: "pinned-from", Severity: "warning", File: "Dockerfile", Line: 4, Column: 6, Image: "busybox",
+			Message: "Image 'busybox' is not pinned to a digest.", utf16Column: 6},
+		{RuleID: "no-latest", Severity: "error", File: "docker-compose.yml", Line: 3, Column: 12, Image: "mcr.microsoft.com/mssql/server:latest",
+			Message: "Image 'mcr.microsoft.com/mssql/server:latest' uses forbidden tag 'latest'.", utf16Column: 12},
+		{RuleID: "no-latest", Severity: "error", File: "docker-lock.json", Image: "nginx:latest@sha256:123",
+			Message: "Image 'nginx:latest@sha256:123' uses forbidden tag 'latest'. Locked for 'k8s/app.yaml'."},
+	}
+	if !reflect.DeepEqual(report.Violations, expected) {
+		t.Fatalf("Got %+v. Expected %+v.", report.Violations, expected)
+	}
+	if err := report.Err(); err == nil {
+		t.Fatal("Violations of rules with severity 'error' should fail.")
+	}
+}
+
+func TestLintSARIFColumn(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docker-compose.yml": {Data: []byte("services:\n  db: {x: \"🐳\", image: busybox:latest}\n")},
+	}
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(filepath.Join("testdata", "policy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := (&Linter{Generator: g, Policy: policy}).Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sarifOutput bytes.Buffer
+	if err := report.Write(&sarifOutput, "sarif"); err != nil {
+		t.Fatal(err)
+	}
+	var log sarif.Log
+	if err := json.Unmarshal(sarifOutput.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Runs[0].Results) == 0 {
+		t.Fatal("Got no results. Expected a violation of 'no-latest'.")
+	}
+	// The emoji is 4 bytes, but 2 UTF-16 code units.
+	region := log.Runs[0].Results[0].Locations[0].PhysicalLocation.Region
+	if report.Violations[0].Column != 26 || region == nil || region.StartColumn != 24 {
+		t.Fatalf("Got column %d and region %+v. Expected byte column 26 and SARIF column 24.", report.Violations[0].Column, region)
+	}
+}
+
+func TestReportWrite(t *testing.T) {
+	report, err := testLinter(t).Lint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text bytes.Buffer
+	if err := report.Write(&text, "text"); err != nil {
+		t.Fatal(err)
+	}
+	expectedLine := "Dockerfile:2:6: error: [allowed-registries] Image 'myregistry.azurecr.io/app:1.0' is from registry 'myregistry.azurecr.io', which is not allowed.\n"
+	if !bytes.HasPrefix(text.Bytes(), []byte(expectedLine)) {
+		t.Fatalf("Got '%s'. Expected it to start with '%s'.", text.String(), expectedLine)
+	}
+	var sarifOutput bytes.Buffer
+	if err := report.Write(&sarifOutput, "sarif"); err != nil {
+		t.Fatal(err)
+	}
+	var log sarif.Log
+	if err := json.Unmarshal(sarifOutput.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != 3 {
+		t.Fatalf("Got %+v. Expected a run with 3 rules.", log)
+	}
+	results := log.Runs[0].Results
+	if len(results) != len(report.Violations) {
+		t.Fatalf("Got %d results. Expected %d.", len(results), len(report.Violations))
+	}
+	location := results[0].Locations[0].PhysicalLocation
+	if location.ArtifactLocation != sarif.NewLocation("Dockerfile", 0, 0).PhysicalLocation.ArtifactLocation || location.Region == nil || location.Region.StartLine != 2 || location.Region.StartColumn != 6 {
+		t.Fatalf("Got %+v. Expected 'Dockerfile' at line 2, column 6.", location)
+	}
+	location = results[len(results)-1].Locations[0].PhysicalLocation
+	if location.ArtifactLocation != sarif.NewLocation("docker-compose.yml", 0, 0).PhysicalLocation.ArtifactLocation || location.Region == nil || location.Region.StartLine != 3 || location.Region.StartColumn != 12 {
+		t.Fatalf("Got %+v. Expected 'docker-compose.yml' at line 3, column 12.", location)
+	}
+	if err := report.Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
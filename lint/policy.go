@@ -0,0 +1,124 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+)
+
+// Policy is read from a JSON file of rules, such as:
+//
+//	{
+//		"rules": [
+//			{"id": "allowed-registries", "type": "allowed-registries", "registries": ["myregistry.azurecr.io", "mcr.microsoft.com"]},
+//			{"id": "no-latest", "type": "forbidden-tags", "tags": ["latest"]},
+//			{"id": "pinned-from", "type": "require-digest", "files": ["Dockerfile*"], "severity": "warning"}
+//		]
+//	}
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule's Type is one of:
+//   - "allowed-registries": images must come from one of Registries, which
+//     may be patterns such as '*.azurecr.io'. Docker Hub is 'docker.io'.
+//   - "forbidden-tags": images must not use one of Tags, which may be
+//     patterns such as '*-rc*'. An image without a tag or digest uses
+//     'latest'.
+//   - "require-digest": images must be written with a digest, such as
+//     'ubuntu@sha256:<hex>'.
+//
+// If Sections or Files are set, the rule only applies to images locked in
+// one of Sections, such as 'dockerfiles', or written in a file whose path
+// or base name matches one of Files. Severity is "error", the default, or
+// "warning".
+type Rule struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	Registries []string `json:"registries,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Sections   []string `json:"sections,omitempty"`
+	Files      []string `json:"files,omitempty"`
+	Severity   string   `json:"severity,omitempty"`
+}
+
+func LoadPolicy(fpath string) (*Policy, error) {
+	policyByt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(policyByt, &policy); err != nil {
+		return nil, fmt.Errorf("%s. From policy file: '%s'.", err, fpath)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("%s From policy file: '%s'.", err, fpath)
+	}
+	return &policy, nil
+}
+
+func (p *Policy) validate() error {
+	ids := make(map[string]bool)
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.ID == "" {
+			return fmt.Errorf("Rule %d has no id.", i)
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("Duplicate rule id '%s'.", rule.ID)
+		}
+		ids[rule.ID] = true
+		switch rule.Type {
+		case "allowed-registries", "forbidden-tags", "require-digest":
+		default:
+			return fmt.Errorf("Unknown type '%s' of rule '%s'. Expected 'allowed-registries', 'forbidden-tags' or 'require-digest'.", rule.Type, rule.ID)
+		}
+		switch rule.Severity {
+		case "":
+			rule.Severity = "error"
+		case "error", "warning":
+		default:
+			return fmt.Errorf("Unknown severity '%s' of rule '%s'. Expected 'error' or 'warning'.", rule.Severity, rule.ID)
+		}
+		for _, patterns := range [][]string{rule.Registries, rule.Tags, rule.Files} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("Invalid pattern '%s' of rule '%s'. %s.", pattern, rule.ID, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applies reports whether the rule applies to images in file, locked in
+// section.
+func (r *Rule) applies(section string, file string) bool {
+	if len(r.Sections) != 0 && !contains(r.Sections, section) {
+		return false
+	}
+	if len(r.Files) == 0 {
+		return true
+	}
+	for _, pattern := range r.Files {
+		if matches(pattern, file) || matches(pattern, path.Base(file)) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(pattern string, s string) bool {
+	ok, _ := path.Match(pattern, s)
+	return ok
+}
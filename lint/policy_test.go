@@ -0,0 +1,39 @@
+package lint
+
+import (
+	"testing"
+)
+
+func TestFaultyPolicy(t *testing.T) {
+	policies := map[string]Policy{
+		"no id":            {Rules: []Rule{{Type: "require-digest"}}},
+		"duplicate id":     {Rules: []Rule{{ID: "a", Type: "require-digest"}, {ID: "a", Type: "require-digest"}}},
+		"unknown type":     {Rules: []Rule{{ID: "a", Type: "forbidden-images"}}},
+		"unknown severity": {Rules: []Rule{{ID: "a", Type: "require-digest", Severity: "fatal"}}},
+		"invalid pattern":  {Rules: []Rule{{ID: "a", Type: "forbidden-tags", Tags: []string{"[latest"}}}},
+	}
+	for name, policy := range policies {
+		if err := policy.validate(); err == nil {
+			t.Fatalf("Policy with %s should fail.", name)
+		}
+	}
+}
+
+func TestRuleApplies(t *testing.T) {
+	rule := Rule{Sections: []string{"dockerfiles", "composefiles"}, Files: []string{"Dockerfile*"}}
+	tests := []struct {
+		section string
+		file    string
+		applies bool
+	}{
+		{"dockerfiles", "Dockerfile", true},
+		{"composefiles", "web/Dockerfile.prod", true},
+		{"composefiles", "docker-compose.yml", false},
+		{"kubernetesfiles", "Dockerfile", false},
+	}
+	for _, test := range tests {
+		if applies := rule.applies(test.section, test.file); applies != test.applies {
+			t.Fatalf("Got %t for '%s' in '%s'. Expected %t.", applies, test.file, test.section, test.applies)
+		}
+	}
+}
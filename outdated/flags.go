@@ -0,0 +1,64 @@
+package outdated
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+type Flags struct {
+	Outfile            string
+	ConfigFile         string
+	RegistryConfigFile string
+	Format             string
+	// LockfileFormat is the name of the Lockfile's format, such as 'yaml'.
+	// If empty, the format is chosen by Outfile's extension.
+	LockfileFormat string
+}
+
+func NewFlags(cmdLineArgs []string) (*Flags, error) {
+	var outfile string
+	var configFile string
+	var registryConfigFile string
+	var format string
+	var lockfileFormat string
+	command := flag.NewFlagSet("outdated", flag.ExitOnError)
+	command.StringVar(&outfile, "o", "docker-lock.json", "Path to Lockfile from current directory.")
+	command.StringVar(&lockfileFormat, "lockfile-format", "", "Format of the Lockfile, 'json', 'yaml' or 'toml'. Defaults to the format of the Lockfile's extension, or 'json'.")
+	command.StringVar(&configFile, "c", "", "Path to config file for auth credentials.")
+	command.StringVar(&registryConfigFile, "registry-config", "", "Path to config file declaring registries. Defaults to .docker-lock-registries.json, if it exists.")
+	command.StringVar(&format, "format", "table", "Output format, 'table' or 'json'.")
+	command.Parse(cmdLineArgs)
+	if format != "table" && format != "json" {
+		return nil, fmt.Errorf("Unsupported format '%s'. Expected 'table' or 'json'.", format)
+	}
+	if _, err := generate.GetLockfileFormat(lockfileFormat, outfile); err != nil {
+		return nil, err
+	}
+	if configFile != "" {
+		if _, err := os.Stat(configFile); err != nil {
+			return nil, err
+		}
+	} else if homeDir, err := os.UserHomeDir(); err == nil {
+		defaultConfig := filepath.Join(homeDir, ".docker", "config.json")
+		if _, err := os.Stat(defaultConfig); err == nil {
+			configFile = defaultConfig
+		}
+	}
+	if registryConfigFile != "" {
+		if _, err := os.Stat(registryConfigFile); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(".docker-lock-registries.json"); err == nil {
+		registryConfigFile = ".docker-lock-registries.json"
+	}
+	return &Flags{Outfile: outfile,
+		ConfigFile:         configFile,
+		RegistryConfigFile: registryConfigFile,
+		Format:             format,
+		LockfileFormat:     lockfileFormat,
+	}, nil
+}
@@ -0,0 +1,24 @@
+package outdated
+
+import (
+	"testing"
+)
+
+func TestDefaults(t *testing.T) {
+	f, err := NewFlags([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Outfile != "docker-lock.json" {
+		t.Fatalf("Got '%s' outfile. Expected 'docker-lock.json'.", f.Outfile)
+	}
+	if f.Format != "table" {
+		t.Fatalf("Got '%s' format. Expected 'table'.", f.Format)
+	}
+}
+
+func TestFaultyFormat(t *testing.T) {
+	if _, err := NewFlags([]string{"-format", "xml"}); err == nil {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
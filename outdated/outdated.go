@@ -0,0 +1,204 @@
+package outdated
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/registry"
+	"github.com/michaelperel/docker-lock/semver"
+)
+
+// Checker finds newer tags for the images in a Lockfile.
+type Checker struct {
+	*generate.Lockfile
+}
+
+// Image reports the newest tags of an image that are newer than Tag.
+// Patch has the same major and minor version as Tag, Minor the same major
+// version, and Major a greater major version. Tags are only compared to
+// tags with the same number of parts and variant, so that '3.6' is
+// compared to '3.8' but not to '3.8.5' or '3.8-alpine'.
+type Image struct {
+	Name  string   `json:"name"`
+	Tag   string   `json:"tag"`
+	Files []string `json:"files"`
+	Patch string   `json:"patch,omitempty"`
+	Minor string   `json:"minor,omitempty"`
+	Major string   `json:"major,omitempty"`
+}
+
+type Report struct {
+	Images []Image `json:"images"`
+}
+
+type imageResult struct {
+	image Image
+	err   error
+}
+
+func NewChecker(flags *Flags) (*Checker, error) {
+	lFile, err := generate.ReadLockfile(flags.Outfile, flags.LockfileFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &Checker{Lockfile: lFile}, nil
+}
+
+// Check lists the tags of every image in the Lockfile with a semver tag,
+// reporting the images that have newer tags.
+func (c *Checker) Check(wrapperManager *registry.WrapperManager) (*Report, error) {
+	images := make(map[generate.Image][]string)
+	for fpath, dImages := range c.DockerfileImages {
+		for _, dImage := range dImages {
+			addImage(images, dImage.Image, fpath)
+		}
+	}
+	for fpath, cImages := range c.ComposefileImages {
+		for _, cImage := range cImages {
+			addImage(images, cImage.Image, fpath)
+		}
+	}
+	for fpath, kImages := range c.KubernetesfileImages {
+		for _, kImage := range kImages {
+			addImage(images, kImage.Image, fpath)
+		}
+	}
+	for fpath, ciImages := range c.CIfileImages {
+		for _, ciImage := range ciImages {
+			addImage(images, ciImage.Image, fpath)
+		}
+	}
+	for fpath, bImages := range c.BakefileImages {
+		for _, bImage := range bImages {
+			addImage(images, bImage.Image, fpath)
+		}
+	}
+	imageResults := make(chan imageResult)
+	for image, fpaths := range images {
+		go checkImage(image, fpaths, wrapperManager, imageResults)
+	}
+	report := &Report{Images: []Image{}}
+	var err error
+	for i := 0; i < len(images); i++ {
+		result := <-imageResults
+		if result.err != nil {
+			err = result.err
+			continue
+		}
+		if result.image.Patch != "" || result.image.Minor != "" || result.image.Major != "" {
+			report.Images = append(report.Images, result.image)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(report.Images, func(i, j int) bool {
+		if report.Images[i].Name != report.Images[j].Name {
+			return report.Images[i].Name < report.Images[j].Name
+		}
+		return report.Images[i].Tag < report.Images[j].Tag
+	})
+	return report, nil
+}
+
+func addImage(images map[generate.Image][]string, image generate.Image, fpath string) {
+	if _, err := semver.Parse(image.LockedTag()); err != nil {
+		return
+	}
+	key := generate.Image{Name: image.Name, Tag: image.LockedTag()}
+	for _, f := range images[key] {
+		if f == fpath {
+			return
+		}
+	}
+	images[key] = append(images[key], fpath)
+}
+
+func checkImage(image generate.Image, fpaths []string, wrapperManager *registry.WrapperManager, imageResults chan<- imageResult) {
+	sort.Strings(fpaths)
+	tags, err := wrapperManager.GetWrapper(image.Name).GetTags(image.Name)
+	if err != nil {
+		imageResults <- imageResult{err: fmt.Errorf("%s. From image: '%s'.", err, image.Name)}
+		return
+	}
+	result := Image{Name: image.Name, Tag: image.Tag, Files: fpaths}
+	result.Patch, result.Minor, result.Major = newerTags(image.Tag, tags)
+	imageResults <- imageResult{image: result}
+}
+
+// newerTags returns the newest patch, minor and major versions after tag.
+func newerTags(tag string, tags []string) (string, string, string) {
+	current, err := semver.Parse(tag)
+	if err != nil {
+		return "", "", ""
+	}
+	var patch, minor, major *semver.Version
+	for _, t := range tags {
+		v, err := semver.Parse(t)
+		if err != nil || v.Prerelease != current.Prerelease || strings.Count(t, ".") != strings.Count(tag, ".") || v.Compare(current) <= 0 {
+			continue
+		}
+		switch {
+		case v.Major != current.Major:
+			major = newer(major, v)
+		case v.Minor != current.Minor:
+			minor = newer(minor, v)
+		default:
+			patch = newer(patch, v)
+		}
+	}
+	return versionString(patch), versionString(minor), versionString(major)
+}
+
+func newer(a *semver.Version, b *semver.Version) *semver.Version {
+	if a == nil || b.Compare(a) > 0 {
+		return b
+	}
+	return a
+}
+
+func versionString(v *semver.Version) string {
+	if v == nil {
+		return ""
+	}
+	return v.String()
+}
+
+// Write writes the report as a table or as JSON, depending on format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		rByt, err := json.MarshalIndent(r, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(rByt, '\n'))
+		return err
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "IMAGE\tTAG\tPATCH\tMINOR\tMAJOR\tFILES")
+		for _, image := range r.Images {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				image.Name,
+				image.Tag,
+				orDash(image.Patch),
+				orDash(image.Minor),
+				orDash(image.Major),
+				strings.Join(image.Files, ","))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("Unsupported format '%s'. Expected 'table' or 'json'.", format)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
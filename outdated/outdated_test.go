@@ -0,0 +1,86 @@
+package outdated
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/michaelperel/docker-lock/registry"
+)
+
+type mockWrapper struct {
+	tags map[string][]string
+}
+
+func (w *mockWrapper) GetDigest(name string, tag string) (string, error) {
+	return "", nil
+}
+
+func (w *mockWrapper) GetTags(name string) ([]string, error) {
+	return w.tags[name], nil
+}
+
+func (w *mockWrapper) Prefix() string {
+	return ""
+}
+
+var tags = map[string][]string{
+	"python":   {"3.6", "3.6.12", "3.7", "3.8", "3.8.5", "3.8-alpine", "3.9.0-rc1", "latest"},
+	"node":     {"12.18.3-alpine", "12.18.4-alpine", "12.19.0", "12.20.0-alpine", "14.4.0-alpine", "14.5.0"},
+	"ubuntu":   {"latest", "20.04"},
+	"postgres": {"12.4", "12.5"},
+}
+
+func TestCheck(t *testing.T) {
+	flags := &Flags{Outfile: filepath.Join("testdata", "docker-lock.json")}
+	c, err := NewChecker(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.Check(registry.NewWrapperManager(&mockWrapper{tags: tags}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Image{
+		{Name: "node", Tag: "12.18.3-alpine", Files: []string{"Dockerfile"}, Patch: "12.18.4-alpine", Minor: "12.20.0-alpine", Major: "14.4.0-alpine"},
+		{Name: "postgres", Tag: "12.4", Files: []string{"docker-compose.yml"}, Minor: "12.5"},
+		{Name: "python", Tag: "3.6", Files: []string{"Dockerfile", "api/Dockerfile"}, Minor: "3.8"},
+	}
+	if !reflect.DeepEqual(report.Images, expected) {
+		t.Fatalf("Got %+v. Expected %+v.", report.Images, expected)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	report := &Report{Images: []Image{
+		{Name: "python", Tag: "3.6", Files: []string{"Dockerfile"}, Minor: "3.8"},
+	}}
+	var table bytes.Buffer
+	if err := report.Write(&table, "table"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "IMAGE") {
+		t.Fatalf("Got table '%s'.", table.String())
+	}
+	if fields := strings.Fields(lines[1]); !reflect.DeepEqual(fields, []string{"python", "3.6", "-", "3.8", "-", "Dockerfile"}) {
+		t.Fatalf("Got row '%v'.", fields)
+	}
+	var jsonOut bytes.Buffer
+	if err := report.Write(&jsonOut, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(jsonOut.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, report) {
+		t.Fatalf("Got %+v. Expected %+v.", decoded, report)
+	}
+	if err := report.Write(&jsonOut, "xml"); err == nil {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxArtifactSize limits the manifests and blobs read by GetManifest and
+// GetBlob, which are meant for small artifacts such as signatures.
+const maxArtifactSize = 4 << 20
+
+// ArtifactWrapper is implemented by wrappers that can fetch the manifests
+// and blobs of artifacts stored next to images, such as cosign signatures,
+// which are tagged 'sha256-<hex>.sig'.
+type ArtifactWrapper interface {
+	// GetManifest returns the manifest of name with reference, a tag or a
+	// digest.
+	GetManifest(name string, reference string) ([]byte, error)
+	// GetBlob returns the blob of name with digest, such as
+	// 'sha256:<hex>'. The blob's contents are checked against digest.
+	GetBlob(name string, digest string) ([]byte, error)
+}
+
+func (w *V2Wrapper) GetManifest(name string, reference string) ([]byte, error) {
+	_, repo := splitImageName(name)
+	if w.lowercase {
+		repo = strings.ToLower(repo)
+	}
+	return w.client.getManifest(w.registryHost(name), repo, reference)
+}
+
+func (w *V2Wrapper) GetBlob(name string, digest string) ([]byte, error) {
+	_, repo := splitImageName(name)
+	if w.lowercase {
+		repo = strings.ToLower(repo)
+	}
+	return w.client.getBlob(w.registryHost(name), repo, digest)
+}
+
+func (w *DockerWrapper) GetManifest(name string, reference string) ([]byte, error) {
+	if !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	client, err := w.v2Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.getManifest(w.registryHost(), name, reference)
+}
+
+func (w *DockerWrapper) GetBlob(name string, digest string) ([]byte, error) {
+	if !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	client, err := w.v2Client()
+	if err != nil {
+		return nil, err
+	}
+	return client.getBlob(w.registryHost(), name, digest)
+}
+
+func (w *MCRWrapper) GetManifest(name string, reference string) ([]byte, error) {
+	prefix := w.Prefix()
+	return w.v2Client().getManifest(strings.TrimSuffix(prefix, "/"), strings.Replace(name, prefix, "", 1), reference)
+}
+
+func (w *MCRWrapper) GetBlob(name string, digest string) ([]byte, error) {
+	prefix := w.Prefix()
+	return w.v2Client().getBlob(strings.TrimSuffix(prefix, "/"), strings.Replace(name, prefix, "", 1), digest)
+}
+
+func (w *ElasticWrapper) GetManifest(name string, reference string) ([]byte, error) {
+	prefix := w.Prefix()
+	return w.v2Client().getManifest(strings.TrimSuffix(prefix, "/"), strings.Replace(name, prefix, "", 1), reference)
+}
+
+func (w *ElasticWrapper) GetBlob(name string, digest string) ([]byte, error) {
+	prefix := w.Prefix()
+	return w.v2Client().getBlob(strings.TrimSuffix(prefix, "/"), strings.Replace(name, prefix, "", 1), digest)
+}
+
+// GetManifest fetches artifacts from upstream rather than from mirrors,
+// which may not serve them.
+func (w *MirrorWrapper) GetManifest(name string, reference string) ([]byte, error) {
+	upstream, ok := w.Wrapper.(ArtifactWrapper)
+	if !ok {
+		return nil, fmt.Errorf("Registry of '%s' does not support fetching artifacts.", name)
+	}
+	return upstream.GetManifest(name, reference)
+}
+
+func (w *MirrorWrapper) GetBlob(name string, digest string) ([]byte, error) {
+	upstream, ok := w.Wrapper.(ArtifactWrapper)
+	if !ok {
+		return nil, fmt.Errorf("Registry of '%s' does not support fetching artifacts.", name)
+	}
+	return upstream.GetBlob(name, digest)
+}
+
+func (c *v2Client) getManifest(host string, repo string, reference string) ([]byte, error) {
+	return c.getArtifact(c.scheme+"://"+host+"/v2/"+repo+"/manifests/"+reference, repo, manifestMediaTypes)
+}
+
+func (c *v2Client) getBlob(host string, repo string, digest string) ([]byte, error) {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, fmt.Errorf("Unsupported digest '%s'.", digest)
+	}
+	byt, err := c.getArtifact(c.scheme+"://"+host+"/v2/"+repo+"/blobs/"+digest, repo, nil)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(byt)
+	if found := "sha256:" + hex.EncodeToString(sum[:]); found != digest {
+		return nil, fmt.Errorf("Blob of '%s' has digest '%s'. Expected '%s'.", repo, found, digest)
+	}
+	return byt, nil
+}
+
+func (c *v2Client) getArtifact(artifactURL string, repo string, accept []string) ([]byte, error) {
+	resp, err := c.get(artifactURL, repo, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status '%s' from '%s'.", resp.Status, artifactURL)
+	}
+	byt, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxArtifactSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(byt) > maxArtifactSize {
+		return nil, fmt.Errorf("Artifact from '%s' exceeds %d bytes.", artifactURL, maxArtifactSize)
+	}
+	return byt, nil
+}
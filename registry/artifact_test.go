@@ -0,0 +1,75 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestGetArtifacts(t *testing.T) {
+	blob := []byte(`{"critical":{}}`)
+	sum := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	r := newTestRegistry(t, nil)
+	r.username, r.password, r.bearer = "user", "secret", true
+	r.artifacts = map[string][]byte{
+		"team/app/manifests/sha256-abc.sig": []byte(`{"layers":[]}`),
+		"team/app/blobs/" + digest:          blob,
+		"team/app/blobs/sha256:tampered":    blob,
+	}
+	w, err := NewV2Wrapper(RegistryConfig{Host: r.host(),
+		Auth:     AuthConfig{Type: "basic", Username: "user", Password: "secret"},
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ ArtifactWrapper = w
+	manifest, err := w.GetManifest(r.host()+"/team/app", "sha256-abc.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(manifest) != `{"layers":[]}` {
+		t.Fatalf("Got '%s'. Expected the signature manifest.", manifest)
+	}
+	if _, err := w.GetManifest(r.host()+"/team/app", "sha256-def.sig"); err == nil {
+		t.Fatal("Missing manifest should fail.")
+	}
+	got, err := w.GetBlob(r.host()+"/team/app", digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(blob) {
+		t.Fatalf("Got '%s'. Expected '%s'.", got, blob)
+	}
+	if _, err := w.GetBlob(r.host()+"/team/app", "sha256:tampered"); err == nil {
+		t.Fatal("Blob that does not match its digest should fail.")
+	}
+}
+
+func TestDockerWrapperArtifacts(t *testing.T) {
+	blob := []byte(`{"critical":{}}`)
+	sum := sha256.Sum256(blob)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	r := newTestRegistry(t, nil)
+	r.bearer = true
+	r.artifacts = map[string][]byte{
+		"library/ubuntu/manifests/sha256-abc.sig": []byte(`{"layers":[]}`),
+		"library/ubuntu/blobs/" + digest:          blob,
+	}
+	w := &DockerWrapper{Client: r.Client(), host: r.host(), realm: r.URL + "/token"}
+	manifest, err := w.GetManifest("ubuntu", "sha256-abc.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(manifest) != `{"layers":[]}` {
+		t.Fatalf("Got '%s'. Expected the signature manifest.", manifest)
+	}
+	got, err := w.GetBlob("ubuntu", digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(blob) {
+		t.Fatalf("Got '%s'. Expected '%s'.", got, blob)
+	}
+}
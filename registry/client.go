@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// UserAgent identifies docker-lock to registries. The command sets it to
+// 'docker-lock/<version>'.
+var UserAgent = "docker-lock"
+
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultTimeout        = 2 * time.Minute
+)
+
+// defaultClient is shared by every wrapper that is not given a client, so
+// that connections are reused across wrappers.
+var defaultClient = newClient(defaultConnectTimeout, defaultTimeout)
+
+type clientKey struct {
+	connectTimeout time.Duration
+	timeout        time.Duration
+}
+
+// clients are the clients returned by NewHTTPClient, by their timeouts.
+var (
+	clientsMu sync.Mutex
+	clients   = map[clientKey]*http.Client{
+		{connectTimeout: defaultConnectTimeout, timeout: defaultTimeout}: defaultClient,
+	}
+)
+
+// HTTPConfig configures requests to registries. Timeouts are durations, such
+// as '30s'. ConnectTimeout limits establishing a connection and Timeout
+// limits each request, including reading the response. Proxies are read
+// from HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+type HTTPConfig struct {
+	ConnectTimeout string `json:"connectTimeout"`
+	Timeout        string `json:"timeout"`
+}
+
+// NewHTTPClient returns a client configured by httpConf. The same client is
+// returned for configs with the same timeouts, so that they share
+// connections.
+func NewHTTPClient(httpConf HTTPConfig) (*http.Client, error) {
+	connectTimeout, err := parseTimeout(httpConf.ConnectTimeout, defaultConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseTimeout(httpConf.Timeout, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	key := clientKey{connectTimeout: connectTimeout, timeout: timeout}
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	client, ok := clients[key]
+	if !ok {
+		client = newClient(connectTimeout, timeout)
+		clients[key] = client
+	}
+	return client, nil
+}
+
+func parseTimeout(timeout string, defaultTimeout time.Duration) (time.Duration, error) {
+	if timeout == "" {
+		return defaultTimeout, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("%s. From timeout: '%s'.", err, timeout)
+	}
+	return d, nil
+}
+
+func newClient(connectTimeout time.Duration, timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.MaxIdleConnsPerHost = 10
+	return &http.Client{Transport: &userAgentTransport{transport: transport}, Timeout: timeout}
+}
+
+// withTransport returns a client like client, whose transport is modified
+// by configure. The original transport is not modified. Clients whose
+// transport is not an *http.Transport get a copy of the default transport.
+func withTransport(client *http.Client, configure func(*http.Transport)) *http.Client {
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case *userAgentTransport:
+		transport = t.transport.Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	configure(transport)
+	return &http.Client{Transport: &userAgentTransport{transport: transport}, Timeout: client.Timeout}
+}
+
+// httpClient returns client, or the shared client if client is nil.
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return defaultClient
+	}
+	return client
+}
+
+type userAgentTransport struct {
+	transport *http.Transport
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", UserAgent)
+	return t.transport.RoundTrip(req)
+}
@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserAgent(t *testing.T) {
+	userAgents := make(chan string, 1)
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		userAgents <- req.Header.Get("User-Agent")
+		w.Header().Set("Docker-Content-Digest", "sha256:digest")
+	}))
+	defer s.Close()
+	defer func(userAgent string) { UserAgent = userAgent }(UserAgent)
+	UserAgent = "docker-lock/test"
+	host := strings.TrimPrefix(s.URL, "https://")
+	w, err := NewV2Wrapper(RegistryConfig{Host: host, Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.GetDigest(host+"/team/app", "1.0"); err != nil {
+		t.Fatal(err)
+	}
+	if userAgent := <-userAgents; userAgent != "docker-lock/test" {
+		t.Fatalf("Got User-Agent '%s'. Expected 'docker-lock/test'.", userAgent)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer s.Close()
+	defer close(done)
+	host := strings.TrimPrefix(s.URL, "https://")
+	conf := &Config{
+		Registries: []RegistryConfig{{Host: host, Insecure: true}},
+		HTTP:       HTTPConfig{Timeout: "100ms"},
+	}
+	wrappers, err := NewWrappers(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := wrappers[0].GetDigest(host+"/team/app", "1.0"); err == nil {
+		t.Fatal("Request to a hung registry should time out.")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Request took %s. Expected it to time out after 100ms.", elapsed)
+	}
+}
+
+func TestFaultyHTTPConfig(t *testing.T) {
+	httpConfs := []HTTPConfig{
+		{Timeout: "soon"},
+		{ConnectTimeout: "10"},
+	}
+	for _, httpConf := range httpConfs {
+		if _, err := NewHTTPClient(httpConf); err == nil {
+			t.Fatalf("HTTP config '%+v' should fail.", httpConf)
+		}
+		if _, err := NewWrappers(&Config{HTTP: httpConf}); err == nil {
+			t.Fatalf("HTTP config '%+v' should fail.", httpConf)
+		}
+	}
+	client, err := NewHTTPClient(HTTPConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client != defaultClient {
+		t.Fatal("Expected the shared client for an empty HTTP config.")
+	}
+}
+
+func TestSharedHTTPClient(t *testing.T) {
+	client, err := NewHTTPClient(HTTPConfig{Timeout: "10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, err := NewHTTPClient(HTTPConfig{Timeout: "10000ms", ConnectTimeout: "30s"}); err != nil || other != client {
+		t.Fatal("Expected the same client for configs with the same timeouts.")
+	}
+	if other, _ := NewHTTPClient(HTTPConfig{Timeout: "20s"}); other == client {
+		t.Fatal("Expected another client for other timeouts.")
+	}
+	if other, _ := NewHTTPClient(HTTPConfig{Timeout: "2m"}); other != defaultClient {
+		t.Fatal("Expected the shared client for the default timeouts.")
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	for _, client := range []*http.Client{{}, {Transport: &http.Transport{}}, defaultClient} {
+		var configured bool
+		c := withTransport(client, func(transport *http.Transport) { configured = true })
+		if !configured || c == client {
+			t.Fatalf("Expected a configured copy of %+v.", client)
+		}
+		if _, ok := c.Transport.(*userAgentTransport); !ok {
+			t.Fatalf("Got transport %T. Expected the User-Agent to be set.", c.Transport)
+		}
+	}
+}
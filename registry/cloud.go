@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Host patterns of cloud registries.
+const (
+	ECRHost = "*.dkr.ecr.*.amazonaws.com"
+	GARHost = "*-docker.pkg.dev"
+	ACRHost = "*.azurecr.io"
+)
+
+// gcrHosts are Google Container Registry's hosts, which accept the same
+// credentials as Google Artifact Registry.
+var gcrHosts = []string{"gcr.io", "*.gcr.io"}
+
+// NewCloudWrappers returns wrappers for ECR, GAR, GCR and ACR.
+func NewCloudWrappers(client *http.Client) ([]Wrapper, error) {
+	client = httpClient(client)
+	regConfs := []RegistryConfig{
+		{Host: ECRHost, Auth: AuthConfig{Type: "ecr"}},
+		{Host: GARHost, Auth: AuthConfig{Type: "gar"}},
+		{Host: ACRHost, Auth: AuthConfig{Type: "acr"}},
+	}
+	for _, host := range gcrHosts {
+		regConfs = append(regConfs, RegistryConfig{Host: host, Auth: AuthConfig{Type: "gar"}})
+	}
+	wrappers := make([]Wrapper, len(regConfs))
+	for i, regConf := range regConfs {
+		wrapper, err := newV2Wrapper(regConf, client)
+		if err != nil {
+			return nil, err
+		}
+		wrappers[i] = wrapper
+	}
+	return wrappers, nil
+}
+
+// NewECRWrapper resolves images in Amazon ECR with an authorization token,
+// as returned by 'aws ecr get-authorization-token', from the
+// ECR_AUTHORIZATION_TOKEN environment variable or the file named by
+// ECR_AUTHORIZATION_TOKEN_FILE. If client is nil, a shared client is used.
+func NewECRWrapper(client *http.Client) (*V2Wrapper, error) {
+	return newV2Wrapper(RegistryConfig{Host: ECRHost, Auth: AuthConfig{Type: "ecr"}}, httpClient(client))
+}
+
+// NewGARWrapper resolves images in Google Artifact Registry with an OAuth2
+// access token, as returned by 'gcloud auth print-access-token', from the
+// GOOGLE_OAUTH_ACCESS_TOKEN environment variable or the file named by
+// GOOGLE_OAUTH_ACCESS_TOKEN_FILE. Without a token, only public images
+// can be resolved.
+func NewGARWrapper(client *http.Client) (*V2Wrapper, error) {
+	return newV2Wrapper(RegistryConfig{Host: GARHost, Auth: AuthConfig{Type: "gar"}}, httpClient(client))
+}
+
+// NewACRWrapper resolves images in Azure Container Registry by exchanging a
+// refresh token, as returned by 'az acr login --expose-token', from the
+// ACR_REFRESH_TOKEN environment variable or the file named by
+// ACR_REFRESH_TOKEN_FILE, for access tokens. Without a refresh token, only
+// registries that allow anonymous pulls can be resolved.
+func NewACRWrapper(client *http.Client) (*V2Wrapper, error) {
+	return newV2Wrapper(RegistryConfig{Host: ACRHost, Auth: AuthConfig{Type: "acr"}}, httpClient(client))
+}
+
+// cloudCredential returns the configured token or the contents of the
+// configured token file, or else the token from envVar or from the file
+// named by envVar + '_FILE'.
+func cloudCredential(authConf AuthConfig, envVar string) (string, error) {
+	if token := os.ExpandEnv(authConf.Token); token != "" {
+		return token, nil
+	}
+	tokenFile := os.ExpandEnv(authConf.TokenFile)
+	if tokenFile == "" {
+		if token := os.Getenv(envVar); token != "" {
+			return token, nil
+		}
+		tokenFile = os.Getenv(envVar + "_FILE")
+	}
+	if tokenFile == "" {
+		return "", nil
+	}
+	tokenByt, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(tokenByt)), nil
+}
+
+func newECRAuthenticator(authConf AuthConfig, client *http.Client) (authenticator, error) {
+	token, err := cloudCredential(authConf, "ECR_AUTHORIZATION_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return &missingAuth{message: "No ECR authorization token. Set ECR_AUTHORIZATION_TOKEN or ECR_AUTHORIZATION_TOKEN_FILE."}, nil
+	}
+	authByt, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed ECR authorization token. %s", err)
+	}
+	auth := strings.SplitN(string(authByt), ":", 2)
+	if len(auth) != 2 {
+		return nil, fmt.Errorf("Malformed ECR authorization token")
+	}
+	return &basicAuth{username: auth[0], password: auth[1], client: client}, nil
+}
+
+func newGARAuthenticator(authConf AuthConfig, client *http.Client) (authenticator, error) {
+	token, err := cloudCredential(authConf, "GOOGLE_OAUTH_ACCESS_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return &anonymousAuth{client: client}, nil
+	}
+	return &basicAuth{username: "oauth2accesstoken", password: token, client: client}, nil
+}
+
+func newACRAuthenticator(authConf AuthConfig, client *http.Client) (authenticator, error) {
+	token, err := cloudCredential(authConf, "ACR_REFRESH_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return &anonymousAuth{client: client}, nil
+	}
+	return &acrAuth{refreshToken: token, client: client}, nil
+}
+
+// missingAuth fails with message if the registry challenges, so that
+// wrappers for registries without credentials can still be added.
+type missingAuth struct {
+	message string
+}
+
+func (a *missingAuth) authorize(req *http.Request, ch *challenge, repo string) error {
+	if ch == nil {
+		return nil
+	}
+	return fmt.Errorf("Registry '%s' requires credentials. %s", req.URL.Host, a.message)
+}
+
+// acrAuth answers bearer challenges by exchanging a refresh token for an
+// access token at the realm, which is the registry's '/oauth2/token'. Realms
+// on other hosts are refused, so that the refresh token is only sent to the
+// registry.
+type acrAuth struct {
+	refreshToken string
+	client       *http.Client
+}
+
+func (a *acrAuth) authorize(req *http.Request, ch *challenge, repo string) error {
+	if ch == nil {
+		return nil
+	}
+	if ch.scheme != "bearer" {
+		return fmt.Errorf("Unsupported authentication scheme '%s'.", ch.scheme)
+	}
+	realm := ch.params["realm"]
+	if realm == "" {
+		return fmt.Errorf("No realm to request a token from.")
+	}
+	realmURL, err := url.Parse(realm)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(realmURL.Host, req.URL.Host) || realmURL.Scheme != req.URL.Scheme {
+		return fmt.Errorf("Realm '%s' is not on registry '%s'. Refusing to send the refresh token.", realm, req.URL.Host)
+	}
+	service := ch.params["service"]
+	if service == "" {
+		service = req.URL.Host
+	}
+	resp, err := a.client.PostForm(realm, url.Values{
+		"grant_type":    {"refresh_token"},
+		"service":       {service},
+		"scope":         {"repository:" + repo + ":pull"},
+		"refresh_token": {a.refreshToken},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unexpected status '%s' from token endpoint '%s'.", resp.Status, realm)
+	}
+	var t tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return err
+	}
+	if t.AccessToken == "" {
+		return fmt.Errorf("No access token from token endpoint '%s'.", realm)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.AccessToken)
+	return nil
+}
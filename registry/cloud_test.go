@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestECRAuth(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{"team/app:1.0": "digest"})
+	r.username, r.password = "AWS", "secret"
+	regConf := RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "ecr"}, Insecure: true}
+	w, err := NewV2Wrapper(regConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.GetDigest(r.host()+"/team/app", "1.0")
+	if err == nil || !strings.Contains(err.Error(), "ECR_AUTHORIZATION_TOKEN") {
+		t.Fatalf("Got '%v'. Expected an error about the missing token.", err)
+	}
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:secret"))
+	os.Setenv("ECR_AUTHORIZATION_TOKEN", token)
+	defer os.Unsetenv("ECR_AUTHORIZATION_TOKEN")
+	assertDigest(t, regConf, r.host()+"/team/app", true)
+	tokenFile := filepath.Join(tempDir(t), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte(base64.StdEncoding.EncodeToString([]byte("AWS:wrong"))+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	regConf.Auth.TokenFile = tokenFile
+	assertDigest(t, regConf, r.host()+"/team/app", false)
+	os.Setenv("ECR_AUTHORIZATION_TOKEN", "not base64")
+	if _, err := NewV2Wrapper(RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "ecr"}}); err == nil {
+		t.Fatal("Malformed ECR authorization token should fail.")
+	}
+}
+
+func TestGARAuth(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{"project/repo/app:1.0": "digest"})
+	r.username, r.password, r.bearer = "oauth2accesstoken", "access-token", true
+	regConf := RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "gar"}, Insecure: true}
+	assertDigest(t, regConf, r.host()+"/project/repo/app", false)
+	tokenFile := filepath.Join(tempDir(t), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("access-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN_FILE", tokenFile)
+	defer os.Unsetenv("GOOGLE_OAUTH_ACCESS_TOKEN_FILE")
+	assertDigest(t, regConf, r.host()+"/project/repo/app", true)
+}
+
+func TestACRAuth(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{"team/app:1.0": "digest"})
+	r.refreshToken, r.bearer = "refresh-token", true
+	regConf := RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "acr"}, Insecure: true}
+	assertDigest(t, regConf, r.host()+"/team/app", false)
+	os.Setenv("ACR_REFRESH_TOKEN", "wrong-token")
+	defer os.Unsetenv("ACR_REFRESH_TOKEN")
+	assertDigest(t, regConf, r.host()+"/team/app", false)
+	os.Setenv("ACR_REFRESH_TOKEN", "refresh-token")
+	assertDigest(t, regConf, r.host()+"/team/app", true)
+	for _, auth := range r.authorizations() {
+		if strings.Contains(auth, "refresh-token") {
+			t.Fatalf("Refresh token was sent to the registry in '%s'.", auth)
+		}
+	}
+}
+
+func TestACRAuthForeignRealm(t *testing.T) {
+	evil := newTestRegistry(t, nil)
+	evil.refreshToken = "refresh-token"
+	r := newTestRegistry(t, map[string]string{"team/app:1.0": "digest"})
+	r.refreshToken, r.bearer, r.realm = "refresh-token", true, evil.URL+"/oauth2/token"
+	os.Setenv("ACR_REFRESH_TOKEN", "refresh-token")
+	defer os.Unsetenv("ACR_REFRESH_TOKEN")
+	regConf := RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "acr"}, Insecure: true}
+	assertDigest(t, regConf, r.host()+"/team/app", false)
+	if requests := evil.authorizations(); len(requests) != 0 {
+		t.Fatalf("Got %d requests to '%s'. Expected the refresh token not to be sent to another host.", len(requests), evil.host())
+	}
+}
+
+func TestCloudWrappers(t *testing.T) {
+	defaultWrapper := &prefixWrapper{}
+	wm := NewWrapperManager(defaultWrapper)
+	wrappers, err := NewCloudWrappers(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm.Add(wrappers...)
+	tests := []struct {
+		imageName string
+		prefix    string
+	}{
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com/team/app", ECRHost + "/"},
+		{"us-central1-docker.pkg.dev/project/repo/app", GARHost + "/"},
+		{"gcr.io/project/app", "gcr.io/"},
+		{"eu.gcr.io/project/app", "*.gcr.io/"},
+		{"myregistry.azurecr.io/team/app", ACRHost + "/"},
+		{"evilgcr.io/project/app", ""},
+		{"dkr.ecr.us-east-1.amazonaws.com.evil.com/team/app", ""},
+		{"evil.com/myregistry.azurecr.io/team/app", ""},
+	}
+	for _, test := range tests {
+		if prefix := wm.GetWrapper(test.imageName).Prefix(); prefix != test.prefix {
+			t.Fatalf("Got prefix '%s' for '%s'. Expected '%s'.", prefix, test.imageName, test.prefix)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// Config declares registries in a JSON file, so that wrappers for
+// registries such as Harbor can be added without recompiling. For instance:
+//
+//	{
+//		"registries": [
+//			{
+//				"host": "harbor.example.com",
+//				"auth": {"type": "basic", "username": "${HARBOR_USER}", "password": "${HARBOR_PASSWORD}"},
+//				"caFile": "harbor-ca.pem",
+//				"mirrors": ["harbor-mirror.example.com"]
+//			}
+//		],
+//		"registry-mirrors": ["https://hub-cache.example.com"]
+//	}
+//
+// Credentials may refer to environment variables, so that secrets do not
+// have to be stored in the file. RegistryMirrors are mirrors of Docker Hub,
+// as in the docker daemon config.
+type Config struct {
+	Registries      []RegistryConfig `json:"registries"`
+	RegistryMirrors []string         `json:"registry-mirrors"`
+	VerifyMirrors   bool             `json:"verifyMirrors"`
+	HTTP            HTTPConfig       `json:"http"`
+}
+
+// RegistryConfig's Mirror is a single mirror, kept for older configs, that
+// is tried before Mirrors. If VerifyMirrors is set, digests from mirrors
+// must match the registry's.
+//
+// Besides CAFile, CertFile and KeyFile, certificates are read from
+// CertsDir/<host>/, which defaults to '/etc/docker/certs.d', as docker does.
+// Insecure skips certificate verification, and PlainHTTP does not use TLS.
+type RegistryConfig struct {
+	Host          string     `json:"host"`
+	Auth          AuthConfig `json:"auth"`
+	Insecure      bool       `json:"insecure"`
+	PlainHTTP     bool       `json:"plainHTTP"`
+	CAFile        string     `json:"caFile"`
+	CertFile      string     `json:"certFile"`
+	KeyFile       string     `json:"keyFile"`
+	CertsDir      string     `json:"certsDir"`
+	Mirror        string     `json:"mirror"`
+	Mirrors       []string   `json:"mirrors"`
+	VerifyMirrors bool       `json:"verifyMirrors"`
+}
+
+// AuthConfig's Type is one of "anonymous", the default, "basic", "bearer",
+// "token", "ecr", "gar", "acr", "ghcr" or "gitlab". A "token" registry
+// requests tokens from Realm, rather than from the realm the registry
+// challenges with. The other types read Token or TokenFile, or else the
+// environment variables described by their wrappers' constructors, such as
+// NewECRWrapper.
+type AuthConfig struct {
+	Type      string `json:"type"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Token     string `json:"token"`
+	TokenFile string `json:"tokenFile"`
+	Realm     string `json:"realm"`
+	Service   string `json:"service"`
+}
+
+func LoadConfig(fpath string) (*Config, error) {
+	confByt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var conf Config
+	if err := json.Unmarshal(confByt, &conf); err != nil {
+		return nil, fmt.Errorf("%s. From registry config file: '%s'.", err, fpath)
+	}
+	return &conf, nil
+}
+
+// NewWrappers builds a V2Wrapper for every registry in the config.
+func NewWrappers(conf *Config) ([]Wrapper, error) {
+	client, err := NewHTTPClient(conf.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	var wrappers []Wrapper
+	for _, regConf := range conf.Registries {
+		wrapper, err := newV2Wrapper(regConf, client)
+		if err != nil {
+			return nil, err
+		}
+		wrappers = append(wrappers, wrapper)
+	}
+	return wrappers, nil
+}
+
+func NewV2Wrapper(regConf RegistryConfig) (*V2Wrapper, error) {
+	return newV2Wrapper(regConf, defaultClient)
+}
+
+func newV2Wrapper(regConf RegistryConfig, client *http.Client) (*V2Wrapper, error) {
+	if regConf.Host == "" {
+		return nil, fmt.Errorf("Registry config '%+v' has no host.", regConf)
+	}
+	client, err := newHTTPClient(regConf, client)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := newAuthenticator(regConf.Auth, client)
+	if err != nil {
+		return nil, fmt.Errorf("%s. From registry: '%s'.", err, regConf.Host)
+	}
+	mirrors := regConf.Mirrors
+	if regConf.Mirror != "" {
+		mirrors = append([]string{regConf.Mirror}, mirrors...)
+	}
+	scheme := "https"
+	if regConf.PlainHTTP {
+		scheme = "http"
+	}
+	return &V2Wrapper{Host: regConf.Host,
+		Mirrors:       mirrors,
+		VerifyMirrors: regConf.VerifyMirrors,
+		client:        &v2Client{scheme: scheme, client: client, auth: auth},
+		mirrors:       newMirrors(mirrors, client),
+		// GHCR rejects scopes with the uppercase owner names GitHub allows.
+		lowercase: regConf.Auth.Type == "ghcr",
+	}, nil
+}
+
+func newAuthenticator(authConf AuthConfig, client *http.Client) (authenticator, error) {
+	username := os.ExpandEnv(authConf.Username)
+	password := os.ExpandEnv(authConf.Password)
+	switch authConf.Type {
+	case "", "anonymous":
+		return &anonymousAuth{client: client}, nil
+	case "basic":
+		return &basicAuth{username: username, password: password, client: client}, nil
+	case "bearer":
+		return &bearerAuth{token: os.ExpandEnv(authConf.Token)}, nil
+	case "token":
+		if authConf.Realm == "" {
+			return nil, fmt.Errorf("Auth type 'token' requires a realm")
+		}
+		return &tokenAuth{realm: authConf.Realm,
+			service:  authConf.Service,
+			username: username,
+			password: password,
+			client:   client,
+		}, nil
+	case "ecr":
+		return newECRAuthenticator(authConf, client)
+	case "gar":
+		return newGARAuthenticator(authConf, client)
+	case "acr":
+		return newACRAuthenticator(authConf, client)
+	case "ghcr":
+		return newGHCRAuthenticator(authConf, client)
+	case "gitlab":
+		return newGitLabAuthenticator(authConf, client)
+	}
+	return nil, fmt.Errorf("Unsupported auth type '%s'", authConf.Type)
+}
@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	fpath := writeConfig(t, `{"registries": [{"host": "harbor.example.com", "auth": {"type": "basic", "username": "user", "password": "${HARBOR_PASSWORD}"}, "mirror": "mirror.example.com"}]}`)
+	conf, err := LoadConfig(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Registries) != 1 {
+		t.Fatalf("Got %d registries. Expected 1.", len(conf.Registries))
+	}
+	regConf := conf.Registries[0]
+	if regConf.Host != "harbor.example.com" || regConf.Auth.Type != "basic" || regConf.Mirror != "mirror.example.com" {
+		t.Fatalf("Got '%+v'.", regConf)
+	}
+	wm := NewWrapperManager(&DockerWrapper{})
+	if err := wm.AddConfig(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := wm.GetWrapper("harbor.example.com/team/app").(*V2Wrapper); !ok {
+		t.Fatal("Expected a V2Wrapper for 'harbor.example.com/team/app'.")
+	}
+}
+
+func TestFaultyConfig(t *testing.T) {
+	confs := []string{
+		`{"registries": [{"auth": {"type": "basic"}}]}`,
+		`{"registries": [{"host": "harbor.example.com", "auth": {"type": "kerberos"}}]}`,
+		`{"registries": [{"host": "harbor.example.com", "auth": {"type": "token"}}]}`,
+		`{"registries": [{"host": "harbor.example.com", "caFile": "missing.pem"}]}`,
+	}
+	for _, c := range confs {
+		conf, err := LoadConfig(writeConfig(t, c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewWrappers(conf); err == nil {
+			t.Fatalf("Config '%s' should fail.", c)
+		}
+	}
+	if _, err := LoadConfig(writeConfig(t, `{"registries": {}}`)); err == nil {
+		t.Fatal("Malformed config should fail.")
+	}
+}
+
+func TestV2WrapperAuth(t *testing.T) {
+	digest := "9b1702dcfe32c873a770a32cfd306dd7fc1c4fd134adfb783db68defc8894b3c"
+	os.Setenv("TEST_REGISTRY_PASSWORD", "secret")
+	defer os.Unsetenv("TEST_REGISTRY_PASSWORD")
+	tests := []struct {
+		username string
+		password string
+		bearer   bool
+		auth     AuthConfig
+	}{
+		{"", "", false, AuthConfig{}},
+		{"", "", false, AuthConfig{Type: "anonymous"}},
+		{"user", "secret", false, AuthConfig{Type: "basic", Username: "user", Password: "${TEST_REGISTRY_PASSWORD}"}},
+		{"user", "secret", true, AuthConfig{Type: "basic", Username: "user", Password: "secret"}},
+		{"user", "secret", true, AuthConfig{Type: "bearer", Token: "token-for-repository:team/app:pull"}},
+		{"user", "secret", true, AuthConfig{Type: "token", Username: "user", Password: "secret", Service: "test"}},
+	}
+	for _, test := range tests {
+		r := newTestRegistry(t, map[string]string{"team/app:1.0": digest})
+		r.username, r.password, r.bearer = test.username, test.password, test.bearer
+		if test.auth.Type == "token" {
+			test.auth.Realm = r.URL + "/token"
+		}
+		w, err := NewV2Wrapper(RegistryConfig{Host: r.host(), Auth: test.auth, Insecure: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotDigest, err := w.GetDigest(r.host()+"/team/app", "1.0")
+		if err != nil {
+			t.Fatalf("Auth '%+v' failed. %s", test.auth, err)
+		}
+		if gotDigest != digest {
+			t.Fatalf("Got '%s'. Expected '%s'.", gotDigest, digest)
+		}
+	}
+}
+
+func TestV2WrapperWrongCredentials(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{"team/app:1.0": "digest"})
+	r.username, r.password = "user", "secret"
+	w, err := NewV2Wrapper(RegistryConfig{Host: r.host(),
+		Auth:     AuthConfig{Type: "basic", Username: "user", Password: "wrong"},
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.GetDigest(r.host()+"/team/app", "1.0"); err == nil {
+		t.Fatal("Wrong credentials should fail.")
+	}
+}
+
+func TestV2WrapperMirror(t *testing.T) {
+	upstream := newTestRegistry(t, map[string]string{"team/app:1.0": "upstream", "team/app:2.0": "upstream2"})
+	mirror := newTestRegistry(t, map[string]string{"team/app:1.0": "mirror"})
+	w, err := NewV2Wrapper(RegistryConfig{Host: upstream.host(), Mirror: mirror.host(), Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := w.GetDigest(upstream.host()+"/team/app", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "mirror" {
+		t.Fatalf("Got '%s'. Expected the mirror's digest.", digest)
+	}
+	digest, err = w.GetDigest(upstream.host()+"/team/app", "2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "upstream2" {
+		t.Fatalf("Got '%s'. Expected to fall back to upstream.", digest)
+	}
+}
+
+func TestV2WrapperMirrors(t *testing.T) {
+	upstream := newTestRegistry(t, map[string]string{"team/app:1.0": "upstream", "team/app:2.0": "upstream2"})
+	stale := newTestRegistry(t, map[string]string{"team/app:2.0": "stale"})
+	cache := newTestRegistry(t, map[string]string{"team/app:1.0": "upstream", "team/app:2.0": "upstream2"})
+	regConf := RegistryConfig{Host: upstream.host(),
+		Mirrors:  []string{"https://" + stale.host() + "/", cache.host()},
+		Insecure: true,
+	}
+	w, err := NewV2Wrapper(regConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tag    string
+		digest string
+	}{
+		{"1.0", "upstream"},
+		{"2.0", "stale"},
+	}
+	for _, test := range tests {
+		digest, err := w.GetDigest(upstream.host()+"/team/app", test.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest != test.digest {
+			t.Fatalf("Got '%s'. Expected '%s'.", digest, test.digest)
+		}
+	}
+	regConf.VerifyMirrors = true
+	if w, err = NewV2Wrapper(regConf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.GetDigest(upstream.host()+"/team/app", "2.0"); err == nil {
+		t.Fatal("Digest from a stale mirror should fail verification.")
+	}
+	digest, err := w.GetDigest(upstream.host()+"/team/app", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "upstream" {
+		t.Fatalf("Got '%s'. Expected 'upstream'.", digest)
+	}
+}
+
+func TestMirrorWrapper(t *testing.T) {
+	cache := newTestRegistry(t, map[string]string{"library/ubuntu:18.04": "cached", "mperel/log:v1": "log", "library/node:12": "node-amd64"})
+	cache.manifestLists = map[string]string{"library/node:12": "node-list"}
+	upstream := newTestRegistry(t, map[string]string{"library/ubuntu:18.04": "upstream", "library/ubuntu:20.04": "focal", "library/node:12": "node-amd64"})
+	upstream.manifestLists = map[string]string{"library/node:12": "node-list"}
+	upstream.bearer = true
+	dockerHub := &DockerWrapper{Client: upstream.Client(), host: upstream.host(), realm: upstream.URL + "/token"}
+	w := NewMirrorWrapper(dockerHub, []string{"https://" + cache.host()}, false, cache.Client())
+	tests := []struct {
+		name   string
+		tag    string
+		digest string
+	}{
+		{"ubuntu", "18.04", "cached"},
+		{"mperel/log", "v1", "log"},
+		{"ubuntu", "20.04", "focal"},
+		{"node", "12", "node-amd64"},
+	}
+	for _, test := range tests {
+		digest, err := w.GetDigest(test.name, test.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if digest != test.digest {
+			t.Fatalf("Got '%s' for '%s:%s'. Expected '%s'.", digest, test.name, test.tag, test.digest)
+		}
+	}
+	digest, err := dockerHub.GetDigest("node", "12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != "node-amd64" {
+		t.Fatalf("Got '%s' from upstream for 'node:12'. Expected the platform manifest's digest, as from the mirror.", digest)
+	}
+	w.VerifyMirrors = true
+	if digest, err := w.GetDigest("node", "12"); err != nil || digest != "node-amd64" {
+		t.Fatalf("Got '%s', %v. Expected the verified platform manifest's digest.", digest, err)
+	}
+	if _, err := w.GetDigest("ubuntu", "18.04"); err == nil {
+		t.Fatal("Digest that differs from upstream should fail verification.")
+	}
+	wm := NewWrapperManager(dockerHub)
+	if err := wm.AddConfig(&Config{RegistryMirrors: []string{cache.host()}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := wm.GetWrapper("ubuntu").(*MirrorWrapper); !ok {
+		t.Fatal("Expected a MirrorWrapper for 'ubuntu'.")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	ch := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull"`)
+	if ch.scheme != "bearer" {
+		t.Fatalf("Got '%s'. Expected 'bearer'.", ch.scheme)
+	}
+	expected := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/ubuntu:pull",
+	}
+	for k, v := range expected {
+		if ch.params[k] != v {
+			t.Fatalf("Got '%s' for '%s'. Expected '%s'.", ch.params[k], k, v)
+		}
+	}
+	if parseChallenge("") != nil {
+		t.Fatal("Empty challenge should be nil.")
+	}
+}
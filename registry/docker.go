@@ -3,7 +3,6 @@ package registry
 import (
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -13,10 +12,11 @@ import (
 
 type DockerWrapper struct {
 	ConfigFile string
-}
-
-type dockerTokenResponse struct {
-	Token string `json:"token"`
+	// Client is used for requests to Docker Hub. If nil, a shared client is used.
+	Client *http.Client
+	// host and realm stand in for Docker Hub's registry and token endpoint.
+	host  string
+	realm string
 }
 
 type config struct {
@@ -31,59 +31,51 @@ type config struct {
 func (w *DockerWrapper) GetDigest(name string, tag string) (string, error) {
 	// Docker-Content-Digest is the root of the hash chain
 	// https://github.com/docker/distribution/issues/1662
-	token, err := w.getToken(name)
-	if err != nil {
-		return "", err
-	}
-	registryUrl := "https://registry-1.docker.io/v2/" + name + "/manifests/" + tag
-	req, err := http.NewRequest("GET", registryUrl, nil)
-	if err != nil {
-		return "", err
+	if !strings.Contains(name, "/") {
+		name = "library/" + name
 	}
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	client, err := w.v2Client()
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-	digest := resp.Header.Get("Docker-Content-Digest")
-	if digest == "" && !strings.HasPrefix(name, "library/") {
+	return client.getDigest(w.registryHost(), name, tag)
+}
+
+func (w *DockerWrapper) GetTags(name string) ([]string, error) {
+	if !strings.Contains(name, "/") {
 		name = "library/" + name
-		return w.GetDigest(name, tag)
 	}
-	if digest == "" {
-		return "", errors.New("No digest found")
+	client, err := w.v2Client()
+	if err != nil {
+		return nil, err
 	}
-	return strings.TrimPrefix(digest, "sha256:"), nil
+	return client.getTags(w.registryHost(), name)
 }
 
-func (w *DockerWrapper) getToken(name string) (string, error) {
-	client := &http.Client{}
-	url := "https://auth.docker.io/token?scope=repository:" + name + ":pull&service=registry.docker.io"
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
+func (w *DockerWrapper) registryHost() string {
+	if w.host != "" {
+		return w.host
 	}
+	return "registry-1.docker.io"
+}
+
+func (w *DockerWrapper) v2Client() (*v2Client, error) {
 	username, password, err := w.getAuthCredentials()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	if username != "" && password != "" {
-		req.SetBasicAuth(username, password)
+	client := httpClient(w.Client)
+	realm := w.realm
+	if realm == "" {
+		realm = "https://auth.docker.io/token"
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	decoder := json.NewDecoder(resp.Body)
-	var t dockerTokenResponse
-	if err = decoder.Decode(&t); err != nil {
-		return "", err
+	auth := &tokenAuth{realm: realm,
+		service:  "registry.docker.io",
+		username: username,
+		password: password,
+		client:   client,
 	}
-	return t.Token, nil
+	return &v2Client{scheme: "https", client: client, auth: auth}, nil
 }
 
 func (w *DockerWrapper) getAuthCredentials() (string, string, error) {
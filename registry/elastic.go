@@ -7,7 +7,10 @@ import (
 	"strings"
 )
 
-type ElasticWrapper struct{}
+type ElasticWrapper struct {
+	// Client is used for requests to Elastic. If nil, a shared client is used.
+	Client *http.Client
+}
 
 type elasticTokenResponse struct {
 	Token string `json:"token"`
@@ -27,7 +30,7 @@ func (w *ElasticWrapper) GetDigest(name string, tag string) (string, error) {
 	}
 	req.Header.Add("Authorization", "Bearer "+token)
 	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	client := &http.Client{}
+	client := httpClient(w.Client)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -40,10 +43,22 @@ func (w *ElasticWrapper) GetDigest(name string, tag string) (string, error) {
 	return strings.TrimPrefix(digest, "sha256:"), nil
 }
 
+func (w *ElasticWrapper) GetTags(name string) ([]string, error) {
+	prefix := w.Prefix()
+	name = strings.Replace(name, prefix, "", 1)
+	return w.v2Client().getTags(strings.TrimSuffix(prefix, "/"), name)
+}
+
+func (w *ElasticWrapper) v2Client() *v2Client {
+	client := httpClient(w.Client)
+	auth := &tokenAuth{realm: "https://docker-auth.elastic.co/auth", service: "token-service", client: client}
+	return &v2Client{scheme: "https", client: client, auth: auth}
+}
+
 func (w *ElasticWrapper) getToken(name string) (string, error) {
 	// example name -> "elasticsearch/elasticsearch-oss"
 	url := "https://docker-auth.elastic.co/auth?scope=repository:" + name + ":pull&service=token-service"
-	resp, err := http.Get(url)
+	resp, err := httpClient(w.Client).Get(url)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,37 @@
+package registry
+
+import (
+	"net/http"
+	"os"
+)
+
+const GHCRHost = "ghcr.io"
+
+// NewGHCRWrapper resolves images in GitHub Container Registry. Public images
+// are pulled anonymously. Private images require a token with the
+// read:packages scope from the GITHUB_TOKEN environment variable or the file
+// named by GITHUB_TOKEN_FILE. If client is nil, a shared client is used.
+func NewGHCRWrapper(client *http.Client) (*V2Wrapper, error) {
+	return newV2Wrapper(RegistryConfig{Host: GHCRHost, Auth: AuthConfig{Type: "ghcr"}}, httpClient(client))
+}
+
+// newGHCRAuthenticator requests tokens from the realm GHCR challenges with,
+// authenticating with the token if there is one. GHCR ignores the username,
+// but requires one, so GITHUB_ACTOR is used if it is set.
+func newGHCRAuthenticator(authConf AuthConfig, client *http.Client) (authenticator, error) {
+	token, err := cloudCredential(authConf, "GITHUB_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return &anonymousAuth{client: client}, nil
+	}
+	username := os.ExpandEnv(authConf.Username)
+	if username == "" {
+		username = os.Getenv("GITHUB_ACTOR")
+	}
+	if username == "" {
+		username = "docker-lock"
+	}
+	return &basicAuth{username: username, password: token, client: client}, nil
+}
@@ -0,0 +1,28 @@
+package registry
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGHCRAnonymous(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{"myorg/app:1.0": "digest"})
+	r.bearer = true
+	assertDigest(t, RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "ghcr"}, Insecure: true}, r.host()+"/MyOrg/App", true)
+	auths := r.authorizations()
+	if auth := auths[len(auths)-1]; auth != "Bearer token-for-repository:myorg/app:pull" {
+		t.Fatalf("Got authorization '%s'. Expected a token for the lowercase repository.", auth)
+	}
+}
+
+func TestGHCRToken(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{"myorg/private:1.0": "digest"})
+	r.username, r.password, r.bearer = "octocat", "ghp_token", true
+	regConf := RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "ghcr"}, Insecure: true}
+	assertDigest(t, regConf, r.host()+"/myorg/private", false)
+	os.Setenv("GITHUB_TOKEN", "ghp_token")
+	defer os.Unsetenv("GITHUB_TOKEN")
+	os.Setenv("GITHUB_ACTOR", "octocat")
+	defer os.Unsetenv("GITHUB_ACTOR")
+	assertDigest(t, regConf, r.host()+"/myorg/private", true)
+}
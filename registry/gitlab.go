@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"net/http"
+	"os"
+)
+
+const GitLabHost = "registry.gitlab.com"
+
+// NewGitLabWrapper resolves images in GitLab's container registry. Public
+// images are pulled anonymously. Otherwise, credentials are read from
+// CI_REGISTRY_USER and CI_REGISTRY_PASSWORD, or from CI_JOB_TOKEN (or the
+// file named by CI_JOB_TOKEN_FILE), which GitLab CI sets for every job.
+// Self-hosted GitLab registries can be declared in the registry config with
+// the "gitlab" auth type. If client is nil, a shared client is used.
+func NewGitLabWrapper(client *http.Client) (*V2Wrapper, error) {
+	return newV2Wrapper(RegistryConfig{Host: GitLabHost, Auth: AuthConfig{Type: "gitlab"}}, httpClient(client))
+}
+
+// newGitLabAuthenticator requests tokens from the realm GitLab challenges
+// with, which is on the GitLab instance rather than the registry, such as
+// 'https://gitlab.com/jwt/auth'.
+func newGitLabAuthenticator(authConf AuthConfig, client *http.Client) (authenticator, error) {
+	username := os.ExpandEnv(authConf.Username)
+	password := os.ExpandEnv(authConf.Password)
+	if username == "" && password == "" {
+		username = os.Getenv("CI_REGISTRY_USER")
+		password = os.Getenv("CI_REGISTRY_PASSWORD")
+	}
+	if username == "" && password == "" {
+		token, err := cloudCredential(authConf, "CI_JOB_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			username, password = "gitlab-ci-token", token
+		}
+	}
+	if username == "" && password == "" {
+		return &anonymousAuth{client: client}, nil
+	}
+	return &basicAuth{username: username, password: password, client: client}, nil
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGitLabAuth(t *testing.T) {
+	tests := []struct {
+		env map[string]string
+		ok  bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"CI_JOB_TOKEN": "wrong"}, false},
+		{map[string]string{"CI_JOB_TOKEN": "job-token"}, true},
+		{map[string]string{"CI_REGISTRY_USER": "gitlab-ci-token", "CI_REGISTRY_PASSWORD": "job-token"}, true},
+	}
+	for _, test := range tests {
+		// GitLab's realm is on the GitLab instance, not on the registry.
+		auth := newTestRegistry(t, nil)
+		auth.username, auth.password = "gitlab-ci-token", "job-token"
+		r := newTestRegistry(t, map[string]string{"group/project/app:1.0": "digest"})
+		r.username, r.bearer, r.realm = "gitlab-ci-token", true, auth.URL+"/token"
+		for k, v := range test.env {
+			os.Setenv(k, v)
+		}
+		assertDigest(t, RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "gitlab"}, Insecure: true}, r.host()+"/group/project/app", test.ok)
+		for k := range test.env {
+			os.Unsetenv(k)
+		}
+		for _, authorization := range r.authorizations() {
+			if strings.HasPrefix(authorization, "Basic") {
+				t.Fatalf("Registry received credentials '%s'. Expected only tokens.", authorization)
+			}
+		}
+	}
+}
+
+func TestGitLabAnonymous(t *testing.T) {
+	auth := newTestRegistry(t, nil)
+	r := newTestRegistry(t, map[string]string{"group/project/app:1.0": "digest"})
+	r.bearer, r.realm = true, auth.URL+"/token"
+	assertDigest(t, RegistryConfig{Host: r.host(), Auth: AuthConfig{Type: "gitlab"}, Insecure: true}, r.host()+"/group/project/app", true)
+}
+
+func TestHostedRegistryWrappers(t *testing.T) {
+	wm := NewWrapperManager(&prefixWrapper{})
+	ghcrWrapper, err := NewGHCRWrapper(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitLabWrapper, err := NewGitLabWrapper(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm.Add(ghcrWrapper, gitLabWrapper)
+	tests := []struct {
+		imageName string
+		expected  Wrapper
+	}{
+		{"ghcr.io/myorg/app", ghcrWrapper},
+		{"registry.gitlab.com/group/project/app", gitLabWrapper},
+		{"myorg/ghcr.io", wm.defaultWrapper},
+		{"gitlab.com/group/project/app", wm.defaultWrapper},
+	}
+	for _, test := range tests {
+		if got := wm.GetWrapper(test.imageName); got != test.expected {
+			t.Fatalf("Got wrapper with prefix '%s' for '%s'. Expected '%s'.", got.Prefix(), test.imageName, test.expected.Prefix())
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package registry
 
-import "strings"
+import (
+	"path"
+	"strings"
+)
 
 type WrapperManager struct {
 	defaultWrapper Wrapper
@@ -15,11 +18,76 @@ func (m *WrapperManager) Add(wrappers ...Wrapper) {
 	m.wrappers = append(m.wrappers, wrappers...)
 }
 
+// AddConfig adds wrappers for the registries declared in conf. If conf has
+// RegistryMirrors, the default wrapper resolves images through them first.
+func (m *WrapperManager) AddConfig(conf *Config) error {
+	wrappers, err := NewWrappers(conf)
+	if err != nil {
+		return err
+	}
+	m.Add(wrappers...)
+	if len(conf.RegistryMirrors) != 0 {
+		client, err := NewHTTPClient(conf.HTTP)
+		if err != nil {
+			return err
+		}
+		m.defaultWrapper = NewMirrorWrapper(m.defaultWrapper, conf.RegistryMirrors, conf.VerifyMirrors, client)
+	}
+	return nil
+}
+
+// GetWrapper returns the wrapper whose prefix matches the registry host of
+// imageName. Prefixes may contain wildcards, such as '*.azurecr.io/'. If
+// several wrappers match, the most specific prefix wins, so that an exact
+// host takes precedence over a wildcard. Names without a registry host, such
+// as 'ubuntu' or 'myorg/mcr.microsoft.com-mirror', belong to Docker Hub.
 func (m *WrapperManager) GetWrapper(imageName string) Wrapper {
+	host, _ := splitImageName(imageName)
+	if host == "" {
+		host = "docker.io"
+	}
+	var bestWrapper Wrapper
+	bestSpecificity := -1
 	for _, wrapper := range m.wrappers {
-		if strings.Contains(imageName, wrapper.Prefix()) {
-			return wrapper
+		pattern := strings.TrimSuffix(wrapper.Prefix(), "/")
+		if pattern == "" || !matchHost(pattern, host) {
+			continue
+		}
+		if specificity := hostSpecificity(pattern); specificity > bestSpecificity {
+			bestWrapper = wrapper
+			bestSpecificity = specificity
 		}
 	}
-	return m.defaultWrapper
+	if bestWrapper == nil {
+		return m.defaultWrapper
+	}
+	return bestWrapper
+}
+
+func matchHost(pattern string, host string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return err == nil && ok
+}
+
+func hostSpecificity(pattern string) int {
+	specificity := len(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+	if !strings.ContainsAny(pattern, "*?[") {
+		specificity += 1 << 16
+	}
+	return specificity
+}
+
+// splitImageName splits an image name, such as 'localhost:5000/repo/image',
+// into its registry host and repository. As in docker, the first component
+// is only a host if it contains a '.' or a ':', or is 'localhost'.
+func splitImageName(name string) (string, string) {
+	i := strings.Index(name, "/")
+	if i == -1 {
+		return "", name
+	}
+	host := name[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return "", name
+	}
+	return host, name[i+1:]
 }
@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+type prefixWrapper struct {
+	prefix string
+}
+
+func (w *prefixWrapper) GetDigest(name string, tag string) (string, error) {
+	return w.prefix, nil
+}
+
+func (w *prefixWrapper) GetTags(name string) ([]string, error) {
+	return nil, nil
+}
+
+func (w *prefixWrapper) Prefix() string {
+	return w.prefix
+}
+
+func TestGetWrapper(t *testing.T) {
+	defaultWrapper := &prefixWrapper{}
+	wm := NewWrapperManager(defaultWrapper)
+	wm.Add(&ElasticWrapper{}, &MCRWrapper{})
+	wildcard := &prefixWrapper{prefix: "*.example.com/"}
+	exact := &prefixWrapper{prefix: "registry.example.com/"}
+	deepWildcard := &prefixWrapper{prefix: "*.eu.example.com/"}
+	local := &prefixWrapper{prefix: "localhost:5000/"}
+	wm.Add(wildcard, exact, deepWildcard, local)
+	tests := []struct {
+		imageName string
+		expected  Wrapper
+	}{
+		{"ubuntu", defaultWrapper},
+		{"library/ubuntu", defaultWrapper},
+		{"myorg/mcr.microsoft.com-mirror", defaultWrapper},
+		{"evil.com/docker.elastic.co/elasticsearch/elasticsearch", defaultWrapper},
+		{"evil.com/mcr.microsoft.com/dotnet/core/sdk", defaultWrapper},
+		{"docker.elastic.co.evil.com/elasticsearch/elasticsearch", defaultWrapper},
+		{"docker.elastic.co/elasticsearch/elasticsearch", wm.wrappers[0]},
+		{"mcr.microsoft.com/dotnet/core/sdk", wm.wrappers[1]},
+		{"MCR.Microsoft.com/dotnet/core/sdk", wm.wrappers[1]},
+		{"registry.example.com/team/app", exact},
+		{"other.example.com/team/app", wildcard},
+		{"registry.eu.example.com/team/app", deepWildcard},
+		{"example.com/team/app", defaultWrapper},
+		{"evil.com/registry.example.com/team/app", defaultWrapper},
+		{"localhost:5000/team/app", local},
+		{"localhost:5001/team/app", defaultWrapper},
+	}
+	for _, test := range tests {
+		if got := wm.GetWrapper(test.imageName); got != test.expected {
+			t.Fatalf("Got wrapper with prefix '%s' for '%s'. Expected '%s'.", got.Prefix(), test.imageName, test.expected.Prefix())
+		}
+	}
+}
+
+func TestCredentialsOnlySentToMatchingHost(t *testing.T) {
+	digests := map[string]string{"team/app:1.0": "digest"}
+	private := newTestRegistry(t, digests)
+	private.username, private.password = "user", "secret"
+	other := newTestRegistry(t, map[string]string{
+		private.host() + "/team/app:1.0": "digest",
+		"team/app:1.0":                   "digest",
+	})
+	other.username, other.password = "user", "secret"
+	conf := &Config{Registries: []RegistryConfig{
+		{Host: private.host(), Auth: AuthConfig{Type: "basic", Username: "user", Password: "secret"}, Insecure: true},
+		{Host: other.host(), Insecure: true},
+	}}
+	wm := NewWrapperManager(&prefixWrapper{})
+	if err := wm.AddConfig(conf); err != nil {
+		t.Fatal(err)
+	}
+	for _, imageName := range []string{
+		other.host() + "/" + private.host() + "/team/app",
+		other.host() + "/team/app",
+	} {
+		if _, err := wm.GetWrapper(imageName).GetDigest(imageName, "1.0"); err == nil {
+			t.Fatalf("'%s' should not be authorized with credentials for '%s'.", imageName, private.host())
+		}
+	}
+	imageName := private.host() + "/team/app"
+	if _, err := wm.GetWrapper(imageName).GetDigest(imageName, "1.0"); err != nil {
+		t.Fatal(err)
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	for _, auth := range other.authorizations() {
+		if strings.Contains(auth, credentials) || auth != "" {
+			t.Fatalf("'%s' received authorization '%s'.", other.host(), auth)
+		}
+	}
+	var authorized bool
+	for _, auth := range private.authorizations() {
+		authorized = authorized || auth == "Basic "+credentials
+	}
+	if !authorized {
+		t.Fatalf("'%s' never received credentials.", private.host())
+	}
+}
+
+func TestSplitImageName(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		repo string
+	}{
+		{"ubuntu", "", "ubuntu"},
+		{"mperel/log", "", "mperel/log"},
+		{"localhost/app", "localhost", "app"},
+		{"localhost:5000/team/app", "localhost:5000", "team/app"},
+		{"mcr.microsoft.com/dotnet/core/sdk", "mcr.microsoft.com", "dotnet/core/sdk"},
+	}
+	for _, test := range tests {
+		host, repo := splitImageName(test.name)
+		if host != test.host || repo != test.repo {
+			t.Fatalf("Got '%s' and '%s' for '%s'. Expected '%s' and '%s'.", host, repo, test.name, test.host, test.repo)
+		}
+	}
+}
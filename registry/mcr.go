@@ -6,7 +6,10 @@ import (
 	"strings"
 )
 
-type MCRWrapper struct{}
+type MCRWrapper struct {
+	// Client is used for requests to MCR. If nil, a shared client is used.
+	Client *http.Client
+}
 
 func (w *MCRWrapper) GetDigest(name string, tag string) (string, error) {
 	prefix := w.Prefix()
@@ -17,7 +20,7 @@ func (w *MCRWrapper) GetDigest(name string, tag string) (string, error) {
 		return "", err
 	}
 	req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
-	client := &http.Client{}
+	client := httpClient(w.Client)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -30,6 +33,17 @@ func (w *MCRWrapper) GetDigest(name string, tag string) (string, error) {
 	return strings.TrimPrefix(digest, "sha256:"), nil
 }
 
+func (w *MCRWrapper) GetTags(name string) ([]string, error) {
+	prefix := w.Prefix()
+	name = strings.Replace(name, prefix, "", 1)
+	return w.v2Client().getTags(strings.TrimSuffix(prefix, "/"), name)
+}
+
+func (w *MCRWrapper) v2Client() *v2Client {
+	client := httpClient(w.Client)
+	return &v2Client{scheme: "https", client: client, auth: &anonymousAuth{client: client}}
+}
+
 func (w *MCRWrapper) Prefix() string {
 	return "mcr.microsoft.com/"
 }
@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// mirror is a registry that serves the images of an upstream registry,
+// such as a pull-through cache in front of Docker Hub.
+type mirror struct {
+	host   string
+	client *v2Client
+}
+
+// newMirrors parses mirror hosts such as 'mirror.example.com' or, as in the
+// docker daemon's registry-mirrors, 'https://mirror.example.com'. Mirrors
+// with an 'http://' scheme are accessed without TLS.
+func newMirrors(hosts []string, client *http.Client) []*mirror {
+	mirrors := make([]*mirror, len(hosts))
+	for i, host := range hosts {
+		scheme := "https"
+		if strings.HasPrefix(host, "http://") {
+			scheme = "http"
+		}
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "http://"), "https://")
+		mirrors[i] = &mirror{
+			host:   strings.TrimSuffix(host, "/"),
+			client: &v2Client{scheme: scheme, client: client, auth: &anonymousAuth{client: client}},
+		}
+	}
+	return mirrors
+}
+
+// getMirroredDigest tries each mirror in order, falling back to upstream if
+// none of them has the image. If verify is set, the mirror's digest must
+// match upstream's, so that a stale or compromised mirror cannot change the
+// Lockfile.
+func getMirroredDigest(mirrors []*mirror, repo string, tag string, verify bool, upstream func() (string, error)) (string, error) {
+	for _, m := range mirrors {
+		digest, err := m.client.getDigest(m.host, repo, tag)
+		if err != nil {
+			continue
+		}
+		if !verify {
+			return digest, nil
+		}
+		upstreamDigest, err := upstream()
+		if err != nil {
+			return "", err
+		}
+		if digest != upstreamDigest {
+			return "", fmt.Errorf("Digest '%s' from mirror '%s' does not match digest '%s' from upstream for '%s:%s'.", digest, m.host, upstreamDigest, repo, tag)
+		}
+		return digest, nil
+	}
+	return upstream()
+}
+
+// MirrorWrapper resolves Docker Hub images through mirrors before asking
+// Docker Hub itself, as registry-mirrors does in the docker daemon config.
+// Images are still recorded under their Docker Hub names.
+type MirrorWrapper struct {
+	Wrapper
+	Mirrors       []string
+	VerifyMirrors bool
+	mirrors       []*mirror
+}
+
+// NewMirrorWrapper requests mirrors with client, or with the shared client
+// if client is nil.
+func NewMirrorWrapper(upstream Wrapper, mirrors []string, verifyMirrors bool, client *http.Client) *MirrorWrapper {
+	return &MirrorWrapper{Wrapper: upstream,
+		Mirrors:       mirrors,
+		VerifyMirrors: verifyMirrors,
+		mirrors:       newMirrors(mirrors, httpClient(client)),
+	}
+}
+
+func (w *MirrorWrapper) GetDigest(name string, tag string) (string, error) {
+	repo := name
+	if !strings.Contains(repo, "/") {
+		repo = "library/" + repo
+	}
+	return getMirroredDigest(w.mirrors, repo, tag, w.VerifyMirrors, func() (string, error) {
+		return w.Wrapper.GetDigest(name, tag)
+	})
+}
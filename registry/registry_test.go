@@ -0,0 +1,182 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testRegistry stands in for a registry that implements the Docker Registry
+// HTTP API V2. It challenges unauthorized requests if username or password
+// is set, with a bearer challenge for its own token endpoint if bearer is set.
+// If refreshToken is set, it challenges with its '/oauth2/token' endpoint,
+// which exchanges the refresh token for access tokens as ACR does. If realm
+// is set, it challenges with realm instead, such as another testRegistry's
+// token endpoint. If only bearer is set, anonymous tokens are accepted. Tags
+// are listed in pages of pageSize tags, if it is set. Artifacts are served
+// by path, such as 'team/app/blobs/sha256:<hex>'. Images in manifestLists
+// are multi-arch: their manifest list's digest is served to requests that
+// accept manifest lists or OCI indexes, and the digest in digests, of a
+// single platform's manifest, to others.
+type testRegistry struct {
+	*httptest.Server
+	digests       map[string]string
+	manifestLists map[string]string
+	username      string
+	password      string
+	bearer        bool
+	refreshToken  string
+	realm         string
+	pageSize      int
+	artifacts     map[string][]byte
+	mu            sync.Mutex
+	auths         []string
+}
+
+func newTestRegistry(t *testing.T, digests map[string]string) *testRegistry {
+	r := &testRegistry{digests: digests}
+	r.Server = httptest.NewTLSServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(strings.TrimPrefix(r.URL, "https://"), "http://")
+}
+
+func (r *testRegistry) authorizations() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.auths...)
+}
+
+func (r *testRegistry) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	auth := req.Header.Get("Authorization")
+	r.mu.Lock()
+	r.auths = append(r.auths, auth)
+	r.mu.Unlock()
+	if req.URL.Path == "/token" {
+		username, password, _ := req.BasicAuth()
+		if username != r.username || password != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"token": "token-for-" + req.URL.Query().Get("scope")})
+		return
+	}
+	if req.URL.Path == "/oauth2/token" {
+		if req.Method != "POST" || req.PostFormValue("grant_type") != "refresh_token" || req.PostFormValue("refresh_token") != r.refreshToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token-for-" + req.PostFormValue("scope")})
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, "/v2/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	repo := strings.TrimSuffix(path, "/tags/list")
+	if i := strings.LastIndex(path, "/manifests/"); i != -1 {
+		repo = path[:i]
+	} else if i := strings.LastIndex(path, "/blobs/"); i != -1 {
+		repo = path[:i]
+	}
+	if r.username != "" || r.password != "" || r.refreshToken != "" || r.bearer {
+		var authorized bool
+		if r.bearer {
+			authorized = auth == "Bearer token-for-repository:"+repo+":pull"
+			realm := r.URL + "/token"
+			if r.refreshToken != "" {
+				realm = r.URL + "/oauth2/token"
+			}
+			if r.realm != "" {
+				realm = r.realm
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+realm+`",service="test"`)
+		} else {
+			username, password, ok := req.BasicAuth()
+			authorized = ok && username == r.username && password == r.password
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+		}
+		if !authorized {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if artifact, ok := r.artifacts[path]; ok {
+		w.Write(artifact)
+		return
+	}
+	if strings.HasSuffix(path, "/tags/list") {
+		r.serveTags(w, req, repo)
+		return
+	}
+	i := strings.LastIndex(path, "/manifests/")
+	if i == -1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	image := path[:i] + ":" + path[i+len("/manifests/"):]
+	digest, ok := r.digests[image]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if listDigest, ok := r.manifestLists[image]; ok {
+		for _, mediaType := range req.Header.Values("Accept") {
+			if mediaType == "application/vnd.docker.distribution.manifest.list.v2+json" || mediaType == "application/vnd.oci.image.index.v1+json" {
+				digest = listDigest
+			}
+		}
+	}
+	w.Header().Set("Docker-Content-Digest", "sha256:"+digest)
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveTags lists the tags of repo in pages of pageSize tags, linking to
+// the next page as registries do.
+func (r *testRegistry) serveTags(w http.ResponseWriter, req *http.Request, repo string) {
+	var tags []string
+	for image := range r.digests {
+		if i := strings.LastIndex(image, ":"); image[:i] == repo {
+			tags = append(tags, image[i+1:])
+		}
+	}
+	sort.Strings(tags)
+	if last := req.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(tags, last)
+		if i < len(tags) && tags[i] == last {
+			i++
+		}
+		tags = tags[i:]
+	}
+	if r.pageSize != 0 && len(tags) > r.pageSize {
+		tags = tags[:r.pageSize]
+		next := fmt.Sprintf("/v2/%s/tags/list?n=%d&last=%s", repo, r.pageSize, tags[len(tags)-1])
+		w.Header().Set("Link", `<`+next+`>; rel="next"`)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": tags})
+}
+
+func writeConfig(t *testing.T, conf string) string {
+	dir, err := ioutil.TempDir("", "docker-lock-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	fpath := filepath.Join(dir, "registries.json")
+	if err := ioutil.WriteFile(fpath, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fpath
+}
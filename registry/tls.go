@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultCertsDir is where docker looks for registry certificates, in a
+// directory per host such as '/etc/docker/certs.d/localhost:5000/'.
+const defaultCertsDir = "/etc/docker/certs.d"
+
+// newHTTPClient returns client, or a client like it with the registry's TLS
+// configuration.
+func newHTTPClient(regConf RegistryConfig, client *http.Client) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(regConf)
+	if err != nil {
+		return nil, fmt.Errorf("%s. From registry: '%s'.", err, regConf.Host)
+	}
+	if tlsConfig == nil {
+		return client, nil
+	}
+	return withTransport(client, func(transport *http.Transport) {
+		transport.TLSClientConfig = tlsConfig
+	}), nil
+}
+
+// newTLSConfig returns nil if the registry needs no TLS configuration beyond
+// the system's CAs.
+func newTLSConfig(regConf RegistryConfig) (*tls.Config, error) {
+	if (regConf.CertFile == "") != (regConf.KeyFile == "") {
+		return nil, fmt.Errorf("Both certFile and keyFile are required for a client certificate")
+	}
+	var caFiles []string
+	if regConf.CAFile != "" {
+		caFiles = append(caFiles, regConf.CAFile)
+	}
+	var certs []tls.Certificate
+	if regConf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(regConf.CertFile, regConf.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	certsDir := regConf.CertsDir
+	if certsDir == "" {
+		certsDir = defaultCertsDir
+	}
+	dirCAFiles, dirCerts, err := loadCertsDir(filepath.Join(certsDir, regConf.Host))
+	if err != nil {
+		return nil, err
+	}
+	caFiles = append(caFiles, dirCAFiles...)
+	certs = append(certs, dirCerts...)
+	if !regConf.Insecure && len(caFiles) == 0 && len(certs) == 0 {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: regConf.Insecure, Certificates: certs}
+	if len(caFiles) != 0 {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		for _, caFile := range caFiles {
+			caByt, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				return nil, err
+			}
+			if !rootCAs.AppendCertsFromPEM(caByt) {
+				return nil, fmt.Errorf("No certificates found in CA file '%s'", caFile)
+			}
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	return tlsConfig, nil
+}
+
+// loadCertsDir reads a directory laid out as docker expects: '*.crt' files
+// are CA certificates and each '*.cert' file is a client certificate whose
+// key is in the '*.key' file of the same name. A missing directory is not
+// an error.
+func loadCertsDir(dir string) ([]string, []tls.Certificate, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var caFiles []string
+	var certs []tls.Certificate
+	for _, entry := range entries {
+		fpath := filepath.Join(dir, entry.Name())
+		switch filepath.Ext(entry.Name()) {
+		case ".crt":
+			caFiles = append(caFiles, fpath)
+		case ".cert":
+			keyFile := strings.TrimSuffix(fpath, ".cert") + ".key"
+			cert, err := tls.LoadX509KeyPair(fpath, keyFile)
+			if err != nil {
+				return nil, nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return caFiles, certs, nil
+}
@@ -0,0 +1,152 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCAFile(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{"team/app:1.0": "digest"})
+	dir := tempDir(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", r.Certificate().Raw)
+	tests := []struct {
+		regConf RegistryConfig
+		ok      bool
+	}{
+		{RegistryConfig{Host: r.host(), CertsDir: dir}, false},
+		{RegistryConfig{Host: r.host(), CertsDir: dir, CAFile: caFile}, true},
+		{RegistryConfig{Host: r.host(), CertsDir: dir, Insecure: true}, true},
+	}
+	for _, test := range tests {
+		assertDigest(t, test.regConf, r.host()+"/team/app", test.ok)
+	}
+}
+
+func TestCertsDir(t *testing.T) {
+	r, clientCert, clientKey := newMTLSRegistry(t, map[string]string{"team/app:1.0": "digest"})
+	certsDir := tempDir(t)
+	hostDir := filepath.Join(certsDir, r.host())
+	if err := os.Mkdir(hostDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(hostDir, "ca.crt"), "CERTIFICATE", r.Certificate().Raw)
+	assertDigest(t, RegistryConfig{Host: r.host(), CertsDir: certsDir}, r.host()+"/team/app", false)
+	writePEM(t, filepath.Join(hostDir, "client.cert"), "CERTIFICATE", clientCert)
+	writePEM(t, filepath.Join(hostDir, "client.key"), "EC PRIVATE KEY", clientKey)
+	assertDigest(t, RegistryConfig{Host: r.host(), CertsDir: certsDir}, r.host()+"/team/app", true)
+	if err := os.Remove(filepath.Join(hostDir, "client.key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewV2Wrapper(RegistryConfig{Host: r.host(), CertsDir: certsDir}); err == nil {
+		t.Fatal("Client certificate without a key should fail.")
+	}
+}
+
+func TestClientCertFile(t *testing.T) {
+	r, clientCert, clientKey := newMTLSRegistry(t, map[string]string{"team/app:1.0": "digest"})
+	dir := tempDir(t)
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", clientCert)
+	writePEM(t, keyFile, "EC PRIVATE KEY", clientKey)
+	regConf := RegistryConfig{Host: r.host(), CertsDir: dir, Insecure: true}
+	assertDigest(t, regConf, r.host()+"/team/app", false)
+	regConf.CertFile, regConf.KeyFile = certFile, keyFile
+	assertDigest(t, regConf, r.host()+"/team/app", true)
+	regConf.KeyFile = ""
+	if _, err := NewV2Wrapper(regConf); err == nil {
+		t.Fatal("certFile without keyFile should fail.")
+	}
+}
+
+func TestPlainHTTP(t *testing.T) {
+	r := &testRegistry{digests: map[string]string{"team/app:1.0": "digest"}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.Close)
+	assertDigest(t, RegistryConfig{Host: r.host()}, r.host()+"/team/app", false)
+	assertDigest(t, RegistryConfig{Host: r.host(), PlainHTTP: true}, r.host()+"/team/app", true)
+}
+
+// newMTLSRegistry starts a testRegistry that requires a client certificate,
+// returning a certificate and key that it accepts.
+func newMTLSRegistry(t *testing.T, digests map[string]string) (*testRegistry, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "docker-lock"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyByt, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedCert, err := x509.ParseCertificate(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(parsedCert)
+	r := &testRegistry{digests: digests}
+	r.Server = httptest.NewUnstartedServer(http.HandlerFunc(r.serveHTTP))
+	r.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	r.StartTLS()
+	t.Cleanup(r.Close)
+	return r, cert, keyByt
+}
+
+func assertDigest(t *testing.T, regConf RegistryConfig, name string, ok bool) {
+	t.Helper()
+	w, err := NewV2Wrapper(regConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := w.GetDigest(name, "1.0")
+	if ok && err != nil {
+		t.Fatalf("Config '%+v' failed. %s", regConf, err)
+	}
+	if !ok && err == nil {
+		t.Fatalf("Config '%+v' should fail.", regConf)
+	}
+	if ok && digest != "digest" {
+		t.Fatalf("Got '%s'. Expected 'digest'.", digest)
+	}
+}
+
+func writePEM(t *testing.T, fpath string, blockType string, byt []byte) {
+	pemByt := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: byt})
+	if err := ioutil.WriteFile(fpath, pemByt, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "docker-lock-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
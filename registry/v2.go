@@ -0,0 +1,361 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// digestMediaTypes are accepted when resolving digests. As Docker Hub always
+// has been, every registry is asked for a single manifest, so that a
+// multi-arch image is locked to the digest of its default platform's
+// manifest, whether or not it is resolved through a mirror.
+var digestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// V2Wrapper gets digests from any registry that implements the Docker
+// Registry HTTP API V2. It is usually built from a RegistryConfig.
+type V2Wrapper struct {
+	// Host matches the registry host of image names, such as
+	// 'harbor.example.com' or 'localhost:5000'.
+	Host string
+	// Mirrors are tried in order before Host.
+	Mirrors       []string
+	VerifyMirrors bool
+	client        *v2Client
+	mirrors       []*mirror
+	lowercase     bool
+}
+
+func (w *V2Wrapper) GetDigest(name string, tag string) (string, error) {
+	_, repo := splitImageName(name)
+	if w.lowercase {
+		repo = strings.ToLower(repo)
+	}
+	return getMirroredDigest(w.mirrors, repo, tag, w.VerifyMirrors, func() (string, error) {
+		return w.client.getDigest(w.registryHost(name), repo, tag)
+	})
+}
+
+func (w *V2Wrapper) GetTags(name string) ([]string, error) {
+	_, repo := splitImageName(name)
+	if w.lowercase {
+		repo = strings.ToLower(repo)
+	}
+	return w.client.getTags(w.registryHost(name), repo)
+}
+
+func (w *V2Wrapper) Prefix() string {
+	return w.Host + "/"
+}
+
+func (w *V2Wrapper) registryHost(name string) string {
+	if host, _ := splitImageName(name); host != "" {
+		return host
+	}
+	return w.Host
+}
+
+type v2Client struct {
+	scheme string
+	client *http.Client
+	auth   authenticator
+}
+
+func (c *v2Client) getDigest(host string, repo string, tag string) (string, error) {
+	registryURL := c.scheme + "://" + host + "/v2/" + repo + "/manifests/" + tag
+	resp, err := c.get(registryURL, repo, digestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unexpected status '%s' from '%s'.", resp.Status, registryURL)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", errors.New("No digest found")
+	}
+	return strings.TrimPrefix(digest, "sha256:"), nil
+}
+
+type tagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// getTags lists the tags of repo, following the Link headers of paginated
+// responses.
+func (c *v2Client) getTags(host string, repo string) ([]string, error) {
+	tagsURL := c.scheme + "://" + host + "/v2/" + repo + "/tags/list"
+	var tags []string
+	visited := make(map[string]bool)
+	for tagsURL != "" && !visited[tagsURL] {
+		visited[tagsURL] = true
+		resp, err := c.get(tagsURL, repo, []string{"application/json"})
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Unexpected status '%s' from '%s'.", resp.Status, tagsURL)
+		}
+		var t tagsResponse
+		err = json.NewDecoder(resp.Body).Decode(&t)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s. From '%s'.", err, tagsURL)
+		}
+		tags = append(tags, t.Tags...)
+		if tagsURL, err = nextLink(resp.Request.URL, resp.Header.Get("Link")); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// nextLink returns the URL of the next page from a Link header such as
+// '</v2/repo/tags/list?n=100&last=1.2>; rel="next"', resolved against the
+// URL of the current page. It returns "" on the last page.
+func nextLink(current *url.URL, header string) (string, error) {
+	for _, link := range strings.Split(header, ",") {
+		fields := strings.Split(link, ";")
+		target := strings.TrimSpace(fields[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+			if param != `rel="next"` && param != "rel=next" {
+				continue
+			}
+			next, err := current.Parse(target[1 : len(target)-1])
+			if err != nil {
+				return "", err
+			}
+			return next.String(), nil
+		}
+	}
+	return "", nil
+}
+
+// get requests url, answering an authentication challenge from the registry
+// if the first request is unauthorized.
+func (c *v2Client) get(url string, repo string, accept []string) (*http.Response, error) {
+	newRequest := func(ch *challenge) (*http.Request, error) {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		if err := c.auth.authorize(req, ch, repo); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+	req, err := newRequest(nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	ch := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	resp.Body.Close()
+	if ch == nil {
+		return nil, fmt.Errorf("Unauthorized by '%s' without an authentication challenge.", url)
+	}
+	if req, err = newRequest(ch); err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// 'Bearer realm="https://auth.docker.io/token",service="registry.docker.io"'.
+func parseChallenge(header string) *challenge {
+	fields := strings.SplitN(strings.TrimSpace(header), " ", 2)
+	if fields[0] == "" {
+		return nil
+	}
+	ch := &challenge{scheme: strings.ToLower(fields[0]), params: make(map[string]string)}
+	if len(fields) == 1 {
+		return ch
+	}
+	rest := fields[1]
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end == -1 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma != -1 {
+			val, rest = rest[:comma], rest[comma:]
+		} else {
+			val, rest = rest, ""
+		}
+		ch.params[key] = val
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return ch
+}
+
+type authenticator interface {
+	// authorize sets the Authorization header of req to access repo.
+	// ch is nil until the registry has challenged a request.
+	authorize(req *http.Request, ch *challenge, repo string) error
+}
+
+// anonymousAuth answers bearer challenges with anonymous tokens,
+// which registries issue for public images.
+type anonymousAuth struct {
+	client *http.Client
+}
+
+func (a *anonymousAuth) authorize(req *http.Request, ch *challenge, repo string) error {
+	if ch == nil {
+		return nil
+	}
+	if ch.scheme != "bearer" {
+		return fmt.Errorf("Registry '%s' requires credentials.", req.URL.Host)
+	}
+	token, err := fetchToken(a.client, ch.params["realm"], ch.params["service"], repo, "", "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// basicAuth answers basic challenges with a username and password, and
+// bearer challenges with a token requested with the username and password.
+type basicAuth struct {
+	username string
+	password string
+	client   *http.Client
+}
+
+func (a *basicAuth) authorize(req *http.Request, ch *challenge, repo string) error {
+	if ch == nil {
+		return nil
+	}
+	switch ch.scheme {
+	case "basic":
+		req.SetBasicAuth(a.username, a.password)
+	case "bearer":
+		token, err := fetchToken(a.client, ch.params["realm"], ch.params["service"], repo, a.username, a.password)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	default:
+		return fmt.Errorf("Unsupported authentication scheme '%s'.", ch.scheme)
+	}
+	return nil
+}
+
+// bearerAuth sends a static token, such as a personal access token.
+type bearerAuth struct {
+	token string
+}
+
+func (a *bearerAuth) authorize(req *http.Request, ch *challenge, repo string) error {
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+// tokenAuth requests a token from a configured token endpoint before
+// the registry challenges, as DockerWrapper does for Docker Hub.
+type tokenAuth struct {
+	realm    string
+	service  string
+	username string
+	password string
+	client   *http.Client
+}
+
+func (a *tokenAuth) authorize(req *http.Request, ch *challenge, repo string) error {
+	token, err := fetchToken(a.client, a.realm, a.service, repo, a.username, a.password)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+func fetchToken(client *http.Client, realm string, service string, repo string, username string, password string) (string, error) {
+	if realm == "" {
+		return "", errors.New("No realm to request a token from.")
+	}
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+	query := tokenURL.Query()
+	query.Set("scope", "repository:"+repo+":pull")
+	if service != "" {
+		query.Set("service", service)
+	}
+	tokenURL.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Unexpected status '%s' from token endpoint '%s'.", resp.Status, realm)
+	}
+	var t tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+	if t.Token == "" {
+		t.Token = t.AccessToken
+	}
+	if t.Token == "" {
+		return "", fmt.Errorf("No token from token endpoint '%s'.", realm)
+	}
+	return t.Token, nil
+}
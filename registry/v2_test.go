@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestGetTags(t *testing.T) {
+	r := newTestRegistry(t, map[string]string{
+		"team/app:1.0":   "a",
+		"team/app:1.1":   "b",
+		"team/app:2.0":   "c",
+		"team/app:2.1":   "d",
+		"team/app:3.0":   "e",
+		"team/other:9.9": "f",
+	})
+	r.pageSize = 2
+	r.username, r.password, r.bearer = "user", "secret", true
+	w, err := NewV2Wrapper(RegistryConfig{Host: r.host(),
+		Auth:     AuthConfig{Type: "basic", Username: "user", Password: "secret"},
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := w.GetTags(r.host() + "/team/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"1.0", "1.1", "2.0", "2.1", "3.0"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("Got '%v'. Expected '%v'.", tags, expected)
+	}
+	if _, err := w.GetTags(r.host() + "/team/missing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	current, err := url.Parse("https://registry.example.com/v2/team/app/tags/list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header string
+		next   string
+	}{
+		{"", ""},
+		{`</v2/team/app/tags/list?n=2&last=1.1>; rel="next"`, "https://registry.example.com/v2/team/app/tags/list?n=2&last=1.1"},
+		{`<https://cdn.example.com/tags?page=2>; rel=next`, "https://cdn.example.com/tags?page=2"},
+		{`</first>; rel="first", </second>; rel="next"`, "https://registry.example.com/second"},
+		{`</prev>; rel="prev"`, ""},
+	}
+	for _, test := range tests {
+		next, err := nextLink(current, test.header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != test.next {
+			t.Fatalf("Got '%s' for '%s'. Expected '%s'.", next, test.header, test.next)
+		}
+	}
+}
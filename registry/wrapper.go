@@ -2,5 +2,7 @@ package registry
 
 type Wrapper interface {
 	GetDigest(name string, tag string) (string, error)
+	// GetTags lists every tag of the image name.
+	GetTags(name string) ([]string, error)
 	Prefix() string
 }
@@ -0,0 +1,39 @@
+package rewrite
+
+import (
+	"flag"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+type Flags struct {
+	Outfile string
+	// LockfileFormat is the name of the Lockfile's format, such as 'yaml'.
+	// If empty, the format is chosen by Outfile's extension.
+	LockfileFormat string
+	EnvFile        string
+}
+
+func NewFlags(cmdLineArgs []string) (*Flags, error) {
+	var outfile string
+	var lockfileFormat string
+	var envFile string
+	command := flag.NewFlagSet("rewrite", flag.ExitOnError)
+	command.StringVar(&outfile, "o", "docker-lock.json", "Path to Lockfile whose digests are written into its files.")
+	command.StringVar(&lockfileFormat, "lockfile-format", "", "Format of the Lockfile, 'json', 'yaml' or 'toml'. Defaults to the format of the Lockfile's extension, or 'json'.")
+	command.StringVar(&envFile, "e", ".env", "Path to .env file.")
+	command.Parse(cmdLineArgs)
+	if _, err := generate.GetLockfileFormat(lockfileFormat, outfile); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(envFile); err != nil {
+		if envFile != ".env" {
+			return nil, err
+		}
+	} else if err := godotenv.Load(envFile); err != nil {
+		return nil, err
+	}
+	return &Flags{Outfile: outfile, LockfileFormat: lockfileFormat, EnvFile: envFile}, nil
+}
@@ -0,0 +1,27 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func TestDefaultFlags(t *testing.T) {
+	f, err := NewFlags([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Outfile != "docker-lock.json" {
+		t.Fatalf("Got '%s' outfile. Expected 'docker-lock.json'.", f.Outfile)
+	}
+}
+
+func TestFaultyLockfileFormat(t *testing.T) {
+	if _, err := NewFlags([]string{"-lockfile-format", "xml"}); err == nil {
+		t.Fatal("Unknown Lockfile format should fail.")
+	}
+}
+
+func TestMissingEnvFile(t *testing.T) {
+	if _, err := NewFlags([]string{"-e", "missing.env"}); err == nil {
+		t.Fatal("Missing env file should fail.")
+	}
+}
@@ -0,0 +1,212 @@
+package rewrite
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+// Rewriter pins the images written in the files of a Lockfile to their
+// locked digests, such as 'FROM node:12' to
+// 'FROM node:12@sha256:<digest>'. Images are rewritten in place, at the
+// location that generate.ImageLines reports, so that comments and
+// formatting are kept. Images written with variables, such as
+// 'FROM node:${VERSION}', and images without a location are not rewritten.
+type Rewriter struct {
+	*generate.Generator
+	*generate.Lockfile
+}
+
+func NewRewriter(flags *Flags) (*Rewriter, error) {
+	lFile, err := generate.ReadLockfile(flags.Outfile, flags.LockfileFormat)
+	if err != nil {
+		return nil, err
+	}
+	return NewRewriterFS(nil, lFile), nil
+}
+
+// NewRewriterFS rewrites the files that lFile lists in fsys. If fsys is nil,
+// the host's file system is used.
+func NewRewriterFS(fsys fs.FS, lFile *generate.Lockfile) *Rewriter {
+	g := &generate.Generator{FS: fsys}
+	for fpath := range lFile.DockerfileImages {
+		g.Dockerfiles = append(g.Dockerfiles, filepath.FromSlash(fpath))
+	}
+	for fpath := range lFile.ComposefileImages {
+		g.Composefiles = append(g.Composefiles, filepath.FromSlash(fpath))
+	}
+	for fpath := range lFile.KubernetesfileImages {
+		g.Kubernetesfiles = append(g.Kubernetesfiles, filepath.FromSlash(fpath))
+	}
+	for fpath := range lFile.CIfileImages {
+		g.CIfiles = append(g.CIfiles, filepath.FromSlash(fpath))
+	}
+	bakeTargetSet := make(map[string]bool)
+	for fpath, images := range lFile.BakefileImages {
+		g.Bakefiles = append(g.Bakefiles, filepath.FromSlash(fpath))
+		for _, image := range images {
+			bakeTargetSet[image.Target] = true
+		}
+	}
+	for target := range bakeTargetSet {
+		g.BakeTargets = append(g.BakeTargets, target)
+	}
+	sort.Strings(g.Dockerfiles)
+	sort.Strings(g.Composefiles)
+	sort.Strings(g.Kubernetesfiles)
+	sort.Strings(g.CIfiles)
+	sort.Strings(g.Bakefiles)
+	sort.Strings(g.BakeTargets)
+	return &Rewriter{Generator: g, Lockfile: lFile}
+}
+
+type replacement struct {
+	offset int
+	text   string
+	pinned string
+}
+
+// Rewrites returns the rewritten contents of every file that has an image
+// to pin, by file. Files are not modified.
+func (r *Rewriter) Rewrites() (map[string][]byte, error) {
+	imageLines, err := r.ImageLines()
+	if err != nil {
+		return nil, err
+	}
+	locked := r.lockedImages()
+	replacements := make(map[string]map[int]replacement)
+	for _, imageLine := range imageLines {
+		if imageLine.Line == 0 || imageLine.Text != imageLine.Image {
+			continue
+		}
+		key := fmt.Sprintf("%s\x00%s\x00%d", imageLine.Section, imageLine.SectionFile, imageLine.Position)
+		image, ok := locked[key]
+		if !ok || image.Digest == "" {
+			continue
+		}
+		if name := imageName(imageLine.Image); name != image.Name {
+			return nil, fmt.Errorf("Image '%s' is locked as '%s'. Regenerate the Lockfile. From file: '%s:%d:%d'.", imageLine.Image, image.Name, imageLine.File, imageLine.Line, imageLine.Column)
+		}
+		// The tag is kept as written, so that a constraint such as 'node:12'
+		// is not replaced by the tag it resolved to.
+		pinned := imageLine.Text
+		if i := strings.Index(pinned, "@"); i != -1 {
+			pinned = pinned[:i]
+		}
+		pinned += "@sha256:" + image.Digest
+		if replacements[imageLine.File] == nil {
+			replacements[imageLine.File] = make(map[int]replacement)
+		}
+		// A Dockerfile built by several docker-compose services is listed
+		// once for each.
+		if other, ok := replacements[imageLine.File][imageLine.Offset]; ok && other.pinned != pinned {
+			return nil, fmt.Errorf("Image '%s' is locked as both '%s' and '%s'. From file: '%s:%d:%d'.", imageLine.Image, other.pinned, pinned, imageLine.File, imageLine.Line, imageLine.Column)
+		}
+		replacements[imageLine.File][imageLine.Offset] = replacement{offset: imageLine.Offset, text: imageLine.Text, pinned: pinned}
+	}
+	rewrites := make(map[string][]byte)
+	for fpath, fileReplacements := range replacements {
+		src, err := r.readFile(fpath)
+		if err != nil {
+			return nil, err
+		}
+		sorted := make([]replacement, 0, len(fileReplacements))
+		for _, repl := range fileReplacements {
+			sorted = append(sorted, repl)
+		}
+		// Replacing from the end of the file keeps earlier offsets valid.
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].offset > sorted[j].offset
+		})
+		rewritten := append([]byte{}, src...)
+		for _, repl := range sorted {
+			end := repl.offset + len(repl.text)
+			if end > len(rewritten) || string(rewritten[repl.offset:end]) != repl.text {
+				return nil, fmt.Errorf("Image '%s' is not at offset %d. From file: '%s'.", repl.text, repl.offset, fpath)
+			}
+			rewritten = append(rewritten[:repl.offset], append([]byte(repl.pinned), rewritten[end:]...)...)
+		}
+		if string(rewritten) != string(src) {
+			rewrites[fpath] = rewritten
+		}
+	}
+	return rewrites, nil
+}
+
+// RewriteFiles writes the Rewrites to the host's file system.
+func (r *Rewriter) RewriteFiles() error {
+	rewrites, err := r.Rewrites()
+	if err != nil {
+		return err
+	}
+	for fpath, byt := range rewrites {
+		fpath = filepath.FromSlash(fpath)
+		info, err := os.Stat(fpath)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fpath, byt, info.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rewriter) lockedImages() map[string]generate.Image {
+	locked := make(map[string]generate.Image)
+	add := func(section string, fpath string, position int, image generate.Image) {
+		locked[fmt.Sprintf("%s\x00%s\x00%d", section, fpath, position)] = image
+	}
+	for fpath, images := range r.DockerfileImages {
+		for i, image := range images {
+			add("dockerfiles", fpath, i, image.Image)
+		}
+	}
+	for fpath, images := range r.ComposefileImages {
+		for i, image := range images {
+			add("composefiles", fpath, i, image.Image)
+		}
+	}
+	for fpath, images := range r.KubernetesfileImages {
+		for i, image := range images {
+			add("kubernetesfiles", fpath, i, image.Image)
+		}
+	}
+	for fpath, images := range r.CIfileImages {
+		for i, image := range images {
+			add("cifiles", fpath, i, image.Image)
+		}
+	}
+	for fpath, images := range r.BakefileImages {
+		for i, image := range images {
+			add("bakefiles", fpath, i, image.Image)
+		}
+	}
+	return locked
+}
+
+func (r *Rewriter) readFile(fpath string) ([]byte, error) {
+	if r.FS == nil {
+		return ioutil.ReadFile(filepath.FromSlash(fpath))
+	}
+	return fs.ReadFile(r.FS, fpath)
+}
+
+// imageName returns the name of an image reference, such as 'node' for
+// 'node:12@sha256:<digest>' or 'localhost:5000/app' for
+// 'localhost:5000/app:1.0'.
+func imageName(ref string) string {
+	if i := strings.Index(ref, "@"); i != -1 {
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
@@ -0,0 +1,120 @@
+package rewrite
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+func TestRewrites(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":         {Data: []byte("ARG VERSION=12\n# Base image.\nFROM ubuntu:18.04 AS base\nFROM node:${VERSION}\nFROM busybox@sha256:old\nFROM base\n")},
+		"docker-compose.yml": {Data: []byte("services:\n  db:\n    image: \"postgres:13\" # Pinned by rewrite.\n  web:\n    build: web\n")},
+		"web/Dockerfile":     {Data: []byte("FROM node:12\n")},
+		"k8s/app.yaml":       {Data: []byte("apiVersion: apps/v1\nkind: Pod\nmetadata:\n  name: app\nspec:\n  containers:\n  - name: app\n    image: localhost:5000/app\n")},
+	}
+	lFile := &generate.Lockfile{
+		DockerfileImages: map[string][]generate.DockerfileImage{
+			"Dockerfile": {
+				{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "aaa"}},
+				{Image: generate.Image{Name: "node", Tag: "12", Digest: "bbb"}},
+				{Image: generate.Image{Name: "busybox", Tag: "", Digest: "ccc"}},
+			},
+		},
+		ComposefileImages: map[string][]generate.ComposefileImage{
+			"docker-compose.yml": {
+				{Image: generate.Image{Name: "postgres", Tag: "13", Digest: "ddd"}, ServiceName: "db"},
+				{Image: generate.Image{Name: "node", Tag: "12", Digest: "eee", Constraint: "^12", ResolvedTag: "12.18.3"}, ServiceName: "web", Dockerfile: "web/Dockerfile"},
+			},
+		},
+		KubernetesfileImages: map[string][]generate.KubernetesfileImage{
+			"k8s/app.yaml": {
+				{Image: generate.Image{Name: "localhost:5000/app", Tag: "latest", Digest: "fff"}, Kind: "Pod", ResourceName: "app", ContainerName: "app"},
+			},
+		},
+	}
+	rewrites, err := NewRewriterFS(fsys, lFile).Rewrites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tag as written is kept, such as '12' for the image whose
+	// constraint resolved to '12.18.3'.
+	expected := map[string]string{
+		"Dockerfile":         "ARG VERSION=12\n# Base image.\nFROM ubuntu:18.04@sha256:aaa AS base\nFROM node:${VERSION}\nFROM busybox@sha256:ccc\nFROM base\n",
+		"docker-compose.yml": "services:\n  db:\n    image: \"postgres:13@sha256:ddd\" # Pinned by rewrite.\n  web:\n    build: web\n",
+		"web/Dockerfile":     "FROM node:12@sha256:eee\n",
+		"k8s/app.yaml":       "apiVersion: apps/v1\nkind: Pod\nmetadata:\n  name: app\nspec:\n  containers:\n  - name: app\n    image: localhost:5000/app@sha256:fff\n",
+	}
+	if len(rewrites) != len(expected) {
+		t.Fatalf("Got %d rewritten files. Expected %d.", len(rewrites), len(expected))
+	}
+	for fpath, contents := range expected {
+		if got := string(rewrites[fpath]); got != contents {
+			t.Fatalf("Got '%s' for '%s'. Expected '%s'.", got, fpath, contents)
+		}
+	}
+	for fpath, contents := range expected {
+		fsys[fpath] = &fstest.MapFile{Data: []byte(contents)}
+	}
+	rewrites, err = NewRewriterFS(fsys, lFile).Rewrites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewrites) != 0 {
+		t.Fatalf("Got %d rewritten files. Expected pinned files to be unchanged.", len(rewrites))
+	}
+}
+
+func TestRewritesConflictingDigests(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docker-compose.yml": {Data: []byte("services:\n  a:\n    build: .\n  b:\n    build: .\n")},
+		"Dockerfile":         {Data: []byte("FROM ubuntu:18.04\n")},
+	}
+	lFile := &generate.Lockfile{
+		ComposefileImages: map[string][]generate.ComposefileImage{
+			"docker-compose.yml": {
+				{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "aaa"}, ServiceName: "a", Dockerfile: "Dockerfile"},
+				{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "bbb"}, ServiceName: "b", Dockerfile: "Dockerfile"},
+			},
+		},
+	}
+	if _, err := NewRewriterFS(fsys, lFile).Rewrites(); err == nil {
+		t.Fatal("Image locked with different digests should fail.")
+	}
+}
+
+func TestRewritesStaleLockfile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile": {Data: []byte("FROM ubuntu:20.04\nFROM debian:buster\n")},
+	}
+	lFile := &generate.Lockfile{
+		DockerfileImages: map[string][]generate.DockerfileImage{
+			"Dockerfile": {
+				{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "aaa"}},
+				{Image: generate.Image{Name: "node", Tag: "12", Digest: "bbb"}},
+			},
+		},
+	}
+	if _, err := NewRewriterFS(fsys, lFile).Rewrites(); err == nil {
+		t.Fatal("Image locked under another name should fail.")
+	}
+}
+
+func TestImageName(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"node", "node"},
+		{"node:12", "node"},
+		{"node:12@sha256:abc", "node"},
+		{"localhost:5000/app", "localhost:5000/app"},
+		{"localhost:5000/app:1.0", "localhost:5000/app"},
+	}
+	for _, test := range tests {
+		if name := imageName(test.ref); name != test.expected {
+			t.Fatalf("Got '%s' for '%s'. Expected '%s'.", name, test.ref, test.expected)
+		}
+	}
+}
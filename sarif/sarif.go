@@ -0,0 +1,165 @@
+// Package sarif writes results in the Static Analysis Results Interchange
+// Format 2.1.0, which code scanning tools such as GitHub's upload.
+package sarif
+
+import (
+	"encoding/json"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type Log struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run's ColumnKind is the unit of Regions' columns. It is
+// 'utf16CodeUnits', which is also SARIF's default, or 'unicodeCodePoints'.
+type Run struct {
+	Tool       Tool     `json:"tool"`
+	Results    []Result `json:"results"`
+	ColumnKind string   `json:"columnKind,omitempty"`
+}
+
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+type Driver struct {
+	Name           string `json:"name"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Version        string `json:"version,omitempty"`
+	Rules          []Rule `json:"rules,omitempty"`
+}
+
+type Rule struct {
+	ID               string   `json:"id"`
+	ShortDescription *Message `json:"shortDescription,omitempty"`
+}
+
+// Result's Level is 'error', 'warning' or 'note'.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level,omitempty"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+}
+
+type Message struct {
+	Text string `json:"text"`
+}
+
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation's URIBaseID is '%SRCROOT%' if URI is relative to the
+// root of the repository.
+type ArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// Region's lines and columns start at 1. Columns count UTF-16 code units,
+// as set by the Run's ColumnKind.
+type Region struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// NewLog returns a log with a single run of docker-lock with rules.
+func NewLog(rules []Rule, results []Result) *Log {
+	if results == nil {
+		results = []Result{}
+	}
+	return &Log{Version: Version,
+		Schema: Schema,
+		Runs: []Run{{
+			Tool: Tool{Driver: Driver{Name: "docker-lock",
+				InformationURI: "https://github.com/michaelperel/docker-lock",
+				Rules:          rules,
+			}},
+			Results:    results,
+			ColumnKind: "utf16CodeUnits",
+		}},
+	}
+}
+
+// NewLocation locates path, relative to the working directory, at line and
+// column, which counts UTF-16 code units, such as generate.ImageLine's
+// UTF16Column. The region is omitted if line is 0. The location's uri is
+// path relative to the root of the git repository of the working
+// directory, so that code scanning finds the file from any directory, or
+// path itself if it is outside a repository.
+func NewLocation(path string, line int, column int) Location {
+	artifactLocation := ArtifactLocation{URI: filepath.ToSlash(path)}
+	if uri, ok := repoRelative(gitRoot(), path); ok {
+		artifactLocation = ArtifactLocation{URI: uri, URIBaseID: "%SRCROOT%"}
+	}
+	location := Location{PhysicalLocation: PhysicalLocation{ArtifactLocation: artifactLocation}}
+	if line > 0 {
+		location.PhysicalLocation.Region = &Region{StartLine: line, StartColumn: column}
+	}
+	return location
+}
+
+var (
+	gitRootOnce sync.Once
+	gitRootDir  string
+)
+
+// gitRoot returns the root of the git repository of the working directory,
+// or an empty string if there is none.
+func gitRoot() string {
+	gitRootOnce.Do(func() {
+		out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+		if err == nil {
+			gitRootDir = filepath.FromSlash(strings.TrimSpace(string(out)))
+		}
+	})
+	return gitRootDir
+}
+
+// repoRelative returns path, relative to the working directory, as a slash
+// separated path relative to root. It returns false if path is outside root.
+func repoRelative(root string, path string) (string, bool) {
+	if root == "" {
+		return "", false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	// git resolves symlinks in the root, such as macOS's /tmp.
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (l *Log) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	return encoder.Encode(l)
+}
@@ -0,0 +1,104 @@
+package sarif
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewLog(t *testing.T) {
+	rules := []Rule{{ID: "no-latest", ShortDescription: &Message{Text: "Images must not use 'latest'."}}}
+	log := NewLog(rules, nil)
+	if log.Version != Version || log.Schema != Schema || len(log.Runs) != 1 {
+		t.Fatalf("Got %+v. Expected a SARIF %s log with one run.", log, Version)
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "docker-lock" || !reflect.DeepEqual(run.Tool.Driver.Rules, rules) {
+		t.Fatalf("Got driver %+v. Expected docker-lock with rules %+v.", run.Tool.Driver, rules)
+	}
+	if run.Results == nil || len(run.Results) != 0 {
+		t.Fatalf("Got results %#v. Expected an empty list.", run.Results)
+	}
+	if run.ColumnKind != "utf16CodeUnits" {
+		t.Fatalf("Got column kind '%s'. Expected 'utf16CodeUnits'.", run.ColumnKind)
+	}
+}
+
+func TestNewLocation(t *testing.T) {
+	location := NewLocation("web/Dockerfile", 2, 6)
+	artifactLocation := ArtifactLocation{URI: "web/Dockerfile"}
+	if uri, ok := repoRelative(gitRoot(), "web/Dockerfile"); ok {
+		artifactLocation = ArtifactLocation{URI: uri, URIBaseID: "%SRCROOT%"}
+	}
+	expected := Location{PhysicalLocation: PhysicalLocation{ArtifactLocation: artifactLocation,
+		Region: &Region{StartLine: 2, StartColumn: 6},
+	}}
+	if !reflect.DeepEqual(location, expected) {
+		t.Fatalf("Got %+v. Expected %+v.", location, expected)
+	}
+	if location := NewLocation("docker-lock.json", 0, 0); location.PhysicalLocation.Region != nil {
+		t.Fatalf("Got region %+v. Expected none without a line.", location.PhysicalLocation.Region)
+	}
+}
+
+func TestRepoRelative(t *testing.T) {
+	root := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "app", "web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(root, "app")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tests := []struct {
+		path     string
+		expected string
+		ok       bool
+	}{
+		{filepath.Join("web", "Dockerfile"), "app/web/Dockerfile", true},
+		{filepath.Join("..", "Dockerfile"), "Dockerfile", true},
+		{filepath.Join("..", "..", "Dockerfile"), "", false},
+	}
+	for _, test := range tests {
+		if uri, ok := repoRelative(root, test.path); uri != test.expected || ok != test.ok {
+			t.Fatalf("Got '%s', %t for '%s'. Expected '%s', %t.", uri, ok, test.path, test.expected, test.ok)
+		}
+	}
+	if _, ok := repoRelative("", "Dockerfile"); ok {
+		t.Fatal("Path outside a repository should not be relative to its root.")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	log := NewLog(nil, []Result{{RuleID: "outdated-image",
+		Level:     "error",
+		Message:   Message{Text: "Image differs from the Lockfile."},
+		Locations: []Location{NewLocation("Dockerfile", 1, 6)},
+	}})
+	var buf bytes.Buffer
+	if err := log.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	run := decoded["runs"].([]interface{})[0].(map[string]interface{})
+	if run["columnKind"] != "utf16CodeUnits" {
+		t.Fatalf("Got column kind '%v'. Expected 'utf16CodeUnits'.", run["columnKind"])
+	}
+	region := run["results"].([]interface{})[0].(map[string]interface{})["locations"].([]interface{})[0].(map[string]interface{})["physicalLocation"].(map[string]interface{})["region"].(map[string]interface{})
+	if region["startLine"] != 1.0 || region["startColumn"] != 6.0 {
+		t.Fatalf("Got region %v. Expected line 1, column 6.", region)
+	}
+	if decoded["$schema"] != Schema || decoded["version"] != Version {
+		t.Fatalf("Got schema '%v' and version '%v'. Expected '%s' and '%s'.", decoded["$schema"], decoded["version"], Schema, Version)
+	}
+}
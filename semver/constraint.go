@@ -0,0 +1,222 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of ranges, such as '^12', '~3.7', '>=1.2 <2',
+// '1.x' or '^1 || ^2'. Comparators separated by spaces or commas must all
+// match, and '||' separates alternatives.
+//
+// Versions with a prerelease, which include tags with variants such as
+// '12.18.3-alpine', only match constraints that mention a prerelease.
+type Constraint struct {
+	alternatives [][]*bound
+	prerelease   bool
+	original     string
+}
+
+// bound is a range of versions between lower and upper, either of which
+// may be nil. If negate is set, the bound matches versions outside of the
+// range.
+type bound struct {
+	lower          *Version
+	lowerInclusive bool
+	upper          *Version
+	upperInclusive bool
+	negate         bool
+}
+
+var operators = []string{">=", "<=", "!=", ">", "<", "=", "~", "^"}
+
+func NewConstraint(s string) (*Constraint, error) {
+	c := &Constraint{original: s}
+	for _, alternative := range strings.Split(s, "||") {
+		var bounds []*bound
+		fields := strings.Fields(strings.Replace(alternative, ",", " ", -1))
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			// Join operators separated from their versions, as in '>= 1.2'.
+			if isOperator(field) && i+1 < len(fields) {
+				i++
+				field += fields[i]
+			}
+			// Hyphen ranges, such as '1.2 - 1.4', are '>=1.2 <=1.4'.
+			if i+2 < len(fields) && fields[i+1] == "-" {
+				lower, err := newBounds(">=" + field)
+				if err != nil {
+					return nil, fmt.Errorf("%s. From constraint: '%s'.", err, s)
+				}
+				upper, err := newBounds("<=" + fields[i+2])
+				if err != nil {
+					return nil, fmt.Errorf("%s. From constraint: '%s'.", err, s)
+				}
+				bounds = append(bounds, lower...)
+				bounds = append(bounds, upper...)
+				i += 2
+				continue
+			}
+			b, err := newBounds(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s. From constraint: '%s'.", err, s)
+			}
+			bounds = append(bounds, b...)
+		}
+		if len(bounds) == 0 {
+			return nil, fmt.Errorf("Empty range in constraint '%s'.", s)
+		}
+		for _, b := range bounds {
+			c.prerelease = c.prerelease ||
+				(b.lower != nil && b.lower.Prerelease != "") ||
+				(b.upper != nil && b.upper.Prerelease != "")
+		}
+		c.alternatives = append(c.alternatives, bounds)
+	}
+	return c, nil
+}
+
+func isOperator(s string) bool {
+	for _, op := range operators {
+		if s == op {
+			return true
+		}
+	}
+	return false
+}
+
+func newBounds(comparator string) ([]*bound, error) {
+	var op string
+	for _, o := range operators {
+		if strings.HasPrefix(comparator, o) {
+			op = o
+			break
+		}
+	}
+	v, err := parse(strings.TrimPrefix(comparator, op), true)
+	if err != nil {
+		return nil, err
+	}
+	// next is the first version after the versions that v's missing parts
+	// match, so that '12' is '>=12.0.0 <13.0.0'.
+	next := &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, parts: 3}
+	switch v.parts {
+	case 0:
+		next = nil
+	case 1:
+		next.Major, next.Minor, next.Patch = v.Major+1, 0, 0
+	case 2:
+		next.Minor, next.Patch = v.Minor+1, 0
+	case 3:
+		next.Patch++
+	}
+	lower := &Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch, Prerelease: v.Prerelease, parts: 3}
+	switch op {
+	case "", "=":
+		if v.parts == 3 {
+			return []*bound{{lower: lower, lowerInclusive: true, upper: lower, upperInclusive: true}}, nil
+		}
+		return []*bound{{lower: lower, lowerInclusive: true, upper: next}}, nil
+	case "!=":
+		if v.parts == 3 {
+			return []*bound{{lower: lower, lowerInclusive: true, upper: lower, upperInclusive: true, negate: true}}, nil
+		}
+		return []*bound{{lower: lower, lowerInclusive: true, upper: next, negate: true}}, nil
+	case ">":
+		if v.parts == 3 {
+			return []*bound{{lower: lower}}, nil
+		}
+		if next == nil {
+			return []*bound{{upper: &Version{parts: 3}}}, nil
+		}
+		return []*bound{{lower: next, lowerInclusive: true}}, nil
+	case ">=":
+		return []*bound{{lower: lower, lowerInclusive: true}}, nil
+	case "<":
+		return []*bound{{upper: lower}}, nil
+	case "<=":
+		if v.parts == 3 {
+			return []*bound{{upper: lower, upperInclusive: true}}, nil
+		}
+		if next == nil {
+			return []*bound{{}}, nil
+		}
+		return []*bound{{upper: next}}, nil
+	case "~":
+		upper := &Version{Major: v.Major, Minor: v.Minor + 1, parts: 3}
+		if v.parts < 2 {
+			upper = next
+		}
+		return []*bound{{lower: lower, lowerInclusive: true, upper: upper}}, nil
+	case "^":
+		upper := &Version{Major: v.Major + 1, parts: 3}
+		switch {
+		case v.parts == 0:
+			upper = nil
+		case v.Major != 0 || v.parts == 1:
+		case v.Minor != 0 || v.parts == 2:
+			upper = &Version{Minor: v.Minor + 1, parts: 3}
+		default:
+			upper = &Version{Patch: v.Patch + 1, parts: 3}
+		}
+		return []*bound{{lower: lower, lowerInclusive: true, upper: upper}}, nil
+	}
+	return nil, fmt.Errorf("Unsupported operator '%s'.", op)
+}
+
+func (b *bound) check(v *Version) bool {
+	in := true
+	if b.lower != nil {
+		c := v.compare(b.lower)
+		in = c > 0 || (c == 0 && b.lowerInclusive)
+	}
+	if in && b.upper != nil {
+		c := v.compare(b.upper)
+		in = c < 0 || (c == 0 && b.upperInclusive)
+	}
+	return in != b.negate
+}
+
+// Check reports whether v satisfies the constraint.
+func (c *Constraint) Check(v *Version) bool {
+	if v.Prerelease != "" && !c.prerelease {
+		return false
+	}
+	for _, bounds := range c.alternatives {
+		ok := true
+		for _, b := range bounds {
+			if !b.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Constraint) String() string {
+	return c.original
+}
+
+// Newest returns the newest tag that satisfies the constraint, ignoring
+// tags that are not versions, such as 'latest'. It returns false if no
+// tag satisfies the constraint.
+func (c *Constraint) Newest(tags []string) (string, bool) {
+	var newest *Version
+	for _, tag := range tags {
+		v, err := Parse(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if newest == nil || v.Compare(newest) > 0 {
+			newest = v
+		}
+	}
+	if newest == nil {
+		return "", false
+	}
+	return newest.String(), true
+}
@@ -0,0 +1,140 @@
+// Package semver parses semantic versions in image tags, such as '12.18.3'
+// or 'v1.2', and checks them against constraints, such as '^12'.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version. Tags with fewer than three parts, such as
+// '12' or '3.7', are versions whose missing parts are zero.
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease string
+	parts      int
+	original   string
+}
+
+// Parse parses a tag such as '12', '3.7.4', 'v1.2.3' or '1.0.0-rc.1'.
+// Build metadata, after a '+', is ignored.
+func Parse(s string) (*Version, error) {
+	v, err := parse(s, false)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func parse(s string, allowWildcards bool) (*Version, error) {
+	v := &Version{original: s}
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "=")
+	if i := strings.Index(rest, "+"); i != -1 {
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, "-"); i != -1 {
+		v.Prerelease = rest[i+1:]
+		rest = rest[:i]
+		if v.Prerelease == "" {
+			return nil, fmt.Errorf("Empty prerelease in version '%s'.", s)
+		}
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("Too many parts in version '%s'.", s)
+	}
+	numbers := []*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		if allowWildcards && (part == "x" || part == "X" || part == "*") {
+			break
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid version '%s'.", s)
+		}
+		*numbers[i] = n
+		v.parts++
+	}
+	if v.parts < len(parts) && v.Prerelease != "" {
+		return nil, fmt.Errorf("Prerelease with wildcards in version '%s'.", s)
+	}
+	return v, nil
+}
+
+func (v *Version) String() string {
+	return v.original
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to, or greater than o.
+// Versions that differ only in the number of parts, such as '3.7' and
+// '3.7.0', are ordered by the number of parts, so that the most specific
+// tag is the newest.
+func (v *Version) Compare(o *Version) int {
+	if c := v.compare(o); c != 0 {
+		return c
+	}
+	return compareInts(uint64(v.parts), uint64(o.parts))
+}
+
+func (v *Version) compare(o *Version) int {
+	if c := compareInts(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareInts(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+func compareInts(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease orders prereleases as semantic versioning does: a
+// version without a prerelease is greater, and dot separated identifiers
+// are compared numerically if they are numbers.
+func comparePrerelease(a string, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+	aIDs := strings.Split(a, ".")
+	bIDs := strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aNum, aErr := strconv.ParseUint(aIDs[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bIDs[i], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInts(aNum, bNum); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case aIDs[i] != bIDs[i]:
+			if aIDs[i] < bIDs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return compareInts(uint64(len(aIDs)), uint64(len(bIDs)))
+}
@@ -0,0 +1,142 @@
+package semver
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag        string
+		major      uint64
+		minor      uint64
+		patch      uint64
+		prerelease string
+	}{
+		{"12", 12, 0, 0, ""},
+		{"3.7", 3, 7, 0, ""},
+		{"3.7.4", 3, 7, 4, ""},
+		{"v1.2.3", 1, 2, 3, ""},
+		{"1.0.0-rc.1", 1, 0, 0, "rc.1"},
+		{"12.18.3-alpine3.12", 12, 18, 3, "alpine3.12"},
+		{"1.2.3+build.5", 1, 2, 3, ""},
+	}
+	for _, test := range tests {
+		v, err := Parse(test.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Major != test.major || v.Minor != test.minor || v.Patch != test.patch || v.Prerelease != test.prerelease {
+			t.Fatalf("Got '%+v' for '%s'.", v, test.tag)
+		}
+		if v.String() != test.tag {
+			t.Fatalf("Got '%s'. Expected '%s'.", v.String(), test.tag)
+		}
+	}
+	for _, tag := range []string{"latest", "", "1.2.3.4", "1.x", "alpine", "1.2-", "1..2"} {
+		if _, err := Parse(tag); err == nil {
+			t.Fatalf("Tag '%s' should fail.", tag)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1", "1.0", "1.0.0", "1.0.1", "1.2", "1.10", "2"}
+	for i := 0; i < len(ordered)-1; i++ {
+		a, err := Parse(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(ordered[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+			t.Fatalf("Expected '%s' < '%s'.", a, b)
+		}
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		misses     []string
+	}{
+		{"^12", []string{"12", "12.0.0", "12.18.3"}, []string{"11.9.9", "13", "12.18.3-alpine"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~3.7", []string{"3.7", "3.7.9"}, []string{"3.8", "3.6.9"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9"}, []string{"2"}},
+		{">=1.2 <2", []string{"1.2.0", "1.99"}, []string{"1.1.9", "2.0.0"}},
+		{">= 1.2, < 2", []string{"1.2.0"}, []string{"2.0.0"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{">1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{"1.x", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"1.2.*", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+		{"*", []string{"0.0.1", "100"}, []string{"1.0.0-rc.1"}},
+		{"=1.2.3", []string{"1.2.3"}, []string{"1.2.4"}},
+		{"^1 || ^3", []string{"1.5", "3.0"}, []string{"2.0"}},
+		{"1.2 - 1.4", []string{"1.2.0", "1.4.9"}, []string{"1.5.0", "1.1.9"}},
+		{"^1 !=1.5.0", []string{"1.4.0", "1.5.1"}, []string{"1.5.0"}},
+		{">=1.0.0-rc.1", []string{"1.0.0-rc.2", "1.0.0"}, []string{"1.0.0-beta"}},
+	}
+	for _, test := range tests {
+		c, err := NewConstraint(test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range test.matches {
+			v, err := Parse(tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.Check(v) {
+				t.Fatalf("Expected '%s' to match '%s'.", tag, c)
+			}
+		}
+		for _, tag := range test.misses {
+			v, err := Parse(tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Check(v) {
+				t.Fatalf("Expected '%s' not to match '%s'.", tag, c)
+			}
+		}
+	}
+}
+
+func TestFaultyConstraint(t *testing.T) {
+	for _, constraint := range []string{"", "^", ">=a", "1.2.3.4", "^1 ||", "1.x-rc"} {
+		if _, err := NewConstraint(constraint); err == nil {
+			t.Fatalf("Constraint '%s' should fail.", constraint)
+		}
+	}
+}
+
+func TestNewest(t *testing.T) {
+	tags := []string{"latest", "12", "12.18", "12.18.3", "12.18.4-alpine", "12.9.1", "13.0.0", "alpine", "14"}
+	tests := []struct {
+		constraint string
+		newest     string
+		ok         bool
+	}{
+		{"^12", "12.18.3", true},
+		{"~12.9", "12.9.1", true},
+		{">=13", "14", true},
+		{"^15", "", false},
+	}
+	for _, test := range tests {
+		c, err := NewConstraint(test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newest, ok := c.Newest(tags)
+		if newest != test.newest || ok != test.ok {
+			t.Fatalf("Got '%s' for '%s'. Expected '%s'.", newest, test.constraint, test.newest)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package sign
+
+import (
+	"flag"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+type Flags struct {
+	Outfile        string
+	LockfileFormat string
+	KeyFile        string
+	PublicKeyFile  string
+	// GenerateKey writes a new key pair to KeyFile and PublicKeyFile
+	// instead of signing the Lockfile.
+	GenerateKey bool
+}
+
+func NewFlags(cmdLineArgs []string) (*Flags, error) {
+	var outfile string
+	var lockfileFormat string
+	var keyFile string
+	var publicKeyFile string
+	var generateKey bool
+	command := flag.NewFlagSet("sign", flag.ExitOnError)
+	command.StringVar(&outfile, "o", "docker-lock.json", "Path to Lockfile from current directory.")
+	command.StringVar(&lockfileFormat, "lockfile-format", "", "Format of the Lockfile, 'json', 'yaml' or 'toml'. Defaults to the format of the Lockfile's extension, or 'json'.")
+	command.StringVar(&keyFile, "key", "docker-lock.key", "Path to ed25519 private key.")
+	command.StringVar(&publicKeyFile, "pub", "docker-lock.pub", "Path to ed25519 public key, written with -generate-key.")
+	command.BoolVar(&generateKey, "generate-key", false, "Generate a key pair instead of signing the Lockfile.")
+	command.Parse(cmdLineArgs)
+	if _, err := generate.GetLockfileFormat(lockfileFormat, outfile); err != nil {
+		return nil, err
+	}
+	return &Flags{Outfile: outfile,
+		LockfileFormat: lockfileFormat,
+		KeyFile:        keyFile,
+		PublicKeyFile:  publicKeyFile,
+		GenerateKey:    generateKey,
+	}, nil
+}
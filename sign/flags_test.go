@@ -0,0 +1,30 @@
+package sign
+
+import (
+	"testing"
+)
+
+func TestDefaults(t *testing.T) {
+	f, err := NewFlags([]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Outfile != "docker-lock.json" {
+		t.Fatalf("Got '%s' outfile. Expected 'docker-lock.json'.", f.Outfile)
+	}
+	if f.KeyFile != "docker-lock.key" {
+		t.Fatalf("Got '%s' key file. Expected 'docker-lock.key'.", f.KeyFile)
+	}
+	if f.PublicKeyFile != "docker-lock.pub" {
+		t.Fatalf("Got '%s' public key file. Expected 'docker-lock.pub'.", f.PublicKeyFile)
+	}
+	if f.GenerateKey {
+		t.Fatal("Got generate key. Expected sign.")
+	}
+}
+
+func TestFaultyLockfileFormat(t *testing.T) {
+	if _, err := NewFlags([]string{"-lockfile-format", "xml"}); err == nil {
+		t.Fatal("Unknown Lockfile format should fail.")
+	}
+}
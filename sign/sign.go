@@ -0,0 +1,177 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+// Signer writes a detached signature of a Lockfile's integrity hash.
+type Signer struct {
+	*generate.Lockfile
+	outfile        string
+	lockfileFormat string
+	keyFile        string
+}
+
+func NewSigner(flags *Flags) (*Signer, error) {
+	// Reading the Lockfile fails if it was edited since it was generated,
+	// so that a tampered Lockfile is never signed.
+	lFile, err := generate.ReadLockfile(flags.Outfile, flags.LockfileFormat)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{Lockfile: lFile,
+		outfile:        flags.Outfile,
+		lockfileFormat: flags.LockfileFormat,
+		keyFile:        flags.KeyFile,
+	}, nil
+}
+
+// SignatureFile returns the path of the signature of the Lockfile at
+// lockfilePath.
+func SignatureFile(lockfilePath string) string {
+	return lockfilePath + ".sig"
+}
+
+// Sign writes the signature of the Lockfile to its SignatureFile. A
+// Lockfile without an integrity hash, written by an older version, is
+// rewritten with one first.
+func (s *Signer) Sign() error {
+	key, err := readPrivateKey(s.keyFile)
+	if err != nil {
+		return err
+	}
+	hash, err := s.Hash()
+	if err != nil {
+		return err
+	}
+	if s.Integrity == "" {
+		s.Integrity = hash
+		format, err := generate.GetLockfileFormat(s.lockfileFormat, s.outfile)
+		if err != nil {
+			return err
+		}
+		lByt, err := format.Encode(s.Lockfile)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(s.outfile, lByt, 0644); err != nil {
+			return err
+		}
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(hash)))
+	return ioutil.WriteFile(SignatureFile(s.outfile), []byte(signature+"\n"), 0644)
+}
+
+// VerifySignature fails unless sigFile holds a signature of the Lockfile's
+// hash by the key in publicKeyFile.
+func VerifySignature(lFile *generate.Lockfile, sigFile string, publicKeyFile string) error {
+	sigByt, err := ioutil.ReadFile(sigFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Lockfile is not signed. Signature file '%s' does not exist.", sigFile)
+	} else if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigByt)))
+	if err != nil {
+		return fmt.Errorf("%s. From signature file: '%s'.", err, sigFile)
+	}
+	key, err := readPublicKey(publicKeyFile)
+	if err != nil {
+		return err
+	}
+	if err := lFile.CheckIntegrity(); err != nil {
+		return err
+	}
+	hash, err := lFile.Hash()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, []byte(hash), signature) {
+		return fmt.Errorf("Invalid signature of Lockfile with hash '%s'. From signature file: '%s'.", hash, sigFile)
+	}
+	return nil
+}
+
+// GenerateKey writes a new ed25519 private key to keyFile, readable only by
+// its owner, and its public key to publicKeyFile. Existing keys are not
+// overwritten.
+func GenerateKey(keyFile string, publicKeyFile string) error {
+	for _, fpath := range []string{keyFile, publicKeyFile} {
+		if _, err := os.Stat(fpath); err == nil {
+			return fmt.Errorf("Key file '%s' already exists.", fpath)
+		}
+	}
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privateByt, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	publicByt, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateByt})
+	if err := ioutil.WriteFile(keyFile, privatePEM, 0600); err != nil {
+		return err
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicByt})
+	return ioutil.WriteFile(publicKeyFile, publicPEM, 0644)
+}
+
+func readPrivateKey(keyFile string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(keyFile, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s. From key file: '%s'.", err, keyFile)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Expected an ed25519 key. From key file: '%s'.", keyFile)
+	}
+	return privateKey, nil
+}
+
+func readPublicKey(publicKeyFile string) (ed25519.PublicKey, error) {
+	block, err := readPEM(publicKeyFile, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s. From key file: '%s'.", err, publicKeyFile)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Expected an ed25519 key. From key file: '%s'.", publicKeyFile)
+	}
+	return publicKey, nil
+}
+
+func readPEM(fpath string, blockType string) (*pem.Block, error) {
+	byt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(byt)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("Expected a PEM encoded '%s'. From key file: '%s'.", blockType, fpath)
+	}
+	return block, nil
+}
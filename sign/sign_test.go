@@ -0,0 +1,97 @@
+package sign
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/michaelperel/docker-lock/generate"
+)
+
+// writeLockfile writes a Lockfile without an integrity hash, as older
+// versions did, to dir.
+func writeLockfile(t *testing.T, dir string) string {
+	lFile := &generate.Lockfile{
+		DockerfileImages: map[string][]generate.DockerfileImage{
+			"Dockerfile": {{Image: generate.Image{Name: "ubuntu", Tag: "18.04", Digest: "abc"}}},
+		},
+		ComposefileImages: map[string][]generate.ComposefileImage{},
+	}
+	lByt, err := lFile.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpath := filepath.Join(dir, "docker-lock.json")
+	if err := ioutil.WriteFile(fpath, lByt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fpath
+}
+
+func TestSign(t *testing.T) {
+	dir := t.TempDir()
+	lPath := writeLockfile(t, dir)
+	flags := &Flags{Outfile: lPath,
+		KeyFile:       filepath.Join(dir, "docker-lock.key"),
+		PublicKeyFile: filepath.Join(dir, "docker-lock.pub"),
+	}
+	if err := GenerateKey(flags.KeyFile, flags.PublicKeyFile); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(flags.KeyFile); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Fatalf("Got %o key file permissions. Expected 600.", info.Mode().Perm())
+	}
+	if err := GenerateKey(flags.KeyFile, flags.PublicKeyFile); err == nil {
+		t.Fatal("Existing key should not be overwritten.")
+	}
+	signer, err := NewSigner(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := generate.ReadLockfile(lPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(lFile.Integrity, "sha256:") {
+		t.Fatalf("Got '%s' integrity. Expected a sha256 hash.", lFile.Integrity)
+	}
+	if err := VerifySignature(lFile, SignatureFile(lPath), flags.PublicKeyFile); err != nil {
+		t.Fatal(err)
+	}
+	lFile.DockerfileImages["Dockerfile"][0].Digest = "tampered"
+	if err := VerifySignature(lFile, SignatureFile(lPath), flags.PublicKeyFile); err == nil {
+		t.Fatal("Tampered Lockfile should fail verification.")
+	}
+	lFile.DockerfileImages["Dockerfile"][0].Digest = "abc"
+	otherKey := filepath.Join(dir, "other.key")
+	otherPub := filepath.Join(dir, "other.pub")
+	if err := GenerateKey(otherKey, otherPub); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySignature(lFile, SignatureFile(lPath), otherPub); err == nil {
+		t.Fatal("Signature by another key should fail verification.")
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	dir := t.TempDir()
+	lPath := writeLockfile(t, dir)
+	pub := filepath.Join(dir, "docker-lock.pub")
+	if err := GenerateKey(filepath.Join(dir, "docker-lock.key"), pub); err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := generate.ReadLockfile(lPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySignature(lFile, SignatureFile(lPath), pub); err == nil {
+		t.Fatal("Unsigned Lockfile should fail verification.")
+	}
+}
@@ -2,26 +2,80 @@ package verify
 
 import (
 	"flag"
+	"fmt"
 	"github.com/joho/godotenv"
+	"github.com/michaelperel/docker-lock/audit"
+	"github.com/michaelperel/docker-lock/generate"
 	"os"
 	"path/filepath"
 )
 
+type Options struct {
+	GitTracked   bool
+	ChangedSince string
+	// Env holds the variables substituted in Dockerfiles and docker-compose
+	// files. If nil, the process environment is used.
+	Env map[string]string
+	// SignatureKeys maps image names, or patterns such as 'ghcr.io/myorg/*',
+	// to public key files. Locked digests of those images must have a cosign
+	// signature made with the key.
+	SignatureKeys map[string]string
+	// Auditor, if set, fails verification of locked images that its
+	// advisories affect.
+	Auditor *audit.Auditor
+}
+
 type Flags struct {
-	Outfile    string
-	ConfigFile string
-	EnvFile    string
+	Options
+	Outfile            string
+	ConfigFile         string
+	EnvFile            string
+	RegistryConfigFile string
+	SignatureKeysFile  string
+	// LockfileFormat is the name of the Lockfile's format, such as 'yaml'.
+	// If empty, the format is chosen by Outfile's extension.
+	LockfileFormat string
+	// RequireSignature fails verification unless the Lockfile is signed by
+	// the key in PublicKeyFile.
+	RequireSignature bool
+	PublicKeyFile    string
+	// Format is 'text', which fails with the differences, 'json' or
+	// 'sarif'.
+	Format string
 }
 
 func NewFlags(cmdLineArgs []string) (*Flags, error) {
 	var outfile string
 	var configFile string
 	var envFile string
+	var registryConfigFile string
+	var gitTracked bool
+	var changedSince string
+	var lockfileFormat string
+	var requireSignature bool
+	var publicKeyFile string
+	var signatureKeysFile string
+	var format string
 	command := flag.NewFlagSet("verify", flag.ExitOnError)
 	command.StringVar(&outfile, "o", "docker-lock.json", "Path to save Lockfile from current directory.")
+	command.StringVar(&lockfileFormat, "lockfile-format", "", "Format of the Lockfile, 'json', 'yaml' or 'toml'. Defaults to the format of the Lockfile's extension, or 'json'.")
 	command.StringVar(&configFile, "c", "", "Path to config file for auth credentials.")
 	command.StringVar(&envFile, "e", ".env", "Path to .env file.")
+	command.BoolVar(&gitTracked, "git-tracked", false, "Only verify files tracked by git.")
+	command.StringVar(&changedSince, "changed-since", "", "Only verify files changed since the merge base of the git ref and HEAD.")
+	command.StringVar(&registryConfigFile, "registry-config", "", "Path to config file declaring registries. Defaults to .docker-lock-registries.json, if it exists.")
+	command.BoolVar(&requireSignature, "require-signature", false, "Fail unless the Lockfile is signed by the key in -pub.")
+	command.StringVar(&publicKeyFile, "pub", "docker-lock.pub", "Path to ed25519 public key that signed the Lockfile.")
+	command.StringVar(&signatureKeysFile, "signature-keys", "", "Path to JSON file of cosign public keys by image name. Defaults to .docker-lock-signature-keys.json, if it exists.")
+	command.StringVar(&format, "format", "text", "Output format, 'text', 'json' or 'sarif'.")
+	auditOptions := audit.AddFlags(command)
 	command.Parse(cmdLineArgs)
+	if format != "text" && format != "json" && format != "sarif" {
+		return nil, fmt.Errorf("Unsupported format '%s'. Expected 'text', 'json' or 'sarif'.", format)
+	}
+	if _, err := generate.GetLockfileFormat(lockfileFormat, outfile); err != nil {
+		return nil, err
+	}
 	if _, err := os.Stat(envFile); err != nil {
 		if envFile != ".env" {
 			return nil, err
@@ -39,5 +93,44 @@ func NewFlags(cmdLineArgs []string) (*Flags, error) {
 			configFile = defaultConfig
 		}
 	}
-	return &Flags{Outfile: outfile, ConfigFile: configFile, EnvFile: envFile}, nil
+	if registryConfigFile != "" {
+		if _, err := os.Stat(registryConfigFile); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(".docker-lock-registries.json"); err == nil {
+		registryConfigFile = ".docker-lock-registries.json"
+	}
+	if signatureKeysFile == "" {
+		if _, err := os.Stat(".docker-lock-signature-keys.json"); err == nil {
+			signatureKeysFile = ".docker-lock-signature-keys.json"
+		}
+	}
+	var signatureKeys map[string]string
+	if signatureKeysFile != "" {
+		var err error
+		if signatureKeys, err = LoadSignatureKeys(signatureKeysFile); err != nil {
+			return nil, err
+		}
+	}
+	auditOpts, err := auditOptions(outfile)
+	if err != nil {
+		return nil, err
+	}
+	var auditor *audit.Auditor
+	if auditOpts.AdvisoriesPath != "" {
+		if auditor, err = audit.NewAuditor(*auditOpts); err != nil {
+			return nil, err
+		}
+	}
+	return &Flags{Options: Options{GitTracked: gitTracked, ChangedSince: changedSince, SignatureKeys: signatureKeys, Auditor: auditor},
+		Outfile:            outfile,
+		ConfigFile:         configFile,
+		EnvFile:            envFile,
+		RegistryConfigFile: registryConfigFile,
+		SignatureKeysFile:  signatureKeysFile,
+		LockfileFormat:     lockfileFormat,
+		RequireSignature:   requireSignature,
+		PublicKeyFile:      publicKeyFile,
+		Format:             format,
+	}, nil
 }
@@ -15,6 +15,9 @@ func TestDefaults(t *testing.T) {
 	if f.Outfile != "docker-lock.json" {
 		t.Fatalf("Got '%s' outfile. Expected 'docker-lock.json'.", f.Outfile)
 	}
+	if f.RegistryConfigFile != "" {
+		t.Fatalf("Got '%s' registry config file. Expected ''.", f.RegistryConfigFile)
+	}
 	if f.EnvFile != ".env" {
 		t.Fatalf("Got '%s' env file. Expected .env.", f.EnvFile)
 	}
@@ -26,6 +29,9 @@ func TestDefaults(t *testing.T) {
 	if f.ConfigFile != defaultConfig {
 		t.Fatalf("Got '%s' config file. Expected '%s'.", f.ConfigFile, defaultConfig)
 	}
+	if f.Format != "text" {
+		t.Fatalf("Got '%s' format. Expected 'text'.", f.Format)
+	}
 }
 
 func TestOutFile(t *testing.T) {
@@ -72,3 +78,41 @@ func TestFaultyEnvFile(t *testing.T) {
 		t.Fatal("Faulty env file should fail.")
 	}
 }
+
+func TestSignatureKeysFile(t *testing.T) {
+	signatureKeysFile := filepath.Join("testdata", "flags", "signature-keys.json")
+	f, err := NewFlags([]string{"-signature-keys", signatureKeysFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.SignatureKeys["ghcr.io/myorg/*"] != "cosign.pub" {
+		t.Fatalf("Got '%v'. Expected 'cosign.pub' for 'ghcr.io/myorg/*'.", f.SignatureKeys)
+	}
+}
+
+func TestFaultySignatureKeysFile(t *testing.T) {
+	signatureKeysFile := filepath.Join("testdata", "flags", "faulty-signature-keys.json")
+	if _, err := NewFlags([]string{"-signature-keys", signatureKeysFile}); err == nil {
+		t.Fatal("Faulty pattern should fail.")
+	}
+}
+
+func TestFaultyFormat(t *testing.T) {
+	if _, err := NewFlags([]string{"-format", "xml"}); err == nil {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
+
+func TestAdvisoriesFile(t *testing.T) {
+	advisoriesFile := filepath.Join("testdata", "flags", "advisories.json")
+	f, err := NewFlags([]string{"-advisories", advisoriesFile, "-fail-on", "critical"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Auditor == nil || len(f.Auditor.Advisories) != 1 || f.Auditor.FailOn != "critical" {
+		t.Fatalf("Got %+v. Expected an auditor of 1 advisory, failing on 'critical'.", f.Auditor)
+	}
+	if f, err := NewFlags([]string{}); err != nil || f.Auditor != nil {
+		t.Fatalf("Got %+v, %v. Expected no auditor without advisories.", f, err)
+	}
+}
@@ -0,0 +1,235 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/registry"
+)
+
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// SignatureResult records whether a locked digest has a cosign signature
+// made with the key configured for its image.
+type SignatureResult struct {
+	Name     string `json:"name"`
+	Digest   string `json:"digest"`
+	KeyFile  string `json:"keyFile"`
+	Verified bool   `json:"verified"`
+	Message  string `json:"message"`
+}
+
+type signatureKey struct {
+	file string
+	key  crypto.PublicKey
+}
+
+type cosignManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// LoadSignatureKeys reads a JSON file that maps image names, or patterns
+// such as 'ghcr.io/myorg/*', to PEM encoded public keys, such as the
+// 'cosign.pub' written by 'cosign generate-key-pair'.
+func LoadSignatureKeys(fpath string) (map[string]string, error) {
+	keysByt, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	var keyFiles map[string]string
+	if err := json.Unmarshal(keysByt, &keyFiles); err != nil {
+		return nil, fmt.Errorf("%s. From signature keys file: '%s'.", err, fpath)
+	}
+	for pattern := range keyFiles {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s. From pattern: '%s'. From signature keys file: '%s'.", err, pattern, fpath)
+		}
+	}
+	return keyFiles, nil
+}
+
+func loadPublicKeys(keyFiles map[string]string) (map[string]*signatureKey, error) {
+	keys := make(map[string]*signatureKey, len(keyFiles))
+	for pattern, keyFile := range keyFiles {
+		keyByt, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		block, _ := pem.Decode(keyByt)
+		if block == nil || block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("Expected a PEM encoded 'PUBLIC KEY'. From key file: '%s'.", keyFile)
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s. From key file: '%s'.", err, keyFile)
+		}
+		keys[pattern] = &signatureKey{file: keyFile, key: key}
+	}
+	return keys, nil
+}
+
+// signatureKeyFor returns the key of name, or of the most specific pattern
+// that matches name.
+func (v *Verifier) signatureKeyFor(name string) *signatureKey {
+	if key, ok := v.signatureKeys[name]; ok {
+		return key
+	}
+	var best string
+	for pattern := range v.signatureKeys {
+		if ok, _ := path.Match(pattern, name); ok && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	return v.signatureKeys[best]
+}
+
+// verifySignatures checks the signatures of every locked image that has a
+// key.
+func (v *Verifier) verifySignatures(wrapperManager *registry.WrapperManager) []SignatureResult {
+	var images []generate.Image
+	for _, imgs := range v.DockerfileImages {
+		for _, image := range imgs {
+			images = append(images, image.Image)
+		}
+	}
+	for _, imgs := range v.ComposefileImages {
+		for _, image := range imgs {
+			images = append(images, image.Image)
+		}
+	}
+	for _, imgs := range v.KubernetesfileImages {
+		for _, image := range imgs {
+			images = append(images, image.Image)
+		}
+	}
+	for _, imgs := range v.CIfileImages {
+		for _, image := range imgs {
+			images = append(images, image.Image)
+		}
+	}
+	for _, imgs := range v.BakefileImages {
+		for _, image := range imgs {
+			images = append(images, image.Image)
+		}
+	}
+	var (
+		results []SignatureResult
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	seen := make(map[string]bool)
+	for _, image := range images {
+		key := v.signatureKeyFor(image.Name)
+		if key == nil || image.Digest == "" || seen[image.Name+"@"+image.Digest] {
+			continue
+		}
+		seen[image.Name+"@"+image.Digest] = true
+		wg.Add(1)
+		go func(image generate.Image) {
+			defer wg.Done()
+			result := SignatureResult{Name: image.Name, Digest: image.Digest, KeyFile: key.file}
+			wrapper, ok := wrapperManager.GetWrapper(image.Name).(registry.ArtifactWrapper)
+			if !ok {
+				result.Message = fmt.Sprintf("Registry of '%s' does not support fetching signatures.", image.Name)
+			} else if err := verifyCosignSignature(wrapper, image.Name, image.Digest, key.key); err != nil {
+				result.Message = fmt.Sprintf("Signature of '%s@sha256:%s' could not be verified with key '%s'. %s", image.Name, image.Digest, key.file, err)
+			} else {
+				result.Verified = true
+				result.Message = fmt.Sprintf("Signature of '%s@sha256:%s' verified with key '%s'.", image.Name, image.Digest, key.file)
+			}
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+		}(image)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Digest < results[j].Digest
+	})
+	return results
+}
+
+// verifyCosignSignature checks that the signature manifest cosign tags
+// 'sha256-<hex>.sig' has a layer signed by key whose payload names digest.
+func verifyCosignSignature(wrapper registry.ArtifactWrapper, name string, digest string, key crypto.PublicKey) error {
+	manifestByt, err := wrapper.GetManifest(name, "sha256-"+digest+".sig")
+	if err != nil {
+		return err
+	}
+	var manifest cosignManifest
+	if err := json.Unmarshal(manifestByt, &manifest); err != nil {
+		return err
+	}
+	if len(manifest.Layers) == 0 {
+		return errors.New("No signatures found.")
+	}
+	err = errors.New("No signature was made with the key.")
+	for _, layer := range manifest.Layers {
+		signature, decodeErr := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+		if decodeErr != nil || len(signature) == 0 {
+			continue
+		}
+		payloadByt, blobErr := wrapper.GetBlob(name, layer.Digest)
+		if blobErr != nil {
+			err = blobErr
+			continue
+		}
+		if !verifySignature(key, payloadByt, signature) {
+			continue
+		}
+		var payload cosignPayload
+		if jsonErr := json.Unmarshal(payloadByt, &payload); jsonErr != nil {
+			err = jsonErr
+			continue
+		}
+		if signed := payload.Critical.Image.DockerManifestDigest; signed != "sha256:"+digest {
+			err = fmt.Errorf("Signature is for digest '%s'.", signed)
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+// verifySignature supports the ECDSA keys cosign generates by default, and
+// ed25519 and RSA keys.
+func verifySignature(key crypto.PublicKey, payload []byte, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package verify
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/registry"
+)
+
+// signatureRegistry stands in for a registry that serves images and the
+// signatures cosign pushes next to them.
+type signatureRegistry struct {
+	*httptest.Server
+	// artifacts are served by path, such as 'team/app/manifests/1.0'.
+	artifacts map[string][]byte
+	digests   map[string]string
+}
+
+func newSignatureRegistry(t *testing.T) *signatureRegistry {
+	r := &signatureRegistry{artifacts: make(map[string][]byte), digests: make(map[string]string)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, "/v2/")
+		if digest, ok := r.digests[path]; ok {
+			w.Header().Set("Docker-Content-Digest", "sha256:"+digest)
+		}
+		artifact, ok := r.artifacts[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(artifact)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *signatureRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// push adds repo:tag and returns its digest.
+func (r *signatureRegistry) push(repo string, tag string) string {
+	manifest := []byte(`{"schemaVersion":2,"repo":"` + repo + `","tag":"` + tag + `"}`)
+	sum := sha256.Sum256(manifest)
+	digest := hex.EncodeToString(sum[:])
+	r.artifacts[repo+"/manifests/"+tag] = manifest
+	r.digests[repo+"/manifests/"+tag] = digest
+	return digest
+}
+
+// sign pushes a cosign signature of signedDigest by key to the signature
+// tag of digest.
+func (r *signatureRegistry) sign(t *testing.T, repo string, digest string, signedDigest string, key *ecdsa.PrivateKey) {
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"` + r.host() + "/" + repo + `"},"image":{"docker-manifest-digest":"sha256:` + signedDigest + `"},"type":"cosign container image signature"},"optional":null}`)
+	payloadSum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, payloadSum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadDigest := "sha256:" + hex.EncodeToString(payloadSum[:])
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"layers": []map[string]interface{}{{
+			"mediaType":   "application/vnd.dev.cosign.simplesigning.v1+json",
+			"digest":      payloadDigest,
+			"annotations": map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.artifacts[repo+"/blobs/"+payloadDigest] = payload
+	r.artifacts[repo+"/manifests/sha256-"+digest+".sig"] = manifest
+}
+
+func writePublicKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	byt, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpath := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := ioutil.WriteFile(fpath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: byt}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fpath
+}
+
+func TestVerifySignatures(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newSignatureRegistry(t)
+	signedDigest := r.push("team/signed", "1.0")
+	r.sign(t, "team/signed", signedDigest, signedDigest, key)
+	unsignedDigest := r.push("team/unsigned", "1.0")
+	forgedDigest := r.push("team/forged", "1.0")
+	r.sign(t, "team/forged", forgedDigest, forgedDigest, otherKey)
+	replayedDigest := r.push("team/replayed", "1.0")
+	r.sign(t, "team/replayed", replayedDigest, signedDigest, key)
+	otherDigest := r.push("other/app", "1.0")
+
+	wrapper, err := registry.NewV2Wrapper(registry.RegistryConfig{Host: r.host(), PlainHTTP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	wm.Add(wrapper)
+	var dockerfile string
+	for _, repo := range []string{"team/signed", "team/unsigned", "team/forged", "team/replayed", "other/app"} {
+		dockerfile += "FROM " + r.host() + "/" + repo + ":1.0\n"
+	}
+	fsys := fstest.MapFS{"Dockerfile": {Data: []byte(dockerfile)}}
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writePublicKey(t, key)
+	opts := Options{SignatureKeys: map[string]string{r.host() + "/team/*": keyFile}}
+	v, err := NewVerifierFS(fsys, lFile, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 0 {
+		t.Fatalf("Got %+v. Expected no differences.", report.Differences)
+	}
+	verified := map[string]bool{
+		signedDigest:   true,
+		unsignedDigest: false,
+		forgedDigest:   false,
+		replayedDigest: false,
+	}
+	if len(report.Signatures) != len(verified) {
+		t.Fatalf("Got %+v. Expected %d signature results.", report.Signatures, len(verified))
+	}
+	for _, result := range report.Signatures {
+		if result.Digest == otherDigest {
+			t.Fatalf("Got %+v. Expected images without a key to be skipped.", result)
+		}
+		if result.Verified != verified[result.Digest] || result.KeyFile != keyFile {
+			t.Fatalf("Got %+v. Expected verified to be %t.", result, verified[result.Digest])
+		}
+	}
+	if err := v.VerifyLockfile(wm); err == nil {
+		t.Fatal("Unsigned images should fail verification.")
+	}
+	opts.SignatureKeys = map[string]string{r.host() + "/team/signed": keyFile}
+	if v, err = NewVerifierFS(fsys, lFile, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyLockfile(wm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFaultySignatureKeys(t *testing.T) {
+	fsys := fstest.MapFS{"Dockerfile": {Data: []byte("FROM busybox\n")}}
+	keyFile := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := ioutil.WriteFile(keyFile, []byte("not a key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{SignatureKeys: map[string]string{"busybox": keyFile}}
+	if _, err := NewVerifierFS(fsys, &generate.Lockfile{}, opts); err == nil {
+		t.Fatal("Faulty key file should fail.")
+	}
+}
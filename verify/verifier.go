@@ -2,28 +2,95 @@ package verify
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/michaelperel/docker-lock/audit"
 	"github.com/michaelperel/docker-lock/generate"
 	"github.com/michaelperel/docker-lock/registry"
+	"github.com/michaelperel/docker-lock/sarif"
+	"github.com/michaelperel/docker-lock/semver"
+	"github.com/michaelperel/docker-lock/sign"
 )
 
 type Verifier struct {
 	*generate.Generator
 	*generate.Lockfile
-	outfile string
+	outfile       string
+	signatureKeys map[string]*signatureKey
+	auditor       *audit.Auditor
+}
+
+// Difference describes an image that does not match the Lockfile.
+// Expected and Found hold a generate.DockerfileImage,
+// generate.ComposefileImage, generate.KubernetesfileImage,
+// generate.CIfileImage or generate.BakefileImage, depending on Section, and
+// are nil if the image is missing. Position is -1 if the number of images in File differs.
+type Difference struct {
+	Section  string      `json:"section"`
+	File     string      `json:"file"`
+	Position int         `json:"position"`
+	Expected interface{} `json:"expected,omitempty"`
+	Found    interface{} `json:"found,omitempty"`
+	Message  string      `json:"message"`
+	Source   Source      `json:"source"`
+}
+
+// Source is where an image is written, such as the FROM instruction in a
+// Dockerfile that a docker-compose file builds. Line and Column are 0 if
+// the image could not be located, in which case File is the file that the
+// image is locked for.
+type Source struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// utf16Column is Column counted in UTF-16 code units, as in SARIF.
+	utf16Column int
+}
+
+type Report struct {
+	Differences []Difference      `json:"differences"`
+	Signatures  []SignatureResult `json:"signatures,omitempty"`
+	// Vulnerabilities are locked images that advisories affect, if
+	// Options.Auditor is set.
+	Vulnerabilities []audit.Finding `json:"vulnerabilities,omitempty"`
+	audit           *audit.Report
+	lockfile        string
 }
 
 func NewVerifier(flags *Flags) (*Verifier, error) {
-	lByt, err := ioutil.ReadFile(flags.Outfile)
+	lFile, err := generate.ReadLockfile(flags.Outfile, flags.LockfileFormat)
 	if err != nil {
 		return nil, err
 	}
-	var lFile generate.Lockfile
-	if err := json.Unmarshal(lByt, &lFile); err != nil {
+	if flags.RequireSignature {
+		if err := sign.VerifySignature(lFile, sign.SignatureFile(flags.Outfile), flags.PublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	v, err := NewVerifierFS(nil, lFile, flags.Options)
+	if err != nil {
+		return nil, err
+	}
+	v.outfile = flags.Outfile
+	return v, nil
+}
+
+// NewVerifierFS verifies lFile against the files it lists in fsys.
+// If fsys is nil, the host's file system is used.
+func NewVerifierFS(fsys fs.FS, lFile *generate.Lockfile, opts Options) (*Verifier, error) {
+	// Copy the Lockfile, as it would be read from disk, so that it compares
+	// equal to the regenerated one.
+	lByt, err := lFile.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	lFile = &generate.Lockfile{}
+	if err := json.Unmarshal(lByt, lFile); err != nil {
 		return nil, err
 	}
 	var i int
@@ -38,71 +105,455 @@ func NewVerifier(flags *Flags) (*Verifier, error) {
 		dFpaths[i] = filepath.FromSlash(fpath)
 		i++
 	}
-	g := &generate.Generator{Dockerfiles: dFpaths, Composefiles: cFpaths}
-	return &Verifier{Generator: g, Lockfile: &lFile, outfile: flags.Outfile}, nil
+	i = 0
+	kFpaths := make([]string, len(lFile.KubernetesfileImages))
+	for fpath := range lFile.KubernetesfileImages {
+		kFpaths[i] = filepath.FromSlash(fpath)
+		i++
+	}
+	i = 0
+	ciFpaths := make([]string, len(lFile.CIfileImages))
+	for fpath := range lFile.CIfileImages {
+		ciFpaths[i] = filepath.FromSlash(fpath)
+		i++
+	}
+	i = 0
+	bFpaths := make([]string, len(lFile.BakefileImages))
+	for fpath := range lFile.BakefileImages {
+		bFpaths[i] = filepath.FromSlash(fpath)
+		i++
+	}
+	sort.Strings(cFpaths)
+	sort.Strings(dFpaths)
+	sort.Strings(kFpaths)
+	sort.Strings(ciFpaths)
+	sort.Strings(bFpaths)
+	// Images locked from a constraint are resolved from the same constraint,
+	// so that newer matching tags are reported. If entries of an image have
+	// different constraints, Verify resolves each entry from its own.
+	constraints := make(map[string]string)
+	addConstraint := func(image generate.Image) {
+		if c, ok := constraints[image.Name]; image.Constraint != "" && (!ok || image.Constraint < c) {
+			constraints[image.Name] = image.Constraint
+		}
+	}
+	for _, images := range lFile.DockerfileImages {
+		for _, image := range images {
+			addConstraint(image.Image)
+		}
+	}
+	for _, images := range lFile.ComposefileImages {
+		for _, image := range images {
+			addConstraint(image.Image)
+		}
+	}
+	for _, images := range lFile.KubernetesfileImages {
+		for _, image := range images {
+			addConstraint(image.Image)
+		}
+	}
+	for _, images := range lFile.CIfileImages {
+		for _, image := range images {
+			addConstraint(image.Image)
+		}
+	}
+	// Only the bake targets in the Lockfile are locked again.
+	bakeTargetSet := make(map[string]bool)
+	for _, images := range lFile.BakefileImages {
+		for _, image := range images {
+			addConstraint(image.Image)
+			bakeTargetSet[image.Target] = true
+		}
+	}
+	bakeTargets := make([]string, 0, len(bakeTargetSet))
+	for target := range bakeTargetSet {
+		bakeTargets = append(bakeTargets, target)
+	}
+	sort.Strings(bakeTargets)
+	g := &generate.Generator{Dockerfiles: dFpaths,
+		Composefiles:    cFpaths,
+		Kubernetesfiles: kFpaths,
+		CIfiles:         ciFpaths,
+		Bakefiles:       bFpaths,
+		BakeTargets:     bakeTargets,
+		FS:              fsys,
+		Env:             opts.Env,
+		Constraints:     constraints,
+	}
+	if err := g.FilterGitFiles(opts.GitTracked, opts.ChangedSince); err != nil {
+		return nil, err
+	}
+	filteredLFile := &generate.Lockfile{
+		DockerfileImages:     make(map[string][]generate.DockerfileImage),
+		ComposefileImages:    make(map[string][]generate.ComposefileImage),
+		KubernetesfileImages: make(map[string][]generate.KubernetesfileImage),
+		CIfileImages:         make(map[string][]generate.CIfileImage),
+		BakefileImages:       make(map[string][]generate.BakefileImage),
+	}
+	for _, fpath := range g.Dockerfiles {
+		filteredLFile.DockerfileImages[filepath.ToSlash(fpath)] = lFile.DockerfileImages[filepath.ToSlash(fpath)]
+	}
+	for _, fpath := range g.Composefiles {
+		filteredLFile.ComposefileImages[filepath.ToSlash(fpath)] = lFile.ComposefileImages[filepath.ToSlash(fpath)]
+	}
+	for _, fpath := range g.Kubernetesfiles {
+		filteredLFile.KubernetesfileImages[filepath.ToSlash(fpath)] = lFile.KubernetesfileImages[filepath.ToSlash(fpath)]
+	}
+	for _, fpath := range g.CIfiles {
+		filteredLFile.CIfileImages[filepath.ToSlash(fpath)] = lFile.CIfileImages[filepath.ToSlash(fpath)]
+	}
+	for _, fpath := range g.Bakefiles {
+		filteredLFile.BakefileImages[filepath.ToSlash(fpath)] = lFile.BakefileImages[filepath.ToSlash(fpath)]
+	}
+	signatureKeys, err := loadPublicKeys(opts.SignatureKeys)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{Generator: g, Lockfile: filteredLFile, signatureKeys: signatureKeys, auditor: opts.Auditor}, nil
 }
 
 func (v *Verifier) VerifyLockfile(wrapperManager *registry.WrapperManager) error {
-	lByt, err := v.GenerateLockfileBytes(wrapperManager)
+	report, err := v.Verify(wrapperManager)
 	if err != nil {
 		return err
 	}
+	return report.Err()
+}
+
+// Err returns an error listing every difference and unverified signature,
+// or nil if the Lockfile was verified.
+func (r *Report) Err() error {
+	var messages []string
+	for _, difference := range r.Differences {
+		messages = append(messages, difference.Message)
+	}
+	for _, signature := range r.Signatures {
+		if !signature.Verified {
+			messages = append(messages, signature.Message)
+		}
+	}
+	if r.audit != nil {
+		for _, finding := range r.audit.Failed() {
+			messages = append(messages, finding.Message())
+		}
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	return fmt.Errorf("Failed to verify. %s", strings.Join(messages, "\n"))
+}
+
+// Write writes the report as JSON or as a SARIF log, depending on format.
+// SARIF results point at the source of each image that differs, and at the
+// Lockfile for unverified signatures.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(r)
+	case "sarif":
+		rules := []sarif.Rule{
+			{ID: "outdated-image", ShortDescription: &sarif.Message{Text: "Image differs from the Lockfile."}},
+			{ID: "unverified-signature", ShortDescription: &sarif.Message{Text: "Locked digest is not signed by the configured key."}},
+			{ID: "vulnerable-image", ShortDescription: &sarif.Message{Text: "Locked image is affected by an advisory."}},
+		}
+		results := []sarif.Result{}
+		for _, difference := range r.Differences {
+			source := difference.Source
+			results = append(results, sarif.Result{RuleID: "outdated-image",
+				Level:     "error",
+				Message:   sarif.Message{Text: difference.Message},
+				Locations: []sarif.Location{sarif.NewLocation(source.File, source.Line, source.utf16Column)},
+			})
+		}
+		for _, signature := range r.Signatures {
+			if signature.Verified {
+				continue
+			}
+			result := sarif.Result{RuleID: "unverified-signature",
+				Level:   "error",
+				Message: sarif.Message{Text: signature.Message},
+			}
+			if r.lockfile != "" {
+				result.Locations = []sarif.Location{sarif.NewLocation(r.lockfile, 0, 0)}
+			}
+			results = append(results, result)
+		}
+		if r.audit != nil {
+			for _, finding := range r.audit.Failed() {
+				result := sarif.Result{RuleID: "vulnerable-image",
+					Level:   "error",
+					Message: sarif.Message{Text: finding.Message()},
+				}
+				if r.lockfile != "" {
+					result.Locations = []sarif.Location{sarif.NewLocation(r.lockfile, 0, 0)}
+				}
+				results = append(results, result)
+			}
+		}
+		return sarif.NewLog(rules, results).Write(w)
+	}
+	return fmt.Errorf("Unsupported format '%s'. Expected 'json' or 'sarif'.", format)
+}
+
+// Verify regenerates the Lockfile and reports every image that differs,
+// whether locked digests are signed by the keys in SignatureKeys, and the
+// locked images that the Auditor's advisories affect. An error is only
+// returned if the Lockfile could not be regenerated.
+func (v *Verifier) Verify(wrapperManager *registry.WrapperManager) (*Report, error) {
+	lByt, err := v.GenerateLockfileBytes(wrapperManager)
+	if err != nil {
+		return nil, err
+	}
 	var lFile generate.Lockfile
 	if err := json.Unmarshal(lByt, &lFile); err != nil {
-		return err
+		return nil, err
 	}
-	err = errors.New("Failed to verify.")
-	if len(v.DockerfileImages) != len(lFile.DockerfileImages) {
-		err = fmt.Errorf("%s Found %d Dockerfiles. Expected %d.",
-			err,
-			len(lFile.DockerfileImages),
-			len(v.DockerfileImages))
-		return err
+	if err := v.resolveConstraints(wrapperManager, &lFile); err != nil {
+		return nil, err
 	}
-	if len(v.ComposefileImages) != len(lFile.ComposefileImages) {
-		err = fmt.Errorf("%s Found %d Composefiles. Expected %d.",
-			err,
-			len(lFile.ComposefileImages),
-			len(v.ComposefileImages))
-		return err
+	expectedDImages := make(map[string][]interface{})
+	for fpath, images := range v.DockerfileImages {
+		for _, image := range images {
+			expectedDImages[fpath] = append(expectedDImages[fpath], image)
+		}
+	}
+	foundDImages := make(map[string][]interface{})
+	for fpath, images := range lFile.DockerfileImages {
+		for _, image := range images {
+			foundDImages[fpath] = append(foundDImages[fpath], image)
+		}
+	}
+	expectedCImages := make(map[string][]interface{})
+	for fpath, images := range v.ComposefileImages {
+		for _, image := range images {
+			expectedCImages[fpath] = append(expectedCImages[fpath], image)
+		}
+	}
+	foundCImages := make(map[string][]interface{})
+	for fpath, images := range lFile.ComposefileImages {
+		for _, image := range images {
+			foundCImages[fpath] = append(foundCImages[fpath], image)
+		}
+	}
+	expectedKImages := make(map[string][]interface{})
+	for fpath, images := range v.KubernetesfileImages {
+		for _, image := range images {
+			expectedKImages[fpath] = append(expectedKImages[fpath], image)
+		}
+	}
+	foundKImages := make(map[string][]interface{})
+	for fpath, images := range lFile.KubernetesfileImages {
+		for _, image := range images {
+			foundKImages[fpath] = append(foundKImages[fpath], image)
+		}
+	}
+	expectedCIImages := make(map[string][]interface{})
+	for fpath, images := range v.CIfileImages {
+		for _, image := range images {
+			expectedCIImages[fpath] = append(expectedCIImages[fpath], image)
+		}
+	}
+	foundCIImages := make(map[string][]interface{})
+	for fpath, images := range lFile.CIfileImages {
+		for _, image := range images {
+			foundCIImages[fpath] = append(foundCIImages[fpath], image)
+		}
+	}
+	expectedBImages := make(map[string][]interface{})
+	for fpath, images := range v.BakefileImages {
+		for _, image := range images {
+			expectedBImages[fpath] = append(expectedBImages[fpath], image)
+		}
 	}
-	for dFpath := range v.DockerfileImages {
-		if len(v.DockerfileImages[dFpath]) != len(lFile.DockerfileImages[dFpath]) {
-			err = fmt.Errorf("%s Found %d images in file %s. Expected %d.",
-				err,
-				len(lFile.DockerfileImages[dFpath]),
-				dFpath,
-				len(v.DockerfileImages[dFpath]))
+	foundBImages := make(map[string][]interface{})
+	for fpath, images := range lFile.BakefileImages {
+		for _, image := range images {
+			foundBImages[fpath] = append(foundBImages[fpath], image)
+		}
+	}
+	report := &Report{lockfile: filepath.ToSlash(v.outfile)}
+	report.Differences = append(report.Differences, compareSection("dockerfiles", expectedDImages, foundDImages)...)
+	report.Differences = append(report.Differences, compareSection("composefiles", expectedCImages, foundCImages)...)
+	report.Differences = append(report.Differences, compareSection("kubernetesfiles", expectedKImages, foundKImages)...)
+	report.Differences = append(report.Differences, compareSection("cifiles", expectedCIImages, foundCIImages)...)
+	report.Differences = append(report.Differences, compareSection("bakefiles", expectedBImages, foundBImages)...)
+	if err := v.locateDifferences(report.Differences); err != nil {
+		return nil, err
+	}
+	report.Signatures = v.verifySignatures(wrapperManager)
+	if v.auditor != nil {
+		report.audit = v.auditor.Audit(v.Lockfile)
+		report.Vulnerabilities = report.audit.Findings
+	}
+	return report, nil
+}
+
+// resolveConstraints resolves each regenerated image in found from the
+// constraint of the image it is expected to be, if their constraints differ,
+// as images are regenerated with one constraint per name.
+func (v *Verifier) resolveConstraints(wrapperManager *registry.WrapperManager, found *generate.Lockfile) error {
+	resolve := func(foundImage *generate.Image, expectedImage generate.Image) error {
+		if foundImage.Name != expectedImage.Name || foundImage.Tag != expectedImage.Tag || foundImage.Constraint == expectedImage.Constraint {
+			return nil
+		}
+		image, err := generate.ResolveImage(wrapperManager.GetWrapper(foundImage.Name), foundImage.Name, foundImage.Tag, expectedImage.Constraint)
+		if err != nil {
 			return err
 		}
-		for i := range v.DockerfileImages[dFpath] {
-			if v.DockerfileImages[dFpath][i] != lFile.DockerfileImages[dFpath][i] {
-				err = fmt.Errorf("%s Found image:\n%+v\nExpected image:\n%+v",
-					err,
-					lFile.DockerfileImages[dFpath][i],
-					v.DockerfileImages[dFpath][i])
-				return err
+		*foundImage = image
+		return nil
+	}
+	for fpath, images := range found.DockerfileImages {
+		for i := range images {
+			if i < len(v.DockerfileImages[fpath]) {
+				if err := resolve(&images[i].Image, v.DockerfileImages[fpath][i].Image); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for fpath, images := range found.ComposefileImages {
+		for i := range images {
+			if i < len(v.ComposefileImages[fpath]) {
+				if err := resolve(&images[i].Image, v.ComposefileImages[fpath][i].Image); err != nil {
+					return err
+				}
 			}
 		}
 	}
-	for cFpath := range v.ComposefileImages {
-		if len(v.ComposefileImages[cFpath]) != len(lFile.ComposefileImages[cFpath]) {
-			err = fmt.Errorf("%s Found %d images in file %s. Expected %d.",
-				err,
-				len(lFile.ComposefileImages[cFpath]),
-				cFpath,
-				len(v.ComposefileImages[cFpath]))
-			return err
+	for fpath, images := range found.KubernetesfileImages {
+		for i := range images {
+			if i < len(v.KubernetesfileImages[fpath]) {
+				if err := resolve(&images[i].Image, v.KubernetesfileImages[fpath][i].Image); err != nil {
+					return err
+				}
+			}
 		}
-		for i := range v.ComposefileImages[cFpath] {
-			if v.ComposefileImages[cFpath][i] != lFile.ComposefileImages[cFpath][i] {
-				err = fmt.Errorf("%s Found image:\n%+v\nExpected image:\n%+v",
-					err,
-					lFile.ComposefileImages[cFpath][i],
-					v.ComposefileImages[cFpath][i])
-				return err
+	}
+	for fpath, images := range found.CIfileImages {
+		for i := range images {
+			if i < len(v.CIfileImages[fpath]) {
+				if err := resolve(&images[i].Image, v.CIfileImages[fpath][i].Image); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for fpath, images := range found.BakefileImages {
+		for i := range images {
+			if i < len(v.BakefileImages[fpath]) {
+				if err := resolve(&images[i].Image, v.BakefileImages[fpath][i].Image); err != nil {
+					return err
+				}
 			}
 		}
 	}
 	return nil
 }
+
+// locateDifferences sets the Source of each difference to where the image
+// it found is written.
+func (v *Verifier) locateDifferences(differences []Difference) error {
+	if len(differences) == 0 {
+		return nil
+	}
+	imageLines, err := v.ImageLines()
+	if err != nil {
+		return err
+	}
+	sources := make(map[string]Source)
+	for _, imageLine := range imageLines {
+		key := fmt.Sprintf("%s\x00%s\x00%d", imageLine.Section, imageLine.SectionFile, imageLine.Position)
+		sources[key] = Source{File: imageLine.File,
+			Line:        imageLine.Line,
+			Column:      imageLine.Column,
+			utf16Column: imageLine.UTF16Column,
+		}
+	}
+	for i, difference := range differences {
+		key := fmt.Sprintf("%s\x00%s\x00%d", difference.Section, difference.File, difference.Position)
+		source, ok := sources[key]
+		if !ok {
+			source = Source{File: difference.File}
+		}
+		differences[i].Source = source
+	}
+	return nil
+}
+
+func compareSection(section string, expected map[string][]interface{}, found map[string][]interface{}) []Difference {
+	fpathSet := make(map[string]bool)
+	for fpath := range expected {
+		fpathSet[fpath] = true
+	}
+	for fpath := range found {
+		fpathSet[fpath] = true
+	}
+	fpaths := make([]string, 0, len(fpathSet))
+	for fpath := range fpathSet {
+		fpaths = append(fpaths, fpath)
+	}
+	sort.Strings(fpaths)
+	var differences []Difference
+	for _, fpath := range fpaths {
+		if len(expected[fpath]) != len(found[fpath]) {
+			differences = append(differences, Difference{
+				Section:  section,
+				File:     fpath,
+				Position: -1,
+				Message: fmt.Sprintf("Found %d images in file %s. Expected %d.",
+					len(found[fpath]),
+					fpath,
+					len(expected[fpath])),
+			})
+			continue
+		}
+		for i := range expected[fpath] {
+			if expected[fpath][i] != found[fpath][i] {
+				differences = append(differences, Difference{
+					Section:  section,
+					File:     fpath,
+					Position: i,
+					Expected: expected[fpath][i],
+					Found:    found[fpath][i],
+					Message:  differenceMessage(expected[fpath][i], found[fpath][i]),
+				})
+			}
+		}
+	}
+	return differences
+}
+
+func differenceMessage(expected interface{}, found interface{}) string {
+	expectedImage, foundImage := image(expected), image(found)
+	if expectedImage.Constraint != "" && expectedImage.Constraint == foundImage.Constraint {
+		expectedVersion, expectedErr := semver.Parse(expectedImage.ResolvedTag)
+		foundVersion, foundErr := semver.Parse(foundImage.ResolvedTag)
+		if expectedErr == nil && foundErr == nil && foundVersion.Compare(expectedVersion) > 0 {
+			return fmt.Sprintf("Newer tag '%s' of image '%s' matches constraint '%s'. Lockfile has tag '%s'.",
+				foundImage.ResolvedTag,
+				foundImage.Name,
+				foundImage.Constraint,
+				expectedImage.ResolvedTag)
+		}
+	}
+	return fmt.Sprintf("Found image:\n%+v\nExpected image:\n%+v", found, expected)
+}
+
+func image(i interface{}) generate.Image {
+	switch i := i.(type) {
+	case generate.DockerfileImage:
+		return i.Image
+	case generate.ComposefileImage:
+		return i.Image
+	case generate.KubernetesfileImage:
+		return i.Image
+	case generate.CIfileImage:
+		return i.Image
+	case generate.BakefileImage:
+		return i.Image
+	}
+	return generate.Image{}
+}
@@ -0,0 +1,473 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/michaelperel/docker-lock/audit"
+	"github.com/michaelperel/docker-lock/generate"
+	"github.com/michaelperel/docker-lock/registry"
+	"github.com/michaelperel/docker-lock/sarif"
+	"github.com/michaelperel/docker-lock/sign"
+)
+
+type mockWrapper struct {
+	tags map[string][]string
+}
+
+func (w *mockWrapper) GetDigest(name string, tag string) (string, error) {
+	digest := sha256.Sum256([]byte(name + ":" + tag))
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func (w *mockWrapper) GetTags(name string) ([]string, error) {
+	return w.tags[name], nil
+}
+
+func (w *mockWrapper) Prefix() string {
+	return ""
+}
+
+func TestVerifyFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":         {Data: []byte("FROM busybox\nFROM ubuntu:18.04\n")},
+		"docker-compose.yml": {Data: []byte("services:\n  db:\n    image: postgres:12\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 0 {
+		t.Fatalf("Got %+v. Expected no differences.", report.Differences)
+	}
+	lFile.DockerfileImages["Dockerfile"][1].Digest = "tampered"
+	lFile.ComposefileImages["docker-compose.yml"] = nil
+	v, err = NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 2 {
+		t.Fatalf("Got %d differences. Expected 2.", len(report.Differences))
+	}
+	dDifference := report.Differences[0]
+	if dDifference.Section != "dockerfiles" || dDifference.File != "Dockerfile" || dDifference.Position != 1 {
+		t.Fatalf("Got %+v. Expected a difference at position 1 of 'Dockerfile'.", dDifference)
+	}
+	if dDifference.Expected.(generate.DockerfileImage).Digest != "tampered" {
+		t.Fatalf("Got %+v. Expected the tampered digest.", dDifference.Expected)
+	}
+	if expected := (Source{File: "Dockerfile", Line: 2, Column: 6, utf16Column: 6}); dDifference.Source != expected {
+		t.Fatalf("Got %+v. Expected %+v.", dDifference.Source, expected)
+	}
+	cDifference := report.Differences[1]
+	if cDifference.Section != "composefiles" || cDifference.Position != -1 {
+		t.Fatalf("Got %+v. Expected a difference in the number of images.", cDifference)
+	}
+	if expected := (Source{File: "docker-compose.yml"}); cDifference.Source != expected {
+		t.Fatalf("Got %+v. Expected %+v.", cDifference.Source, expected)
+	}
+	if err := v.VerifyLockfile(wm); err == nil {
+		t.Fatal("Verifying a tampered Lockfile should fail.")
+	}
+}
+
+func TestVerifyAdvisories(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile": {Data: []byte("FROM nginx:1.19.0\nFROM nginx:1.21.0\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditor, err := audit.NewAuditor(audit.Options{AdvisoriesPath: filepath.Join("testdata", "flags", "advisories.json"), FailOn: "high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifierFS(fsys, lFile, Options{Auditor: auditor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 0 {
+		t.Fatalf("Got %+v. Expected no differences.", report.Differences)
+	}
+	if len(report.Vulnerabilities) != 1 || !strings.HasPrefix(report.Vulnerabilities[0].Image, "nginx:1.19.0@") {
+		t.Fatalf("Got %+v. Expected 'nginx:1.19.0' to be vulnerable.", report.Vulnerabilities)
+	}
+	if err := v.VerifyLockfile(wm); err == nil || !strings.Contains(err.Error(), "CVE-2021-23017") {
+		t.Fatalf("Got '%v'. Expected the vulnerable image to fail.", err)
+	}
+	var sarifOutput bytes.Buffer
+	if err := report.Write(&sarifOutput, "sarif"); err != nil {
+		t.Fatal(err)
+	}
+	var log sarif.Log
+	if err := json.Unmarshal(sarifOutput.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if results := log.Runs[0].Results; len(results) != 1 || results[0].RuleID != "vulnerable-image" {
+		t.Fatalf("Got %+v. Expected a 'vulnerable-image' result.", results)
+	}
+	auditor.FailOn = "critical"
+	if err := v.VerifyLockfile(wm); err != nil {
+		t.Fatalf("Got '%s'. Expected findings less severe than FailOn to pass.", err)
+	}
+}
+
+func TestReportWriteSARIF(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docker-compose.yml": {Data: []byte("services:\n  db:\n    image: postgres:12\n  web:\n    build: web\n")},
+		"web/Dockerfile":     {Data: []byte("# web\nFROM  node:12\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range lFile.ComposefileImages["docker-compose.yml"] {
+		lFile.ComposefileImages["docker-compose.yml"][i].Digest = "tampered"
+	}
+	v, err := NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sarifOutput bytes.Buffer
+	if err := report.Write(&sarifOutput, "sarif"); err != nil {
+		t.Fatal(err)
+	}
+	var log sarif.Log
+	if err := json.Unmarshal(sarifOutput.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("Got %+v. Expected a SARIF 2.1.0 log with 1 run.", log)
+	}
+	expected := []sarif.Location{
+		sarif.NewLocation("docker-compose.yml", 3, 12),
+		sarif.NewLocation("web/Dockerfile", 2, 7),
+	}
+	results := log.Runs[0].Results
+	if len(results) != len(expected) {
+		t.Fatalf("Got %d results. Expected %d.", len(results), len(expected))
+	}
+	for i, result := range results {
+		if result.RuleID != "outdated-image" || !reflect.DeepEqual(result.Locations, []sarif.Location{expected[i]}) {
+			t.Fatalf("Got %+v. Expected 'outdated-image' at %+v.", result, expected[i])
+		}
+	}
+	if err := report.Write(&bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("Unsupported format should fail.")
+	}
+}
+
+func TestVerifyNewerTag(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile": {Data: []byte("FROM node:12\n")},
+	}
+	tags := map[string][]string{"node": {"12.18.3", "12.9.0"}}
+	wm := registry.NewWrapperManager(&mockWrapper{tags: tags})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{Constraints: map[string]string{"node": "^12"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The constraint is read from the Lockfile, not from options.
+	v, err := NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 0 {
+		t.Fatalf("Got %+v. Expected no differences.", report.Differences)
+	}
+	tags["node"] = append(tags["node"], "12.19.0", "13.0.0")
+	report, err = v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 1 {
+		t.Fatalf("Got %d differences. Expected 1.", len(report.Differences))
+	}
+	expectedMessage := "Newer tag '12.19.0' of image 'node' matches constraint '^12'. Lockfile has tag '12.18.3'."
+	if message := report.Differences[0].Message; message != expectedMessage {
+		t.Fatalf("Got '%s'. Expected '%s'.", message, expectedMessage)
+	}
+}
+
+func TestVerifyConstraintPerImage(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Dockerfile":     {Data: []byte("FROM node:12\n")},
+		"api/Dockerfile": {Data: []byte("FROM node:14\n")},
+	}
+	tags := map[string][]string{"node": {"12.18.3", "14.4.0"}}
+	wm := registry.NewWrapperManager(&mockWrapper{tags: tags})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{Dockerfiles: []string{"Dockerfile", "api/Dockerfile"}, Constraints: map[string]string{"node": "^12"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The images of api/Dockerfile were locked with another constraint.
+	apiImage, err := generate.ResolveImage(&mockWrapper{tags: tags}, "node", "14", "^14")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile.DockerfileImages["api/Dockerfile"][0].Image = apiImage
+	if apiImage.Tag != "14" || apiImage.ResolvedTag != "14.4.0" {
+		t.Fatalf("Got %+v. Expected 'node:14' resolved to '14.4.0'.", apiImage)
+	}
+	for i := 0; i < 5; i++ {
+		v, err := NewVerifierFS(fsys, lFile, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := v.Verify(wm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Differences) != 0 {
+			t.Fatalf("Got %+v. Expected each image to be verified with its own constraint.", report.Differences)
+		}
+	}
+}
+
+func TestVerifyKubernetesfiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pod.yaml": {Data: []byte("kind: Pod\nmetadata:\n  name: web\nspec:\n  containers:\n    - name: web\n      image: nginx:1.19\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{Kubernetesfiles: []string{"pod.yaml"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 0 {
+		t.Fatalf("Got %+v. Expected no differences.", report.Differences)
+	}
+	lFile.KubernetesfileImages["pod.yaml"][0].Digest = "tampered"
+	v, err = NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 1 {
+		t.Fatalf("Got %d differences. Expected 1.", len(report.Differences))
+	}
+	if difference := report.Differences[0]; difference.Section != "kubernetesfiles" || difference.File != "pod.yaml" || difference.Position != 0 {
+		t.Fatalf("Got %+v. Expected a difference at position 0 of 'pod.yaml'.", difference)
+	}
+}
+
+func TestVerifyCIfiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitlab-ci.yml": {Data: []byte("test:\n  image: node:12\n  script:\n    - npm test\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{CI: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ciImages := lFile.CIfileImages[".gitlab-ci.yml"]; len(ciImages) != 1 || ciImages[0].Job != "test" || ciImages[0].Key != "image" {
+		t.Fatalf("Got %+v. Expected the image of job 'test'.", ciImages)
+	}
+	lFile.CIfileImages[".gitlab-ci.yml"][0].Digest = "tampered"
+	v, err := NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 1 {
+		t.Fatalf("Got %d differences. Expected 1.", len(report.Differences))
+	}
+	if difference := report.Differences[0]; difference.Section != "cifiles" || difference.File != ".gitlab-ci.yml" || difference.Position != 0 {
+		t.Fatalf("Got %+v. Expected a difference at position 0 of '.gitlab-ci.yml'.", difference)
+	}
+}
+
+func TestVerifyBakefiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docker-bake.hcl": {Data: []byte("group \"default\" {\n  targets = [\"app\"]\n}\ntarget \"app\" {}\ntarget \"docs\" {\n  dockerfile = \"Dockerfile.docs\"\n}\n")},
+		"Dockerfile":      {Data: []byte("FROM node:12\n")},
+		"Dockerfile.docs": {Data: []byte("FROM python:3.7\n")},
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	g, err := generate.NewGeneratorFS(fsys, generate.Options{Bakefiles: []string{"docker-bake.hcl"}, BakeTargets: []string{"docs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lFile, err := g.Generate(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The targets in the Lockfile, not the default group, are verified.
+	v, err := NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 0 {
+		t.Fatalf("Got %+v. Expected no differences.", report.Differences)
+	}
+	lFile.BakefileImages["docker-bake.hcl"][0].Digest = "tampered"
+	v, err = NewVerifierFS(fsys, lFile, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = v.Verify(wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) != 1 || report.Differences[0].Section != "bakefiles" {
+		t.Fatalf("Got %+v. Expected a difference in the bakefiles section.", report.Differences)
+	}
+}
+
+func TestVerifyLockfileFormats(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte("FROM busybox\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wm := registry.NewWrapperManager(&mockWrapper{})
+	for _, outfile := range []string{"docker-lock.yaml", "docker-lock.toml"} {
+		outfile = filepath.Join(dir, outfile)
+		g, err := generate.NewGenerator(&generate.Flags{Options: generate.Options{Dockerfiles: []string{dockerfile}}, Outfile: outfile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := g.GenerateLockfile(wm); err != nil {
+			t.Fatal(err)
+		}
+		v, err := NewVerifier(&Flags{Outfile: outfile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.VerifyLockfile(wm); err != nil {
+			t.Fatalf("Got '%s'. Expected the Lockfile '%s' to verify.", err, outfile)
+		}
+		if _, err := NewVerifier(&Flags{Outfile: outfile, LockfileFormat: "json"}); err == nil {
+			t.Fatalf("Reading '%s' as JSON should fail.", outfile)
+		}
+	}
+}
+
+func TestVerifyRequireSignature(t *testing.T) {
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(dockerfile, []byte("FROM busybox\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outfile := filepath.Join(dir, "docker-lock.json")
+	g, err := generate.NewGenerator(&generate.Flags{Options: generate.Options{Dockerfiles: []string{dockerfile}}, Outfile: outfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.GenerateLockfile(registry.NewWrapperManager(&mockWrapper{})); err != nil {
+		t.Fatal(err)
+	}
+	signFlags := &sign.Flags{Outfile: outfile,
+		KeyFile:       filepath.Join(dir, "docker-lock.key"),
+		PublicKeyFile: filepath.Join(dir, "docker-lock.pub"),
+	}
+	if err := sign.GenerateKey(signFlags.KeyFile, signFlags.PublicKeyFile); err != nil {
+		t.Fatal(err)
+	}
+	flags := &Flags{Outfile: outfile, RequireSignature: true, PublicKeyFile: signFlags.PublicKeyFile}
+	if _, err := NewVerifier(flags); err == nil {
+		t.Fatal("Unsigned Lockfile should fail verification.")
+	}
+	signer, err := sign.NewSigner(signFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Sign(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(flags); err != nil {
+		t.Fatal(err)
+	}
+	lByt, err := ioutil.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lByt = []byte(strings.Replace(string(lByt), `"busybox"`, `"alpine"`, 1))
+	if err := ioutil.WriteFile(outfile, lByt, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifier(flags); err == nil {
+		t.Fatal("Tampered Lockfile should fail verification.")
+	}
+}